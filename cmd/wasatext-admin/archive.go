@@ -0,0 +1,27 @@
+package main
+
+import (
+	"time"
+)
+
+// A backup is a tar archive, optionally gzipped, with these entries:
+//
+//	wasatext.db       snapshot of the database
+//	media/<key>       a blob of the media directory, for every blob
+//	manifest.json     the manifest
+const (
+	databaseEntry = "wasatext.db"
+	mediaPrefix   = "media/"
+	manifestEntry = "manifest.json"
+)
+
+// manifest describes the content of a backup
+type manifest struct {
+	CreatedAt time.Time `json:"created_at"`
+
+	// SchemaVersion is the version of the last migration applied to the database
+	SchemaVersion int `json:"schema_version"`
+
+	// Media is the number of blobs in the backup, which has none if the media are not stored on the filesystem
+	Media int `json:"media"`
+}
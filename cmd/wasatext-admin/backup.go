@@ -0,0 +1,208 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Nyheim99/WASAText/service/blobstore"
+	"github.com/Nyheim99/WASAText/service/database"
+	"github.com/Nyheim99/WASAText/service/globaltime"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// runBackup writes a backup of the database and of the media to output, or to a timestamped file in the backup
+// directory if output is empty
+func runBackup(cfg AdminConfiguration, output string) error {
+	if cfg.DB.Driver != database.DriverSQLite {
+		return fmt.Errorf("%w: use the tools of the database instead", database.ErrBackupNotSupported)
+	}
+	if _, err := os.Stat(cfg.DB.Filename); err != nil {
+		return fmt.Errorf("opening the database: %w", err)
+	}
+
+	m := manifest{CreatedAt: globaltime.Now().UTC()}
+	if output == "" {
+		name := "wasatext-" + m.CreatedAt.Format("20060102T150405Z") + ".tar"
+		if cfg.Backup.Compress {
+			name += ".gz"
+		}
+		output = filepath.Join(cfg.Backup.Directory, name)
+	}
+	ctx := context.Background()
+
+	// The database is copied before the media: blobs are never changed nor deleted, and they are stored before the rows
+	// which reference them, so every blob referenced by the snapshot is there when the media are copied
+	tmpDir, err := os.MkdirTemp("", "wasatext-backup-*")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.RemoveAll(tmpDir) }()
+
+	snapshot := filepath.Join(tmpDir, databaseEntry)
+	if err := withSQLite(cfg.DB.Filename, func(db *sql.DB) error {
+		return database.Backup(ctx, db, cfg.DB.Driver, snapshot)
+	}); err != nil {
+		return err
+	}
+
+	// Check the snapshot right away, rather than when it is needed
+	if err := withSQLite(snapshot, func(db *sql.DB) error {
+		status, err := database.CheckIntegrity(ctx, db, cfg.DB.Driver)
+		if err != nil {
+			return fmt.Errorf("checking the snapshot: %w", err)
+		}
+		m.SchemaVersion = schemaVersion(status)
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	// Write to a temporary file, so that an interrupted backup doesn't look like a complete one
+	partial := output + ".partial"
+	f, err := os.OpenFile(partial, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return fmt.Errorf("creating backup file: %w", err)
+	}
+	defer func() {
+		_ = f.Close()
+		_ = os.Remove(partial)
+	}()
+
+	if err := writeBackup(f, cfg, snapshot, &m); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("writing backup file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("writing backup file: %w", err)
+	}
+	if _, err := os.Stat(output); err == nil {
+		return fmt.Errorf("%s already exists", output)
+	}
+	if err := os.Rename(partial, output); err != nil {
+		return fmt.Errorf("writing backup file: %w", err)
+	}
+
+	fmt.Printf("backup written to %s: schema version %d, %d media files\n", output, m.SchemaVersion, m.Media) //nolint:forbidigo
+	return nil
+}
+
+// writeBackup writes the archive of a backup to w, counting the media in m
+func writeBackup(w io.Writer, cfg AdminConfiguration, snapshot string, m *manifest) error {
+	var gz *gzip.Writer
+	if cfg.Backup.Compress {
+		gz = gzip.NewWriter(w)
+		w = gz
+	}
+	tw := tar.NewWriter(w)
+
+	db, err := os.Open(snapshot)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	if err := addEntry(tw, databaseEntry, db); err != nil {
+		return err
+	}
+
+	blobs, err := openBlobStore(cfg)
+	if err != nil {
+		return err
+	}
+	lister, ok := blobs.(blobstore.Lister)
+	if !ok {
+		return fmt.Errorf("media in %s storage can't be listed, so they can't be backed up", cfg.Storage.Backend)
+	}
+	err = lister.Keys(func(key string) error {
+		blob, err := blobs.Open(key)
+		if err != nil {
+			return err
+		}
+		defer blob.Close()
+		m.Media++
+		return addEntry(tw, mediaPrefix+key, blob)
+	})
+	if err != nil {
+		return fmt.Errorf("copying media: %w", err)
+	}
+
+	content, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = tw.WriteHeader(&tar.Header{Name: manifestEntry, Mode: 0o600, Size: int64(len(content)), ModTime: m.CreatedAt})
+	if err != nil {
+		return fmt.Errorf("writing manifest: %w", err)
+	}
+	if _, err := tw.Write(content); err != nil {
+		return fmt.Errorf("writing manifest: %w", err)
+	}
+
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("writing backup file: %w", err)
+	}
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			return fmt.Errorf("writing backup file: %w", err)
+		}
+	}
+	return nil
+}
+
+// addEntry adds the content of r to the archive as a file called name
+func addEntry(tw *tar.Writer, name string, r io.ReadSeeker) error {
+	size, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	hdr := &tar.Header{Name: name, Mode: 0o600, Size: size, ModTime: globaltime.Now()}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return fmt.Errorf("writing %s: %w", name, err)
+	}
+	if _, err := io.Copy(tw, r); err != nil {
+		return fmt.Errorf("writing %s: %w", name, err)
+	}
+	return nil
+}
+
+// withSQLite calls fn with a connection to the SQLite database in filename. The journal mode is left as it is, as the
+// server may be using the database.
+func withSQLite(filename string, fn func(db *sql.DB) error) error {
+	dataSource, err := database.SQLiteDataSource(filename, database.SQLiteOptions{
+		ForeignKeys: true,
+		BusyTimeout: 5 * time.Second,
+	})
+	if err != nil {
+		return err
+	}
+	db, err := sql.Open(database.DriverSQLite, dataSource)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	return fn(db)
+}
+
+// schemaVersion returns the version of the last migration applied to a database
+func schemaVersion(status []database.MigrationStatus) int {
+	version := 0
+	for _, s := range status {
+		if s.AppliedAt != nil {
+			version = s.Version
+		}
+	}
+	return version
+}
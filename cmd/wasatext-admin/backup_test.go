@@ -0,0 +1,172 @@
+package main
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Nyheim99/WASAText/service/blobstore"
+	"github.com/Nyheim99/WASAText/service/database"
+	"github.com/Nyheim99/WASAText/service/globaltime"
+)
+
+// newInstallation returns the configuration of an installation in a temporary directory, with a SQLite database in WAL
+// mode, as the web API uses by default, and the filesystem media storage. The database has a notes table, to tell it
+// apart from others.
+func newInstallation(t *testing.T, compress bool) AdminConfiguration {
+	t.Helper()
+	dir := t.TempDir()
+
+	var cfg AdminConfiguration
+	cfg.DB.Driver = database.DriverSQLite
+	cfg.DB.Filename = filepath.Join(dir, "wasatext.db")
+	cfg.Storage.Backend = "filesystem"
+	cfg.Storage.Directory = filepath.Join(dir, "media")
+	cfg.Backup.Directory = dir
+	cfg.Backup.Compress = compress
+
+	db := openWAL(t, cfg.DB.Filename)
+	if _, err := db.Exec(`CREATE TABLE notes (note TEXT NOT NULL)`); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+// openWAL opens the SQLite database at filename in WAL mode
+func openWAL(t *testing.T, filename string) *sql.DB {
+	t.Helper()
+	dataSource, err := database.SQLiteDataSource(filename, database.SQLiteOptions{JournalMode: "WAL"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := sql.Open(database.DriverSQLite, dataSource)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	return db
+}
+
+// addNote adds a row to the notes of the database at filename
+func addNote(t *testing.T, filename string, note string) {
+	t.Helper()
+	db := openWAL(t, filename)
+	if _, err := db.Exec(`INSERT INTO notes (note) VALUES (?)`, note); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// notes returns the notes of the database at filename, in order
+func notes(t *testing.T, filename string) string {
+	t.Helper()
+	db := openWAL(t, filename)
+	rows, err := db.Query(`SELECT note FROM notes ORDER BY rowid`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	var all []string
+	for rows.Next() {
+		var note string
+		if err := rows.Scan(&note); err != nil {
+			t.Fatal(err)
+		}
+		all = append(all, note)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return strings.Join(all, ",")
+}
+
+// putBlob adds content to the media of the installation, and returns its key
+func putBlob(t *testing.T, cfg AdminConfiguration, content string) string {
+	t.Helper()
+	blobs, err := openBlobStore(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := blobs.Put(strings.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestBackupRestore(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		name := "tar"
+		if compress {
+			name = "gzip"
+		}
+		t.Run(name, func(t *testing.T) {
+			globaltime.FixedTime = time.Date(2024, 2, 2, 15, 4, 5, 0, time.UTC)
+			defer func() { globaltime.FixedTime = time.Time{} }()
+
+			cfg := newInstallation(t, compress)
+			addNote(t, cfg.DB.Filename, "backed up")
+			key := putBlob(t, cfg, "photo")
+
+			if err := runBackup(cfg, ""); err != nil {
+				t.Fatal(err)
+			}
+			output := filepath.Join(cfg.Backup.Directory, "wasatext-20240202T150405Z.tar")
+			if compress {
+				output += ".gz"
+			}
+			if _, err := os.Stat(output); err != nil {
+				t.Fatalf("backup not written: %v", err)
+			}
+
+			//Restoring brings back the database and the media, and keeps the database it replaces
+			addNote(t, cfg.DB.Filename, "lost")
+			if err := os.RemoveAll(cfg.Storage.Directory); err != nil {
+				t.Fatal(err)
+			}
+			if err := runRestore(cfg, output); err != nil {
+				t.Fatal(err)
+			}
+			if got := notes(t, cfg.DB.Filename); got != "backed up" {
+				t.Errorf("restored database has notes %q, want %q", got, "backed up")
+			}
+			replaced := cfg.DB.Filename + ".replaced-20240202T150405Z"
+			if got := notes(t, replaced); got != "backed up,lost" {
+				t.Errorf("replaced database has notes %q", got)
+			}
+			blobs, err := blobstore.NewFilesystem(cfg.Storage.Directory)
+			if err != nil {
+				t.Fatal(err)
+			}
+			blob, err := blobs.Open(key)
+			if err != nil {
+				t.Fatalf("media not restored: %v", err)
+			}
+			_ = blob.Close()
+
+			//Another restore in the same second keeps both replaced databases
+			addNote(t, cfg.DB.Filename, "lost again")
+			if err := runRestore(cfg, output); err != nil {
+				t.Fatal(err)
+			}
+			if got := notes(t, replaced); got != "backed up,lost" {
+				t.Errorf("first replaced database has notes %q", got)
+			}
+			if got := notes(t, replaced+"-2"); got != "backed up,lost again" {
+				t.Errorf("second replaced database has notes %q", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ardanlabs/conf"
+	"gopkg.in/yaml.v2"
+	"io"
+	"os"
+)
+
+// AdminConfiguration describes the configuration of the admin tool. It reads the same environment variables and
+// configuration file as the web API, so that both work on the same database and media.
+type AdminConfiguration struct {
+	Config struct {
+		Path string `conf:"default:/conf/config.yml"`
+	}
+	DB struct {
+		Driver     string `conf:"default:sqlite3,help:sqlite3 or postgres"`
+		Filename   string `conf:"default:/tmp/wasatext.db,help:database file (sqlite3)"`
+		DataSource string `conf:"mask,help:connection string (postgres)"`
+	}
+	Storage struct {
+		Backend     string `conf:"default:filesystem,help:filesystem or s3"`
+		Directory   string `conf:"default:/tmp/wasatext-media"`
+		ObjectStore struct {
+			Endpoint        string
+			Region          string `conf:"default:us-east-1"`
+			Bucket          string
+			AccessKeyID     string
+			SecretAccessKey string `conf:"mask"`
+			PathStyle       bool   `conf:"default:false"`
+		}
+	}
+	Backup struct {
+		Directory string `conf:"default:.,help:where backups are written"`
+		Compress  bool   `conf:"default:true,help:gzip backups"`
+	}
+
+	// Args holds the command and its arguments
+	Args conf.Args
+}
+
+// loadConfiguration creates an AdminConfiguration from flags, environment variables and configuration file, in the
+// same way as the web API does: see cmd/webapi/load-configuration.go.
+func loadConfiguration() (AdminConfiguration, error) {
+	var cfg AdminConfiguration
+
+	if err := conf.Parse(os.Args[1:], "CFG", &cfg); err != nil {
+		if errors.Is(err, conf.ErrHelpWanted) {
+			usage, err := conf.Usage("CFG", &cfg)
+			if err != nil {
+				return cfg, fmt.Errorf("generating config usage: %w", err)
+			}
+			fmt.Println(usage) //nolint:forbidigo
+			return cfg, conf.ErrHelpWanted
+		}
+		return cfg, fmt.Errorf("parsing config: %w", err)
+	}
+
+	fp, err := os.Open(cfg.Config.Path)
+	if err != nil && !os.IsNotExist(err) {
+		return cfg, fmt.Errorf("can't read the config file, while it exists: %w", err)
+	} else if err == nil {
+		yamlFile, err := io.ReadAll(fp)
+		if err != nil {
+			return cfg, fmt.Errorf("can't read config file: %w", err)
+		}
+		err = yaml.Unmarshal(yamlFile, &cfg)
+		if err != nil {
+			return cfg, fmt.Errorf("can't unmarshal config file: %w", err)
+		}
+		_ = fp.Close()
+	}
+
+	return cfg, nil
+}
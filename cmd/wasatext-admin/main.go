@@ -0,0 +1,63 @@
+/*
+Wasatext-admin is a tool for the maintenance of a WASAText installation. It reads the same configuration as the web API
+(flags, environment variables and configuration file), so that it works on the same database and media.
+
+Usage:
+
+	wasatext-admin [flags] backup [file]
+	wasatext-admin [flags] restore <file>
+
+The commands are:
+
+	backup
+		Writes a snapshot of the SQLite database and of the media, from the filesystem or S3 storage, to file, by
+		default a timestamped file in the backup directory. It can run while the server is running.
+
+	restore
+		Verifies the integrity of a backup, and then replaces the database with the one in the backup and adds the
+		media it contains to the media storage. The server must be stopped first: restore refuses to run while the
+		database is in use, which it can only tell with the WAL journal mode, the default of the web API. The replaced
+		database is kept next to the restored one.
+
+Run with --help for the list of flags.
+*/
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/ardanlabs/conf"
+)
+
+func main() {
+	if err := run(); err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, "error: ", err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	cfg, err := loadConfiguration()
+	if err != nil {
+		if errors.Is(err, conf.ErrHelpWanted) {
+			return nil
+		}
+		return err
+	}
+
+	switch cfg.Args.Num(0) {
+	case "backup":
+		return runBackup(cfg, cfg.Args.Num(1))
+	case "restore":
+		if cfg.Args.Num(1) == "" {
+			return errors.New("the backup file to restore is required")
+		}
+		return runRestore(cfg, cfg.Args.Num(1))
+	case "":
+		return errors.New("a command is required: backup or restore")
+	default:
+		return fmt.Errorf("unknown command %q, expected backup or restore", cfg.Args.Num(0))
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/Nyheim99/WASAText/service/blobstore"
+)
+
+// openBlobStore opens the media storage of the configuration, as the web API does
+func openBlobStore(cfg AdminConfiguration) (blobstore.Store, error) {
+	var blobs blobstore.Store
+	var err error
+	switch cfg.Storage.Backend {
+	case "filesystem":
+		blobs, err = blobstore.NewFilesystem(cfg.Storage.Directory)
+	case "s3":
+		blobs, err = blobstore.NewS3(blobstore.S3Config{
+			Endpoint:        cfg.Storage.ObjectStore.Endpoint,
+			Region:          cfg.Storage.ObjectStore.Region,
+			Bucket:          cfg.Storage.ObjectStore.Bucket,
+			AccessKeyID:     cfg.Storage.ObjectStore.AccessKeyID,
+			SecretAccessKey: cfg.Storage.ObjectStore.SecretAccessKey,
+			PathStyle:       cfg.Storage.ObjectStore.PathStyle,
+		})
+	default:
+		err = fmt.Errorf("unknown storage backend %q", cfg.Storage.Backend)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("opening the %s media storage: %w", cfg.Storage.Backend, err)
+	}
+	return blobs, nil
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Nyheim99/WASAText/service/blobstore"
+	"github.com/Nyheim99/WASAText/service/database"
+	"github.com/Nyheim99/WASAText/service/globaltime"
+)
+
+var errNotABackup = errors.New("not a backup")
+
+// runRestore replaces the database with the one in the backup at input, and adds its media to the media directory.
+// Nothing is changed until the whole backup has been read and verified, and while the database is in use.
+func runRestore(cfg AdminConfiguration, input string) error {
+	if cfg.DB.Driver != database.DriverSQLite {
+		return fmt.Errorf("%w: use the tools of the database instead", database.ErrBackupNotSupported)
+	}
+
+	// Fail early if the server is running, and check again right before the database is replaced
+	if _, err := os.Stat(cfg.DB.Filename); err == nil {
+		if err := checkNotInUse(cfg.DB.Filename); err != nil {
+			return err
+		}
+	}
+
+	// Unpack next to the database, so that the restored one can be renamed into place
+	staging, err := os.MkdirTemp(filepath.Dir(cfg.DB.Filename), ".wasatext-restore-*")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.RemoveAll(staging) }()
+
+	m, media, err := unpackBackup(input, staging)
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", input, err)
+	}
+	fmt.Printf("restoring the backup of %s: schema version %d, %d media files\n", //nolint:forbidigo
+		m.CreatedAt.Format("2006-01-02 15:04:05 UTC"), m.SchemaVersion, len(media))
+
+	restored := filepath.Join(staging, databaseEntry)
+	if err := withSQLite(restored, func(db *sql.DB) error {
+		status, err := database.CheckIntegrity(context.Background(), db, cfg.DB.Driver)
+		if err != nil {
+			return err
+		}
+		if version := schemaVersion(status); version != m.SchemaVersion {
+			return fmt.Errorf("database has schema version %d, the manifest says %d", version, m.SchemaVersion)
+		}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("checking the database of the backup: %w", err)
+	}
+
+	// Media are added first: blobs which are already there are kept, and the current database never references the
+	// ones which are not
+	if len(media) > 0 {
+		blobs, err := openBlobStore(cfg)
+		if err != nil {
+			return err
+		}
+		for _, key := range media {
+			if err := restoreBlob(blobs, filepath.Join(staging, "media", key)); err != nil {
+				return fmt.Errorf("restoring media %s: %w", key, err)
+			}
+		}
+	}
+
+	// Keep the current database, with its journal files, under a new name
+	replaced := ""
+	if _, err := os.Stat(cfg.DB.Filename); err == nil {
+		if err := checkNotInUse(cfg.DB.Filename); err != nil {
+			return err
+		}
+		replaced = replacedName(cfg.DB.Filename)
+	}
+	if err := replaceDatabase(cfg.DB.Filename, restored, replaced); err != nil {
+		return err
+	}
+	if replaced != "" {
+		fmt.Printf("the replaced database is %s\n", replaced) //nolint:forbidigo
+	}
+
+	fmt.Printf("restored %s\n", cfg.DB.Filename) //nolint:forbidigo
+	return nil
+}
+
+// checkNotInUse returns an error if another process has the SQLite database at filename open. It takes an exclusive
+// lock on the database in exclusive locking mode, which fails in WAL mode, as the web API uses by default, whenever
+// another connection has the database open, even idle: a plain BEGIN EXCLUSIVE isn't enough, as in WAL mode it doesn't
+// conflict with readers. With the other journal modes idle connections hold no lock, which is why the server must be
+// stopped first.
+func checkNotInUse(filename string) error {
+	dataSource, err := database.SQLiteDataSource(filename, database.SQLiteOptions{})
+	if err != nil {
+		return err
+	}
+	db, err := sql.Open(database.DriverSQLite, dataSource)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	c, err := db.Conn(ctx)
+	if err == nil {
+		defer c.Close()
+		_, err = c.ExecContext(ctx, `PRAGMA locking_mode = EXCLUSIVE`)
+	}
+	if err == nil {
+		_, err = c.ExecContext(ctx, `BEGIN EXCLUSIVE`)
+	}
+	if err == nil {
+		_, err = c.ExecContext(ctx, `COMMIT`)
+	}
+	if err != nil {
+		return fmt.Errorf("%s is in use, stop the server first: %w", filename, err)
+	}
+	return nil
+}
+
+// replacedName returns a name, which no file has yet, to keep the database at filename under when it is replaced. The
+// name has the time of the restore, and a number when there was another restore in the same second.
+func replacedName(filename string) string {
+	base := filename + ".replaced-" + globaltime.Now().UTC().Format("20060102T150405Z")
+	name := base
+	for n := 2; exists(name, "", "-wal", "-shm"); n++ {
+		name = fmt.Sprintf("%s-%d", base, n)
+	}
+	return name
+}
+
+// exists reports whether there is a file at any of the paths made of path and a suffix
+func exists(path string, suffixes ...string) bool {
+	for _, suffix := range suffixes {
+		if _, err := os.Lstat(path + suffix); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// replaceDatabase moves the database at filename, with its journal files, to replaced, and then the database at
+// restored to filename. If replaced is empty there is no database at filename yet. Files already at replaced are never
+// overwritten. When a move fails, the ones already made are undone, so that the current database is left in place.
+func replaceDatabase(filename string, restored string, replaced string) error {
+	if replaced != "" && exists(replaced, "", "-wal", "-shm") {
+		return fmt.Errorf("%s already exists", replaced)
+	}
+
+	type move struct{ from, to string }
+	var moved []move
+	rename := func(from, to string) error {
+		if err := os.Rename(from, to); err != nil {
+			return err
+		}
+		moved = append(moved, move{from, to})
+		return nil
+	}
+	undo := func() {
+		for i := len(moved) - 1; i >= 0; i-- {
+			if err := os.Rename(moved[i].to, moved[i].from); err != nil {
+				_, _ = fmt.Fprintf(os.Stderr, "can't move %s back to %s: %v\n", moved[i].to, moved[i].from, err)
+			}
+		}
+	}
+
+	if replaced != "" {
+		for _, suffix := range []string{"", "-wal", "-shm"} {
+			err := rename(filename+suffix, replaced+suffix)
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				undo()
+				return fmt.Errorf("moving the current database: %w", err)
+			}
+		}
+	}
+	if err := rename(restored, filename); err != nil {
+		undo()
+		return fmt.Errorf("moving the restored database: %w", err)
+	}
+	return nil
+}
+
+// unpackBackup extracts the backup at input into dir, checking every media file against its key. It returns the
+// manifest and the keys of the media.
+func unpackBackup(input string, dir string) (manifest, []string, error) {
+	var m manifest
+	var media []string
+
+	f, err := os.Open(input)
+	if err != nil {
+		return m, nil, err
+	}
+	defer f.Close()
+
+	// Backups may or may not be compressed
+	var r io.Reader = bufio.NewReader(f)
+	if magic, err := r.(*bufio.Reader).Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return m, nil, err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	if err := os.Mkdir(filepath.Join(dir, "media"), 0o750); err != nil {
+		return m, nil, err
+	}
+
+	var hasDatabase, hasManifest bool
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return m, nil, fmt.Errorf("%w: %v", errNotABackup, err)
+		}
+
+		switch {
+		case hdr.Typeflag == tar.TypeDir:
+			// Backups have none, but archives which were unpacked and packed again might
+
+		case hdr.Name == databaseEntry:
+			if _, err := extractEntry(tr, filepath.Join(dir, databaseEntry)); err != nil {
+				return m, nil, err
+			}
+			hasDatabase = true
+
+		case hdr.Name == manifestEntry:
+			if err := json.NewDecoder(tr).Decode(&m); err != nil {
+				return m, nil, fmt.Errorf("reading manifest: %w", err)
+			}
+			hasManifest = true
+
+		case strings.HasPrefix(hdr.Name, mediaPrefix):
+			key := strings.TrimPrefix(hdr.Name, mediaPrefix)
+			if !blobstore.ValidKey(key) {
+				return m, nil, fmt.Errorf("%w: unexpected entry %q", errNotABackup, hdr.Name)
+			}
+			hash, err := extractEntry(tr, filepath.Join(dir, "media", key))
+			if err != nil {
+				return m, nil, err
+			}
+			if hash != key {
+				return m, nil, fmt.Errorf("media %s is corrupted", key)
+			}
+			media = append(media, key)
+
+		default:
+			return m, nil, fmt.Errorf("%w: unexpected entry %q", errNotABackup, hdr.Name)
+		}
+	}
+
+	if !hasDatabase || !hasManifest {
+		return m, nil, fmt.Errorf("%w: the database or the manifest is missing", errNotABackup)
+	}
+	if len(media) != m.Media {
+		return m, nil, fmt.Errorf("backup has %d media files, the manifest says %d", len(media), m.Media)
+	}
+	return m, media, nil
+}
+
+// extractEntry writes the current entry of tr to the file at path, and returns the hex-encoded SHA-256 of its content
+func extractEntry(tr *tar.Reader, path string) (string, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(f, hash), tr); err != nil {
+		return "", fmt.Errorf("extracting %s: %w", filepath.Base(path), err)
+	}
+	if err := f.Close(); err != nil {
+		return "", fmt.Errorf("extracting %s: %w", filepath.Base(path), err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// restoreBlob adds the file at path to the blob store
+func restoreBlob(blobs blobstore.Store, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = blobs.Put(f)
+	return err
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Nyheim99/WASAText/service/globaltime"
+)
+
+type entry struct {
+	name    string
+	content []byte
+}
+
+// readArchive returns the entries of an uncompressed backup
+func readArchive(t *testing.T, path string) []entry {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var entries []entry
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return entries
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, entry{hdr.Name, content})
+	}
+}
+
+// writeArchive writes entries to a new uncompressed archive at path
+func writeArchive(t *testing.T, path string, entries []entry) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	tw := tar.NewWriter(f)
+	for _, e := range entries {
+		if err := tw.WriteHeader(&tar.Header{Name: e.name, Mode: 0o600, Size: int64(len(e.content))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(e.content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newBackup writes an uncompressed backup of a new installation with a note and a media file, and returns the
+// configuration of the installation, with another note, and the entries of the backup
+func newBackup(t *testing.T) (AdminConfiguration, []entry) {
+	t.Helper()
+	cfg := newInstallation(t, false)
+	addNote(t, cfg.DB.Filename, "backed up")
+	putBlob(t, cfg, "photo")
+
+	output := filepath.Join(t.TempDir(), "backup.tar")
+	if err := runBackup(cfg, output); err != nil {
+		t.Fatal(err)
+	}
+	addNote(t, cfg.DB.Filename, "current")
+	return cfg, readArchive(t, output)
+}
+
+// checkNotRestored fails the test if the database of the installation was replaced
+func checkNotRestored(t *testing.T, cfg AdminConfiguration) {
+	t.Helper()
+	if got := notes(t, cfg.DB.Filename); got != "backed up,current" {
+		t.Errorf("database has notes %q after a failed restore", got)
+	}
+	if matches, _ := filepath.Glob(cfg.DB.Filename + ".replaced-*"); len(matches) > 0 {
+		t.Errorf("database was moved to %v", matches)
+	}
+}
+
+func TestRestoreInvalidBackup(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(entries []entry) []entry
+		want   string
+	}{
+		{"media corrupted", func(entries []entry) []entry {
+			for i := range entries {
+				if strings.HasPrefix(entries[i].name, mediaPrefix) {
+					entries[i].content = []byte("tampered")
+				}
+			}
+			return entries
+		}, "is corrupted"},
+		{"media missing", func(entries []entry) []entry {
+			var kept []entry
+			for _, e := range entries {
+				if !strings.HasPrefix(e.name, mediaPrefix) {
+					kept = append(kept, e)
+				}
+			}
+			return kept
+		}, "the manifest says 1"},
+		{"manifest missing", func(entries []entry) []entry {
+			return entries[:len(entries)-1]
+		}, "the database or the manifest is missing"},
+		{"unexpected entry", func(entries []entry) []entry {
+			return append(entries, entry{"../wasatext.db", []byte("evil")})
+		}, "unexpected entry"},
+		{"schema version", func(entries []entry) []entry {
+			for i := range entries {
+				if entries[i].name == manifestEntry {
+					var m manifest
+					_ = json.Unmarshal(entries[i].content, &m)
+					m.SchemaVersion = 3
+					entries[i].content, _ = json.Marshal(m)
+				}
+			}
+			return entries
+		}, "the manifest says 3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, entries := newBackup(t)
+			input := filepath.Join(t.TempDir(), "changed.tar")
+			writeArchive(t, input, tt.change(entries))
+
+			err := runRestore(cfg, input)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got error %v, want %q", err, tt.want)
+			}
+			checkNotRestored(t, cfg)
+		})
+	}
+
+	t.Run("not an archive", func(t *testing.T) {
+		cfg, _ := newBackup(t)
+		input := filepath.Join(t.TempDir(), "notes.txt")
+		writeFile(t, input, strings.Repeat("not a backup\n", 100))
+
+		if err := runRestore(cfg, input); !errors.Is(err, errNotABackup) {
+			t.Errorf("got error %v, want errNotABackup", err)
+		}
+		checkNotRestored(t, cfg)
+	})
+}
+
+func TestCheckNotInUse(t *testing.T) {
+	cfg, entries := newBackup(t)
+	input := filepath.Join(t.TempDir(), "backup.tar")
+	writeArchive(t, input, entries)
+
+	//An idle connection, like the ones of the server between requests
+	db := openWAL(t, cfg.DB.Filename)
+	if err := db.Ping(); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkNotInUse(cfg.DB.Filename); err == nil {
+		t.Error("database in use wasn't detected")
+	}
+	if err := runRestore(cfg, input); err == nil || !strings.Contains(err.Error(), "stop the server") {
+		t.Errorf("restore while the database is in use returned %v", err)
+	}
+	checkNotRestored(t, cfg)
+
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkNotInUse(cfg.DB.Filename); err != nil {
+		t.Errorf("database not in use is reported in use: %v", err)
+	}
+}
+
+func TestReplaceDatabaseUndo(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "wasatext.db")
+	replaced := filename + ".replaced"
+	writeFile(t, filename, "current")
+	writeFile(t, filename+"-wal", "current journal")
+
+	//The current database is moved away, and then the restored one can't be moved in
+	err := replaceDatabase(filename, filepath.Join(dir, "missing.db"), replaced)
+	if err == nil {
+		t.Fatal("replaced the database with a missing one")
+	}
+	checkFile(t, filename, "current")
+	checkFile(t, filename+"-wal", "current journal")
+	if exists(replaced, "", "-wal", "-shm") {
+		t.Error("the current database was left at the replaced name")
+	}
+}
+
+// writeFile creates the file at path with content
+func writeFile(t *testing.T, path string, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// checkFile fails the test if the file at path doesn't have content
+func checkFile(t *testing.T, path string, content string) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != content {
+		t.Errorf("%s has %q, want %q", filepath.Base(path), data, content)
+	}
+}
+
+func TestReplacedName(t *testing.T) {
+	globaltime.FixedTime = time.Date(2024, 2, 2, 15, 4, 5, 0, time.UTC)
+	defer func() { globaltime.FixedTime = time.Time{} }()
+
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "wasatext.db")
+	first := replacedName(filename)
+	if first != filename+".replaced-20240202T150405Z" {
+		t.Errorf("replaced database is called %s", filepath.Base(first))
+	}
+
+	//A restore in the same second gets another name, even if only a journal file of the first one is left
+	writeFile(t, first+"-wal", "first journal")
+	if second := replacedName(filename); second != first+"-2" {
+		t.Errorf("second replaced database is called %s, want %s", filepath.Base(second), filepath.Base(first+"-2"))
+	}
+
+	//Files already there are never overwritten
+	restored := filepath.Join(dir, "restored.db")
+	writeFile(t, filename, "current")
+	writeFile(t, restored, "restored")
+	if err := replaceDatabase(filename, restored, first); err == nil {
+		t.Error("replaced the database over an existing one")
+	}
+	checkFile(t, filename, "current")
+	checkFile(t, first+"-wal", "first journal")
+}
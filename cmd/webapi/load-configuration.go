@@ -25,8 +25,49 @@ type WebAPIConfiguration struct {
 	}
 	Debug bool
 	DB    struct {
-		Filename string `conf:"default:/tmp/wasatext.db"`
+		Driver       string        `conf:"default:sqlite3,help:sqlite3 or postgres"`
+		Filename     string        `conf:"default:/tmp/wasatext.db,help:database file (sqlite3)"`
+		DataSource   string        `conf:"mask,help:connection string (postgres)"`
+		AutoMigrate  bool          `conf:"default:true,help:apply pending migrations at startup"`
+		QueryTimeout time.Duration `conf:"default:3s,help:maximum duration of a single database operation (0 for no limit)"`
+
+		MaxOpenConns    int           `conf:"default:10,help:maximum number of open connections (0 for no limit)"`
+		MaxIdleConns    int           `conf:"default:5,help:maximum number of idle connections kept open"`
+		ConnMaxLifetime time.Duration `conf:"default:1h,help:connections are closed after this long (0 to keep them)"`
+		ConnMaxIdleTime time.Duration `conf:"default:10m,help:idle connections are closed after this long"`
+
+		// Sqlite rather than SQLite, which would be split in sq-lite for flags and environment variables
+		Sqlite struct {
+			ForeignKeys bool          `conf:"default:true"`
+			JournalMode string        `conf:"default:WAL,help:DELETE/TRUNCATE/PERSIST/MEMORY/WAL/OFF"`
+			BusyTimeout time.Duration `conf:"default:5s,help:how long to wait for a lock held by another connection"`
+			Synchronous string        `conf:"default:NORMAL,help:OFF/NORMAL/FULL/EXTRA"`
+		}
+	}
+	Storage struct {
+		Backend      string `conf:"default:filesystem,help:filesystem or s3"`
+		Directory    string `conf:"default:/tmp/wasatext-media"`
+		LegacyPhotos string `conf:"default:service/photos,help:directory of the photo files of the first version; imported at startup"`
+		ObjectStore  struct {
+			Endpoint        string
+			Region          string `conf:"default:us-east-1"`
+			Bucket          string
+			AccessKeyID     string
+			SecretAccessKey string        `conf:"mask"`
+			PathStyle       bool          `conf:"default:false"`
+			PresignExpiry   time.Duration `conf:"default:15m"`
+		}
+	}
+	Session struct {
+		Lifetime time.Duration `conf:"default:720h"`
 	}
+	Messages struct {
+		EditWindow   time.Duration `conf:"default:15m"`
+		DeleteWindow time.Duration `conf:"default:48h"`
+	}
+
+	// Args holds the command, if any: see runMigrateCommand
+	Args conf.Args
 }
 
 // loadConfiguration creates a WebAPIConfiguration starting from flags, environment variables and configuration file.
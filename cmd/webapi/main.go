@@ -4,13 +4,14 @@ package main
 
 import (
 	"context"
-	"database/sql"
 	"errors"
 	"fmt"
 	"github.com/Nyheim99/WASAText/service/api"
+	"github.com/Nyheim99/WASAText/service/blobstore"
 	"github.com/Nyheim99/WASAText/service/database"
 	"github.com/Nyheim99/WASAText/service/globaltime"
 	"github.com/ardanlabs/conf"
+	_ "github.com/lib/pq"
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/sirupsen/logrus"
 	"math/rand"
@@ -61,21 +62,67 @@ func run() error {
 
 	// Start Database
 	logger.Println("initializing database")
-	dbconn, err := sql.Open("sqlite3", cfg.DB.Filename)
+	dbconn, err := openDatabase(cfg, logger)
 	if err != nil {
-		logger.WithError(err).Error("error opening SQLite DB")
-		return fmt.Errorf("opening SQLite: %w", err)
+		logger.WithError(err).Errorf("error opening %s DB", cfg.DB.Driver)
+		return fmt.Errorf("opening %s: %w", cfg.DB.Driver, err)
 	}
 	defer func() {
 		logger.Debug("database stopping")
 		_ = dbconn.Close()
 	}()
-	db, err := database.New(dbconn)
+
+	// Run the migrate command instead of the server, if requested
+	if cfg.Args.Num(0) == "migrate" {
+		return runMigrateCommand(dbconn, cfg.DB.Driver, cfg.Args[1:])
+	} else if len(cfg.Args) > 0 {
+		return fmt.Errorf("unknown command %q", cfg.Args.Num(0))
+	}
+
+	if cfg.DB.AutoMigrate {
+		applied, err := database.Migrate(dbconn, cfg.DB.Driver)
+		if err != nil {
+			logger.WithError(err).Error("error migrating the database")
+			return fmt.Errorf("migrating the database: %w", err)
+		}
+		for _, m := range applied {
+			logger.Infof("applied migration %d_%s", m.Version, m.Name)
+		}
+	}
+
+	db, err := database.New(dbconn, database.Config{
+		Driver:       cfg.DB.Driver,
+		QueryTimeout: cfg.DB.QueryTimeout,
+	})
 	if err != nil {
 		logger.WithError(err).Error("error creating AppDatabase")
 		return fmt.Errorf("creating AppDatabase: %w", err)
 	}
 
+	// Start media storage
+	logger.Printf("initializing %s blob store", cfg.Storage.Backend)
+	var blobs blobstore.Store
+	switch cfg.Storage.Backend {
+	case "filesystem":
+		blobs, err = blobstore.NewFilesystem(cfg.Storage.Directory)
+	case "s3":
+		blobs, err = blobstore.NewS3(blobstore.S3Config{
+			Endpoint:        cfg.Storage.ObjectStore.Endpoint,
+			Region:          cfg.Storage.ObjectStore.Region,
+			Bucket:          cfg.Storage.ObjectStore.Bucket,
+			AccessKeyID:     cfg.Storage.ObjectStore.AccessKeyID,
+			SecretAccessKey: cfg.Storage.ObjectStore.SecretAccessKey,
+			PathStyle:       cfg.Storage.ObjectStore.PathStyle,
+			PresignExpiry:   cfg.Storage.ObjectStore.PresignExpiry,
+		})
+	default:
+		err = fmt.Errorf("unknown storage backend %q", cfg.Storage.Backend)
+	}
+	if err != nil {
+		logger.WithError(err).Error("error creating blob store")
+		return fmt.Errorf("creating blob store: %w", err)
+	}
+
 	// Start (main) API server
 	logger.Info("initializing API server")
 
@@ -90,13 +137,24 @@ func run() error {
 
 	// Create the API router
 	apirouter, err := api.New(api.Config{
-		Logger:   logger,
-		Database: db,
+		Logger:              logger,
+		Database:            db,
+		Blobs:               blobs,
+		SessionLifetime:     cfg.Session.Lifetime,
+		MessageEditWindow:   cfg.Messages.EditWindow,
+		MessageDeleteWindow: cfg.Messages.DeleteWindow,
 	})
 	if err != nil {
 		logger.WithError(err).Error("error creating the API server instance")
 		return fmt.Errorf("creating the API server instance: %w", err)
 	}
+
+	// Move the media saved by the first version of the application to the blob store
+	if err := apirouter.ImportLegacyMedia(context.Background(), cfg.Storage.LegacyPhotos); err != nil {
+		logger.WithError(err).Error("error importing legacy media")
+		return fmt.Errorf("importing legacy media: %w", err)
+	}
+
 	router := apirouter.Handler()
 
 	router, err = registerWebUI(router)
@@ -133,23 +191,23 @@ func run() error {
 	case sig := <-shutdown:
 		logger.Infof("signal %v received, start shutdown", sig)
 
-		// Asking API server to shut down and load shed.
-		err := apirouter.Close()
-		if err != nil {
-			logger.WithError(err).Warning("graceful shutdown of apirouter error")
-		}
-
 		// Give outstanding requests a deadline for completion.
 		ctx, cancel := context.WithTimeout(context.Background(), cfg.Web.ShutdownTimeout)
 		defer cancel()
 
 		// Asking listener to shut down and load shed.
-		err = apiserver.Shutdown(ctx)
+		err := apiserver.Shutdown(ctx)
 		if err != nil {
 			logger.WithError(err).Warning("error during graceful shutdown of HTTP server")
 			err = apiserver.Close()
 		}
 
+		// Asking API server to shut down, once the requests have published their events. The event streams are not
+		// waited for by Shutdown, and end here.
+		if rerr := apirouter.Close(); rerr != nil {
+			logger.WithError(rerr).Warning("graceful shutdown of apirouter error")
+		}
+
 		// Log the status of this shutdown.
 		switch {
 		case sig == syscall.SIGSTOP:
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/Nyheim99/WASAText/service/database"
+)
+
+// runMigrateCommand manages the database schema, instead of starting the server. Usage:
+//
+//	webapi migrate [up]            apply all the pending migrations
+//	webapi migrate status          list the migrations, and when they were applied
+//	webapi migrate rollback [n]    revert the last n applied migrations (default 1)
+func runMigrateCommand(db *sql.DB, driver string, args []string) error {
+	command := "up"
+	if len(args) > 0 {
+		command = args[0]
+	}
+
+	switch command {
+	case "up":
+		applied, err := database.Migrate(db, driver)
+		for _, m := range applied {
+			fmt.Printf("applied %d_%s\n", m.Version, m.Name) //nolint:forbidigo
+		}
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			fmt.Println("database is up to date") //nolint:forbidigo
+		}
+		return nil
+
+	case "status":
+		status, err := database.GetMigrationStatus(db, driver)
+		if err != nil && !errors.Is(err, database.ErrUnknownMigration) {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, m := range status {
+			appliedAt := "pending"
+			if m.AppliedAt != nil {
+				appliedAt = m.AppliedAt.Format("2006-01-02 15:04:05 UTC")
+			}
+			_, _ = fmt.Fprintf(w, "%d\t%s\t%s\n", m.Version, m.Name, appliedAt)
+		}
+		_ = w.Flush()
+		return err
+
+	case "rollback":
+		steps := 1
+		if len(args) > 1 {
+			var err error
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				return fmt.Errorf("invalid number of migrations to roll back: %q", args[1])
+			}
+		}
+		reverted, err := database.Rollback(db, driver, steps)
+		for _, m := range reverted {
+			fmt.Printf("reverted %d_%s\n", m.Version, m.Name) //nolint:forbidigo
+		}
+		return err
+
+	default:
+		return fmt.Errorf("unknown migrate command %q, expected up, status or rollback", command)
+	}
+}
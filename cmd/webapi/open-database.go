@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/Nyheim99/WASAText/service/database"
+	"github.com/sirupsen/logrus"
+)
+
+// openDatabase opens the connection pool to the database in the configuration, and reports the settings in effect.
+// Settings of SQLite connections which differ from the requested ones are logged as warnings: for example an in-memory
+// database can't use WAL journaling.
+func openDatabase(cfg WebAPIConfiguration, logger *logrus.Logger) (*sql.DB, error) {
+	dataSource := cfg.DB.DataSource
+	if cfg.DB.Driver == database.DriverSQLite {
+		requested := database.SQLiteOptions{
+			ForeignKeys: cfg.DB.Sqlite.ForeignKeys,
+			JournalMode: cfg.DB.Sqlite.JournalMode,
+			BusyTimeout: cfg.DB.Sqlite.BusyTimeout,
+			Synchronous: cfg.DB.Sqlite.Synchronous,
+		}
+		var err error
+		dataSource, err = database.SQLiteDataSource(cfg.DB.Filename, requested)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	db, err := sql.Open(cfg.DB.Driver, dataSource)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(cfg.DB.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.DB.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.DB.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(cfg.DB.ConnMaxIdleTime)
+
+	// The startup checks are bounded by the query timeout like any other operation, when there is one
+	ctx, cancel := context.WithCancel(context.Background())
+	if cfg.DB.QueryTimeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), cfg.DB.QueryTimeout)
+	}
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("connecting: %w", err)
+	}
+
+	logger.Infof("database pool: max open connections %d, max idle connections %d, max lifetime %s, max idle time %s",
+		cfg.DB.MaxOpenConns, cfg.DB.MaxIdleConns, cfg.DB.ConnMaxLifetime, cfg.DB.ConnMaxIdleTime)
+
+	if cfg.DB.Driver == database.DriverSQLite {
+		effective, err := database.GetSQLiteSettings(ctx, db)
+		if err != nil {
+			_ = db.Close()
+			return nil, fmt.Errorf("reading SQLite settings: %w", err)
+		}
+		logger.Infof("sqlite: foreign keys %t, journal mode %s, busy timeout %s, synchronous %s",
+			effective.ForeignKeys, effective.JournalMode, effective.BusyTimeout, effective.Synchronous)
+
+		if effective.ForeignKeys != cfg.DB.Sqlite.ForeignKeys {
+			logger.Warnf("sqlite: foreign keys are %t, %t was requested", effective.ForeignKeys, cfg.DB.Sqlite.ForeignKeys)
+		}
+		if !strings.EqualFold(effective.JournalMode, cfg.DB.Sqlite.JournalMode) {
+			logger.Warnf("sqlite: journal mode is %s, %s was requested", effective.JournalMode, cfg.DB.Sqlite.JournalMode)
+		}
+		if !strings.EqualFold(effective.Synchronous, cfg.DB.Sqlite.Synchronous) {
+			logger.Warnf("sqlite: synchronous is %s, %s was requested", effective.Synchronous, cfg.DB.Sqlite.Synchronous)
+		}
+
+		if err := database.CheckSQLiteFTS5(ctx, db); err != nil {
+			_ = db.Close()
+			return nil, err
+		}
+	}
+
+	return db, nil
+}
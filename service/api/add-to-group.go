@@ -5,7 +5,6 @@ import (
 	"net/http"
 	"strconv"
 
-	"github.com/Nyheim99/WASAText/service/api/reqcontext"
 	"github.com/julienschmidt/httprouter"
 )
 
@@ -22,14 +21,6 @@ func (rt *_router) addToGroup(w http.ResponseWriter, r *http.Request, ps httprou
 		http.Error(w, "Invalid request", http.StatusBadRequest)
 		return
 	}
-	
-	//Fetch user from context
-	reqCtx, ok := r.Context().Value("reqCtx").(*reqcontext.RequestContext)
-	if !ok || reqCtx == nil {
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return
-	}
-	UserID := reqCtx.UserID
 
 	//Validate request
 	var request AddToGroupRequest
@@ -42,7 +33,7 @@ func (rt *_router) addToGroup(w http.ResponseWriter, r *http.Request, ps httprou
 		return
 	}
 
-	conversation, err := rt.db.GetConversation(conversationID)
+	conversation, err := rt.db.GetConversation(r.Context(), conversationID)
 	if err != nil {
 		http.Error(w, "Conversation not found", http.StatusNotFound)
 		return
@@ -52,22 +43,8 @@ func (rt *_router) addToGroup(w http.ResponseWriter, r *http.Request, ps httprou
 		return
 	}
 
-	//Check that request sender is part of the group
-	isMember := false
-	for _, participant := range conversation.Participants {
-		if participant.ID == UserID {
-			isMember = true
-			break
-		}
-	}
-
-	if !isMember {
-		http.Error(w, "User is not a member of the conversation", http.StatusForbidden)
-		return
-	}
-
 	//Add new user(s) to the group
-	err = rt.db.AddToGroup(conversationID, request.Participants)
+	err = rt.db.AddToGroup(r.Context(), conversationID, request.Participants)
 	if err != nil {
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
@@ -0,0 +1,191 @@
+package api
+
+import (
+	"context"
+
+	"github.com/Nyheim99/WASAText/service/database"
+	"github.com/Nyheim99/WASAText/service/eventbus"
+	"github.com/Nyheim99/WASAText/service/presence"
+	"github.com/Nyheim99/WASAText/service/realtime"
+	"github.com/sirupsen/logrus"
+)
+
+// Data of the real-time events, see realtime.Event
+
+type messageEventData struct {
+	MessageID int64 `json:"message_id"`
+	SenderID  int64 `json:"sender_id,omitempty"`
+}
+
+type threadEventData struct {
+	ThreadRootID int64 `json:"thread_root_id"`
+	MessageID    int64 `json:"message_id"`
+	Deleted      bool  `json:"deleted,omitempty"`
+}
+
+type reactionEventData struct {
+	MessageID int64 `json:"message_id"`
+	UserID    int64 `json:"user_id"`
+
+	// Emoticon is empty when the reaction was removed
+	Emoticon string `json:"emoticon"`
+}
+
+type messagesReadEventData struct {
+	UserID int64 `json:"user_id"`
+
+	// UpTo is the last message read, zero when the user read all of them
+	UpTo int64 `json:"up_to,omitempty"`
+}
+
+type messagesDeliveredEventData struct {
+	UserID     int64   `json:"user_id"`
+	MessageIDs []int64 `json:"message_ids"`
+}
+
+type membersEventData struct {
+	UserIDs []int64 `json:"user_ids"`
+}
+
+type groupRenamedEventData struct {
+	Name string `json:"name"`
+}
+
+type typingEventData struct {
+	UserID int64 `json:"user_id"`
+}
+
+type presenceEventData struct {
+	UserID int64 `json:"user_id"`
+	presence.Presence
+}
+
+// relayEvent passes the domain events of the bus on to the clients of the participants, as real-time events
+func (rt *_router) relayEvent(ctx context.Context, event eventbus.Event) {
+	var eventType string
+	var data interface{}
+	var also []int64
+	switch e := event.(type) {
+	case eventbus.MessageSent:
+		eventType, data = realtime.EventMessageCreated, messageEventData{MessageID: e.MessageID, SenderID: e.SenderID}
+	case eventbus.MessageDeleted:
+		eventType, data = realtime.EventMessageDeleted, messageEventData{MessageID: e.MessageID, SenderID: e.UserID}
+	case eventbus.MessageHidden:
+		//Only the clients of who hid the message have to drop it
+		rt.events.Publish([]int64{e.UserID}, realtime.Event{
+			Type:           realtime.EventMessageHidden,
+			ConversationID: e.ConversationID,
+			Data:           messageEventData{MessageID: e.MessageID},
+		})
+		return
+	case eventbus.MessageEdited:
+		eventType, data = realtime.EventMessageEdited, messageEventData{MessageID: e.MessageID, SenderID: e.UserID}
+	case eventbus.ReactionSet:
+		eventType, data = realtime.EventReactionChanged, reactionEventData{MessageID: e.MessageID, UserID: e.UserID, Emoticon: e.Emoticon}
+	case eventbus.ReactionRemoved:
+		eventType, data = realtime.EventReactionChanged, reactionEventData{MessageID: e.MessageID, UserID: e.UserID}
+	case eventbus.MessagesRead:
+		eventType, data = realtime.EventMessagesRead, messagesReadEventData{UserID: e.UserID, UpTo: e.UpTo}
+	case eventbus.MessagesDelivered:
+		eventType, data = realtime.EventMessagesDelivered, messagesDeliveredEventData{UserID: e.UserID, MessageIDs: e.MessageIDs}
+	case eventbus.MembersAdded:
+		eventType, data = realtime.EventMemberAdded, membersEventData{UserIDs: e.UserIDs}
+	case eventbus.MemberLeft:
+		//Who left is no longer a participant, but their clients must know
+		eventType, data = realtime.EventMemberLeft, membersEventData{UserIDs: []int64{e.UserID}}
+		also = []int64{e.UserID}
+	case eventbus.GroupRenamed:
+		eventType, data = realtime.EventGroupRenamed, groupRenamedEventData{Name: e.Name}
+	default:
+		return
+	}
+
+	//The change has already been saved, so a failure can only be logged
+	participantIDs, err := rt.db.GetParticipantIDs(ctx, event.Conversation())
+	if err != nil {
+		rt.baseLogger.WithError(err).WithField("event", eventType).Warn("can't publish event")
+		return
+	}
+
+	rt.events.Publish(append(participantIDs, also...), realtime.Event{
+		Type:           eventType,
+		ConversationID: event.Conversation(),
+		Data:           data,
+	})
+
+	//Replies sent or deleted are also activity in their thread
+	var thread *threadEventData
+	switch e := event.(type) {
+	case eventbus.MessageSent:
+		if e.ThreadRootID > 0 {
+			thread = &threadEventData{ThreadRootID: e.ThreadRootID, MessageID: e.MessageID}
+		}
+	case eventbus.MessageDeleted:
+		if e.ThreadRootID > 0 {
+			thread = &threadEventData{ThreadRootID: e.ThreadRootID, MessageID: e.MessageID, Deleted: true}
+		}
+	}
+	if thread != nil {
+		rt.events.Publish(participantIDs, realtime.Event{
+			Type:           realtime.EventThreadUpdated,
+			ConversationID: event.Conversation(),
+			Data:           thread,
+		})
+	}
+}
+
+// relayPresence tells the users who share a conversation with a user, and the user's other clients, that their
+// presence changed
+func (rt *_router) relayPresence(userID int64, p presence.Presence) {
+	contactIDs, err := rt.db.GetContactIDs(context.Background(), userID)
+	if err != nil {
+		rt.baseLogger.WithError(err).WithField("event", realtime.EventPresence).Warn("can't publish event")
+		return
+	}
+
+	rt.events.Publish(append(contactIDs, userID), realtime.Event{
+		Type: realtime.EventPresence,
+		Data: presenceEventData{UserID: userID, Presence: p},
+	})
+}
+
+// publishTyping tells the other participants of a conversation that the user is typing. Nothing is saved, and the
+// participants stop showing it after a few seconds without a new signal.
+func (rt *_router) publishTyping(ctx context.Context, conversationID int64, userID int64) error {
+	participantIDs, err := rt.db.GetParticipantIDs(ctx, conversationID)
+	if err != nil {
+		return err
+	}
+
+	others := participantIDs[:0]
+	for _, participantID := range participantIDs {
+		if participantID != userID {
+			others = append(others, participantID)
+		}
+	}
+	rt.events.Publish(others, realtime.Event{
+		Type:           realtime.EventTyping,
+		ConversationID: conversationID,
+		Data:           typingEventData{UserID: userID},
+	})
+	return nil
+}
+
+// fillPresence sets the presence of a user read from the database, which knows only the last seen time saved
+func (rt *_router) fillPresence(user *database.User) {
+	p := rt.presence.Get(user.ID, user.LastSeen)
+	user.Presence, user.LastSeen = p.Status, p.LastSeen
+}
+
+// markStreamed records that a new message was streamed to one of its recipients. The stream goes on anyway, so a
+// failure is logged rather than returned.
+func (rt *_router) markStreamed(userID int64, event realtime.Event, logger logrus.FieldLogger) {
+	data, ok := event.Data.(messageEventData)
+	if event.Type != realtime.EventMessageCreated || !ok || data.SenderID == userID {
+		return
+	}
+	_, err := rt.db.MarkMessagesDelivered(context.Background(), event.ConversationID, userID, []int64{data.MessageID})
+	if err != nil {
+		logger.WithError(err).Warn("can't mark the streamed message as delivered")
+	}
+}
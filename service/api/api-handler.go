@@ -8,6 +8,10 @@ import (
 func (rt *_router) Handler() http.Handler {
 	// Register routes
 	rt.router.POST("/session", rt.doLogin)
+	rt.router.DELETE("/session", rt.validateAuthorization(rt.doLogout))
+	rt.router.GET("/sessions", rt.validateAuthorization(rt.getMySessions))
+	rt.router.DELETE("/sessions/:sessionID", rt.validateAuthorization(rt.revokeSession))
+
 	rt.router.GET("/user", rt.validateAuthorization(rt.getUser))
 	rt.router.GET("/users", rt.validateAuthorization(rt.getUsers))
 
@@ -16,23 +20,36 @@ func (rt *_router) Handler() http.Handler {
 
 	rt.router.POST("/conversations", rt.validateAuthorization(rt.createConversation))
 	rt.router.GET("/conversations", rt.validateAuthorization(rt.getMyConversations))
+	rt.router.GET("/search/messages", rt.validateAuthorization(rt.searchMessages))
+
+	rt.router.GET("/conversations/:conversationID", rt.validateAuthorization(rt.requireParticipant(rt.getConversation)))
+
+	rt.router.PUT("/conversations/:conversationID/photo", rt.validateAuthorization(rt.requireParticipant(rt.setGroupPhoto)))
+	rt.router.PUT("/conversations/:conversationID/name", rt.validateAuthorization(rt.requireParticipant(rt.setGroupName)))
 
-	rt.router.GET("/conversations/:conversationID", rt.validateAuthorization(rt.getConversation))
+	rt.router.POST("/conversations/:conversationID/members", rt.validateAuthorization(rt.requireParticipant(rt.addToGroup)))
+	rt.router.DELETE("/conversations/:conversationID/members/me", rt.validateAuthorization(rt.requireParticipant(rt.leaveGroup)))
 
-	rt.router.PUT("/conversations/:conversationID/photo", rt.validateAuthorization(rt.setGroupPhoto))
-	rt.router.PUT("/conversations/:conversationID/name", rt.validateAuthorization(rt.setGroupName))
+	rt.router.GET("/conversations/:conversationID/messages", rt.validateAuthorization(rt.requireParticipant(rt.getMessages)))
+	rt.router.POST("/conversations/:conversationID/messages", rt.validateAuthorization(rt.requireParticipant(rt.sendMessage)))
+	rt.router.GET("/conversations/:conversationID/messages/:messageID/photo", rt.validateAuthorization(rt.requireParticipant(rt.requireMessage(rt.getMessagePhoto))))
+	rt.router.GET("/conversations/:conversationID/messages/:messageID/receipts", rt.validateAuthorization(rt.requireParticipant(rt.requireMessage(rt.getMessageReceipts))))
+	rt.router.GET("/conversations/:conversationID/messages/:messageID/history", rt.validateAuthorization(rt.requireParticipant(rt.requireMessage(rt.getMessageHistory))))
+	rt.router.GET("/conversations/:conversationID/messages/:messageID/thread", rt.validateAuthorization(rt.requireParticipant(rt.requireMessage(rt.getThread))))
+	rt.router.POST("/conversations/:conversationID/messages/:messageID/forward", rt.validateAuthorization(rt.requireParticipant(rt.forwardMessage)))
+	rt.router.PATCH("/conversations/:conversationID/messages/:messageID", rt.validateAuthorization(rt.requireParticipant(rt.requireMessage(rt.editMessage))))
+	rt.router.DELETE("/conversations/:conversationID/messages/:messageID", rt.validateAuthorization(rt.requireParticipant(rt.requireMessage(rt.deleteMessage))))
 
-	rt.router.POST("/conversations/:conversationID/members", rt.validateAuthorization(rt.addToGroup))
-	rt.router.DELETE("/conversations/:conversationID/members/me", rt.validateAuthorization(rt.leaveGroup))
+	rt.router.POST("/conversations/:conversationID/messages/:messageID/reactions", rt.validateAuthorization(rt.requireParticipant(rt.requireMessage(rt.commentMessage))))
+	rt.router.DELETE("/conversations/:conversationID/messages/:messageID/reactions/me", rt.validateAuthorization(rt.requireParticipant(rt.requireMessage(rt.uncommentMessage))))
 
-	rt.router.POST("/conversations/:conversationID/messages", rt.validateAuthorization(rt.sendMessage))
-	rt.router.POST("/conversations/:conversationID/messages/:messageID/forward", rt.validateAuthorization(rt.forwardMessage))
-	rt.router.DELETE("/conversations/:conversationID/messages/:messageID", rt.validateAuthorization(rt.deleteMessage))
+	rt.router.PUT("/conversations/:conversationID/messages/read", rt.validateAuthorization(rt.requireParticipant(rt.markMessagesAsRead)))
+	rt.router.POST("/conversations/:conversationID/typing", rt.validateAuthorization(rt.requireParticipant(rt.notifyTyping)))
 
-	rt.router.POST("/conversations/:conversationID/messages/:messageID/reactions", rt.validateAuthorization(rt.commentMessage))
-	rt.router.DELETE("/conversations/:conversationID/messages/:messageID/reactions/me", rt.validateAuthorization(rt.uncommentMessage))
+	rt.router.GET("/events", rt.acceptTokenParameter(rt.validateAuthorization(rt.getEvents)))
+	rt.router.GET("/socket", rt.acceptTokenParameter(rt.validateAuthorization(rt.getSocket)))
 
-	rt.router.PUT("/conversations/:conversationID/messages/read", rt.validateAuthorization(rt.markMessagesAsRead))
+	rt.router.GET("/media/:key", rt.getMedia)
 
 	// Special routes
 	rt.router.GET("/liveness", rt.liveness)
@@ -0,0 +1,150 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Nyheim99/WASAText/service/blobstore"
+	"github.com/Nyheim99/WASAText/service/database"
+	"github.com/Nyheim99/WASAText/service/imaging"
+)
+
+// errInvalidThumbnailSize is returned when the size requested for a photo is not one of imaging.ThumbnailSizes
+var errInvalidThumbnailSize = errors.New("invalid thumbnail size")
+
+// storeUploadedPhoto validates an uploaded photo and saves a re-encoded copy, without any metadata, in the blob store,
+// together with its thumbnails. It returns the blob key and the MIME type of the photo. Invalid photos are reported
+// with the imaging package errors.
+func (rt *_router) storeUploadedPhoto(ctx context.Context, file io.Reader) (string, string, error) {
+	img, err := imaging.Sanitize(file)
+	if err != nil {
+		return "", "", err
+	}
+
+	key, err := rt.blobs.Put(bytes.NewReader(img.Data))
+	if err != nil {
+		return "", "", fmt.Errorf("storing photo: %w", err)
+	}
+
+	//Scale each thumbnail from the previous one, which is much cheaper than starting from the full image every time
+	thumbnails := make(map[int]string, len(imaging.ThumbnailSizes))
+	source, sourceKey := img.Decoded, key
+	for _, size := range imaging.ThumbnailSizes {
+		thumbnail := imaging.Thumbnail(source, size)
+		if thumbnail != source {
+			data, err := imaging.Encode(thumbnail, img.MimeType)
+			if err != nil {
+				return "", "", err
+			}
+			sourceKey, err = rt.blobs.Put(bytes.NewReader(data))
+			if err != nil {
+				return "", "", fmt.Errorf("storing thumbnail: %w", err)
+			}
+			source = thumbnail
+		}
+
+		//Photos smaller than a thumbnail size are their own thumbnail
+		thumbnails[size] = sourceKey
+	}
+	if err = rt.db.SaveThumbnails(ctx, key, thumbnails); err != nil {
+		return "", "", err
+	}
+
+	return key, img.MimeType, nil
+}
+
+// thumbnailKey returns the key of the blob to serve for the size requested in the `size` query parameter: the key of
+// the thumbnail, or key itself when no size was requested or the photo predates thumbnails.
+func (rt *_router) thumbnailKey(r *http.Request, key string) (string, error) {
+	sizeStr := r.URL.Query().Get("size")
+	if sizeStr == "" {
+		return key, nil
+	}
+	size, err := strconv.Atoi(sizeStr)
+	if err != nil || !imaging.IsThumbnailSize(size) {
+		return "", errInvalidThumbnailSize
+	}
+
+	thumbnail, err := rt.db.GetThumbnail(r.Context(), key, size)
+	if errors.Is(err, database.ErrThumbnailNotFound) {
+		return key, nil
+	} else if err != nil {
+		return "", err
+	}
+	return thumbnail, nil
+}
+
+// photoThumbnails returns the URLs of the thumbnails of a photo served by getMedia, by size
+func photoThumbnails(photoURL string) map[string]string {
+	if !strings.HasPrefix(photoURL, "/media/") {
+		return nil
+	}
+	thumbnails := make(map[string]string, len(imaging.ThumbnailSizes))
+	for _, size := range imaging.ThumbnailSizes {
+		thumbnails[strconv.Itoa(size)] = photoURL + "?size=" + strconv.Itoa(size)
+	}
+	return thumbnails
+}
+
+// maxUploadSize is the largest accepted body of a request carrying a photo: the photo itself, and some room for the
+// other form fields and the multipart encoding
+const maxUploadSize = imaging.MaxFileSize + 1<<20
+
+// parseUploadForm parses the multipart form of a request which may carry a photo, reading at most maxUploadSize bytes
+// of its body. It replies to the request and returns false if the form can't be parsed.
+func parseUploadForm(w http.ResponseWriter, r *http.Request) bool {
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
+	err := r.ParseMultipartForm(10 << 20)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		http.Error(w, fmt.Sprintf("Request too large: photos can be at most %d MB", imaging.MaxFileSize>>20), http.StatusRequestEntityTooLarge)
+		return false
+	} else if err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// writePhotoError replies to a request whose uploaded photo couldn't be stored
+func (rt *_router) writePhotoError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, imaging.ErrUnsupportedFormat):
+		http.Error(w, "Unsupported photo: only JPEG and PNG images are allowed", http.StatusUnsupportedMediaType)
+	case errors.Is(err, imaging.ErrTooLarge):
+		http.Error(w, fmt.Sprintf("Unsupported photo: images can be at most %dx%d pixels", imaging.MaxDimension, imaging.MaxDimension), http.StatusUnsupportedMediaType)
+	case errors.Is(err, imaging.ErrFileTooLarge):
+		http.Error(w, fmt.Sprintf("Request too large: photos can be at most %d MB", imaging.MaxFileSize>>20), http.StatusRequestEntityTooLarge)
+	default:
+		rt.baseLogger.WithError(err).Error("can't store uploaded photo")
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+// mediaURL returns the URL a stored blob is publicly served from, see getMedia
+func mediaURL(key string) string {
+	return "/media/" + key
+}
+
+// redirectToPresigned replies with a redirect to a presigned download URL for the blob key
+func (rt *_router) redirectToPresigned(w http.ResponseWriter, r *http.Request, presigner blobstore.Presigner, key, contentType string) {
+	location, err := presigner.PresignGet(key, contentType)
+	if errors.Is(err, blobstore.ErrNotFound) {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		rt.baseLogger.WithError(err).Error("can't presign blob URL")
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	//The URL expires, so the redirect itself must not be cached
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, location, http.StatusFound)
+}
@@ -0,0 +1,114 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/Nyheim99/WASAText/service/api/reqcontext"
+	"github.com/Nyheim99/WASAText/service/database"
+	"github.com/julienschmidt/httprouter"
+)
+
+// requestError is a request refused for a reason the client can fix, with the HTTP status to report it with
+type requestError struct {
+	status  int
+	message string
+}
+
+func (e *requestError) Error() string {
+	return e.message
+}
+
+// checkParticipant returns a *requestError if the user is not a participant of the conversation, or if the
+// conversation doesn't exist. Other errors come from the database.
+func (rt *_router) checkParticipant(ctx context.Context, conversationID int64, userID int64) error {
+	isParticipant, err := rt.db.IsParticipant(ctx, conversationID, userID)
+	if errors.Is(err, database.ErrConversationNotFound) {
+		return &requestError{status: http.StatusNotFound, message: "Conversation not found"}
+	} else if err != nil {
+		return err
+	}
+	if !isParticipant {
+		return &requestError{status: http.StatusForbidden, message: "User is not a member of the conversation"}
+	}
+	return nil
+}
+
+// checkMessage returns a *requestError if the message doesn't exist or doesn't belong to the conversation. Other
+// errors come from the database.
+func (rt *_router) checkMessage(ctx context.Context, conversationID int64, messageID int64) error {
+	messageConversationID, err := rt.db.GetMessageConversationID(ctx, messageID)
+	if errors.Is(err, database.ErrMessageNotFound) || (err == nil && messageConversationID != conversationID) {
+		return &requestError{status: http.StatusNotFound, message: "Message not found"}
+	}
+	return err
+}
+
+// requireParticipant wraps a handler for a route under /conversations/:conversationID and only lets the request through
+// if the authenticated user is a participant of that conversation. It must be wrapped in validateAuthorization.
+func (rt *_router) requireParticipant(next httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+
+		//Get conversation ID
+		conversationID, err := strconv.ParseInt(ps.ByName("conversationID"), 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid conversation ID", http.StatusBadRequest)
+			return
+		}
+
+		//Get user ID
+		reqCtx, ok := r.Context().Value("reqCtx").(*reqcontext.RequestContext)
+		if !ok || reqCtx == nil {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		//Check that the user is a participant of the conversation
+		var reqErr *requestError
+		err = rt.checkParticipant(r.Context(), conversationID, reqCtx.UserID)
+		if errors.As(err, &reqErr) {
+			http.Error(w, reqErr.message, reqErr.status)
+			return
+		} else if err != nil {
+			reqCtx.Logger.WithError(err).Error("can't check conversation membership")
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		next(w, r, ps)
+	}
+}
+
+// requireMessage wraps a handler for a route under /conversations/:conversationID/messages/:messageID and only lets the
+// request through if the message belongs to that conversation. It must be wrapped in requireParticipant.
+func (rt *_router) requireMessage(next httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+
+		//Get conversation and message IDs
+		conversationID, err := strconv.ParseInt(ps.ByName("conversationID"), 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid conversation ID", http.StatusBadRequest)
+			return
+		}
+		messageID, err := strconv.ParseInt(ps.ByName("messageID"), 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid message ID", http.StatusBadRequest)
+			return
+		}
+
+		//Check that the message belongs to the conversation
+		var reqErr *requestError
+		err = rt.checkMessage(r.Context(), conversationID, messageID)
+		if errors.As(err, &reqErr) {
+			http.Error(w, reqErr.message, reqErr.status)
+			return
+		} else if err != nil {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		next(w, r, ps)
+	}
+}
@@ -0,0 +1,29 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+)
+
+// sessionTokenBytes is the amount of random bytes in a session token
+const sessionTokenBytes = 32
+
+// newSessionToken generates a new opaque session token. It returns the token to hand out to the client and its hash,
+// which is the only value that is stored in the database.
+func newSessionToken() (string, string, error) {
+	buf := make([]byte, sessionTokenBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", fmt.Errorf("generating session token: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+	return token, hashSessionToken(token), nil
+}
+
+// hashSessionToken returns the hash of a session token as it is stored in the database
+func hashSessionToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -7,7 +7,6 @@ import (
 	"github.com/julienschmidt/httprouter"
 	"github.com/sirupsen/logrus"
 	"net/http"
-	"strconv"
 	"strings"
 )
 
@@ -29,18 +28,36 @@ func (rt *_router) validateAuthorization(next httprouter.Handle) httprouter.Hand
 
 		//Validate the token
 		token := strings.TrimPrefix(authHeader, "Bearer ")
-		userId, err := strconv.ParseInt(token, 10, 64)
-		if err != nil {
+		if token == "" {
 			http.Error(w, "Invalid token", http.StatusUnauthorized)
 			return
 		}
 
+		//Resolve the session to its user
+		session, err := rt.db.GetSession(r.Context(), hashSessionToken(token))
+		if err != nil {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if session == nil {
+			http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
+			return
+		}
+		userId := session.UserID
+
+		//Record the session activity
+		if err := rt.db.TouchSession(r.Context(), session.ID); err != nil {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
 		//Check that the user exists
-		user, err := rt.db.GetUser(userId)
+		user, err := rt.db.GetUser(r.Context(), userId)
 		if err != nil || user == nil {
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
+		rt.presence.Touch(userId)
 
 		//Create a new unique request id
 		reqUUID, err := uuid.NewV4()
@@ -60,6 +77,8 @@ func (rt *_router) validateAuthorization(next httprouter.Handle) httprouter.Hand
 			ReqUUID: reqUUID,
 			Logger:  logger,
 			UserID:  userId,
+
+			SessionID: session.ID,
 		}
 
 		ctx := context.WithValue(r.Context(), "reqCtx", reqCtx)
@@ -68,3 +87,14 @@ func (rt *_router) validateAuthorization(next httprouter.Handle) httprouter.Hand
 		next(w, r, ps)
 	}
 }
+
+// acceptTokenParameter wraps validateAuthorization for routes opened by clients which can't set headers, like the
+// EventSource of browsers: the token may be passed in the `access_token` query parameter instead.
+func (rt *_router) acceptTokenParameter(next httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		if token := r.URL.Query().Get("access_token"); token != "" && r.Header.Get("Authorization") == "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		next(w, r, ps)
+	}
+}
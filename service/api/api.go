@@ -11,6 +11,7 @@ Example:
 	apirouter, err := api.New(api.Config{
 		Logger:   logger,
 		Database: appdb,
+		Blobs:    blobs,
 	})
 	if err != nil {
 		logger.WithError(err).Error("error creating the API server instance")
@@ -37,16 +38,29 @@ See the `main.go` file inside the `cmd/webapi` for a full usage example.
 package api
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"github.com/Nyheim99/WASAText/service/blobstore"
 	"github.com/Nyheim99/WASAText/service/database"
+	"github.com/Nyheim99/WASAText/service/eventbus"
+	"github.com/Nyheim99/WASAText/service/presence"
+	"github.com/Nyheim99/WASAText/service/realtime"
 	"github.com/julienschmidt/httprouter"
 	"github.com/sirupsen/logrus"
 	"net/http"
-
-	"log"
-	"path/filepath"
+	"time"
 )
 
+// defaultSessionLifetime is used when Config.SessionLifetime is not set
+const defaultSessionLifetime = 30 * 24 * time.Hour
+
+// defaultMessageEditWindow is used when Config.MessageEditWindow is not set
+const defaultMessageEditWindow = 15 * time.Minute
+
+// defaultMessageDeleteWindow is used when Config.MessageDeleteWindow is not set
+const defaultMessageDeleteWindow = 48 * time.Hour
+
 // Config is used to provide dependencies and configuration to the New function.
 type Config struct {
 	// Logger where log entries are sent
@@ -54,6 +68,18 @@ type Config struct {
 
 	// Database is the instance of database.AppDatabase where data are saved
 	Database database.AppDatabase
+
+	// Blobs is the store where uploaded media are saved
+	Blobs blobstore.Store
+
+	// SessionLifetime is how long a session token issued by doLogin stays valid
+	SessionLifetime time.Duration
+
+	// MessageEditWindow is how long after sending a message its sender can edit it
+	MessageEditWindow time.Duration
+
+	// MessageDeleteWindow is how long after sending a message its sender can delete it for everyone
+	MessageDeleteWindow time.Duration
 }
 
 // Router is the package API interface representing an API handler builder
@@ -61,6 +87,10 @@ type Router interface {
 	// Handler returns an HTTP handler for APIs provided in this package
 	Handler() http.Handler
 
+	// ImportLegacyMedia moves the media saved by the first version of the application to the blob store. It must run
+	// before the handler serves requests.
+	ImportLegacyMedia(ctx context.Context, photosDir string) error
+
 	// Close terminates any resource used in the package
 	Close() error
 }
@@ -74,6 +104,18 @@ func New(cfg Config) (Router, error) {
 	if cfg.Database == nil {
 		return nil, errors.New("database is required")
 	}
+	if cfg.Blobs == nil {
+		return nil, errors.New("blob store is required")
+	}
+	if cfg.SessionLifetime <= 0 {
+		cfg.SessionLifetime = defaultSessionLifetime
+	}
+	if cfg.MessageEditWindow <= 0 {
+		cfg.MessageEditWindow = defaultMessageEditWindow
+	}
+	if cfg.MessageDeleteWindow <= 0 {
+		cfg.MessageDeleteWindow = defaultMessageDeleteWindow
+	}
 
 	// Create a new router where we will register HTTP endpoints. The server will pass requests to this router to be
 	// handled.
@@ -81,25 +123,33 @@ func New(cfg Config) (Router, error) {
 	router.RedirectTrailingSlash = false
 	router.RedirectFixedPath = false
 
-	//Serve profile pictures
-	staticUsersDir, err := filepath.Abs("service/photos/users")
-	if err != nil {
-		log.Fatal("Failed to resolve user photos directory:", err)
+	// Changes made through the router are published on its bus
+	bus := eventbus.New(cfg.Logger)
+	rt := &_router{
+		router:     router,
+		baseLogger: cfg.Logger,
+		db:         database.WithEvents(cfg.Database, bus),
+		blobs:      cfg.Blobs,
+		bus:        bus,
+		events:     realtime.NewHub(),
+
+		sessionLifetime:     cfg.SessionLifetime,
+		messageEditWindow:   cfg.MessageEditWindow,
+		messageDeleteWindow: cfg.MessageDeleteWindow,
 	}
-	router.ServeFiles("/service/photos/users/*filepath", http.Dir(staticUsersDir))
+	bus.Subscribe("realtime", rt.relayEvent)
 
-	//Serve group pictures
-	staticGroupsDir, err := filepath.Abs("service/photos/groups")
+	tracker, err := presence.NewTracker(presence.Config{
+		Store:    cfg.Database,
+		Logger:   cfg.Logger,
+		OnChange: rt.relayPresence,
+	})
 	if err != nil {
-		log.Fatal("Failed to resolve group photos directory:", err)
+		bus.Close()
+		return nil, fmt.Errorf("creating the presence tracker: %w", err)
 	}
-	router.ServeFiles("/service/photos/groups/*filepath", http.Dir(staticGroupsDir))
-
-	return &_router{
-		router:     router,
-		baseLogger: cfg.Logger,
-		db:         cfg.Database,
-	}, nil
+	rt.presence = tracker
+	return rt, nil
 }
 
 type _router struct {
@@ -110,4 +160,20 @@ type _router struct {
 	baseLogger logrus.FieldLogger
 
 	db database.AppDatabase
+
+	blobs blobstore.Store
+
+	// bus carries the domain events of the changes saved through db, to whatever reacts to them
+	bus *eventbus.Bus
+
+	// events delivers the changes in conversations to their participants, see getEvents. It receives them from bus,
+	// see relayEvent.
+	events *realtime.Hub
+
+	// presence follows the activity of the users, see validateAuthorization
+	presence *presence.Tracker
+
+	sessionLifetime     time.Duration
+	messageEditWindow   time.Duration
+	messageDeleteWindow time.Duration
 }
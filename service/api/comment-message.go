@@ -50,7 +50,7 @@ func (rt *_router) commentMessage(w http.ResponseWriter, r *http.Request, ps htt
 	}
 
 	//Comment the message
-	err = rt.db.CommentMessage(messageID, userID, req.Emoticon)
+	err = rt.db.CommentMessage(r.Context(), messageID, userID, req.Emoticon)
 	if err != nil {
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
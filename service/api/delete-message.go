@@ -2,18 +2,30 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 
 	"github.com/Nyheim99/WASAText/service/api/reqcontext"
+	"github.com/Nyheim99/WASAText/service/database"
+	"github.com/Nyheim99/WASAText/service/globaltime"
 	"github.com/julienschmidt/httprouter"
 )
 
+// Who a message is deleted for, see deleteMessage
+const (
+	deleteForEveryone = "everyone"
+	deleteForMe       = "me"
+)
+
 type DeleteMessageResponse struct {
-	MessageID      int64 `json:"message_id"`
-	ConversationID int64 `json:"conversation_id"`
+	MessageID      int64  `json:"message_id"`
+	ConversationID int64  `json:"conversation_id"`
+	Scope          string `json:"scope"`
 }
 
+//Delete a message for everyone, which only its sender can do for a while after sending it, or hide it from the user's
+//own view, which any participant can do
 func (rt *_router) deleteMessage(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 
 	//Get conversation ID
@@ -38,14 +50,32 @@ func (rt *_router) deleteMessage(w http.ResponseWriter, r *http.Request, ps http
 	}
 	userID := reqCtx.UserID
 
-	//Delete the message from the database
-	err = rt.db.DeleteMessage(conversationID, messageID, userID)
-	if err != nil {
-		if err.Error() == "message not found or already deleted" {
-			http.Error(w, "Message not found or already deleted", http.StatusNotFound)
-		} else {
-			http.Error(w, "Invalid request", http.StatusInternalServerError)
-		}
+	//Messages are deleted for everyone unless asked otherwise
+	scope := r.URL.Query().Get("scope")
+	switch scope {
+	case "", deleteForEveryone:
+		scope = deleteForEveryone
+		sentAfter := globaltime.Now().Add(-rt.messageDeleteWindow)
+		err = rt.db.DeleteMessage(r.Context(), conversationID, messageID, userID, sentAfter)
+	case deleteForMe:
+		err = rt.db.HideMessage(r.Context(), conversationID, messageID, userID)
+	default:
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	switch {
+	case errors.Is(err, database.ErrMessageNotFound):
+		http.Error(w, "Message not found or already deleted", http.StatusNotFound)
+		return
+	case errors.Is(err, database.ErrNotMessageSender):
+		http.Error(w, "Only the sender can delete a message for everyone", http.StatusForbidden)
+		return
+	case errors.Is(err, database.ErrDeleteWindowClosed):
+		http.Error(w, "Message is too old to be deleted for everyone", http.StatusConflict)
+		return
+	case err != nil:
+		reqCtx.Logger.WithError(err).Error("can't delete message")
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
@@ -55,6 +85,7 @@ func (rt *_router) deleteMessage(w http.ResponseWriter, r *http.Request, ps http
 	err = json.NewEncoder(w).Encode(DeleteMessageResponse{
 		MessageID:      messageID,
 		ConversationID: conversationID,
+		Scope:          scope,
 	})
 	if err != nil {
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
@@ -0,0 +1,30 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Nyheim99/WASAText/service/api/reqcontext"
+	"github.com/Nyheim99/WASAText/service/database"
+	"github.com/julienschmidt/httprouter"
+)
+
+//Logs out the current session
+func (rt *_router) doLogout(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+
+	//Get the session ID
+	reqCtx, ok := r.Context().Value("reqCtx").(*reqcontext.RequestContext)
+	if !ok || reqCtx == nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	//Delete the session from the database
+	err := rt.db.DeleteSession(r.Context(), reqCtx.UserID, reqCtx.SessionID)
+	if err != nil && !errors.Is(err, database.ErrSessionNotFound) {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
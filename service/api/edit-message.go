@@ -0,0 +1,83 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/Nyheim99/WASAText/service/api/reqcontext"
+	"github.com/Nyheim99/WASAText/service/database"
+	"github.com/Nyheim99/WASAText/service/globaltime"
+	"github.com/julienschmidt/httprouter"
+)
+
+type editMessageRequest struct {
+	Message string `json:"message"`
+}
+
+type editMessageResponse struct {
+	MessageID      int64  `json:"message_id"`
+	ConversationID int64  `json:"conversation_id"`
+	Content        string `json:"content"`
+}
+
+//Replace the text of a message, which only its sender can do for a while after sending it
+func (rt *_router) editMessage(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+
+	//Get user ID
+	reqCtx, ok := r.Context().Value("reqCtx").(*reqcontext.RequestContext)
+	if !ok || reqCtx == nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	//The conversation and message IDs were validated by requireParticipant and requireMessage
+	conversationID, _ := strconv.ParseInt(ps.ByName("conversationID"), 10, 64)
+	messageID, _ := strconv.ParseInt(ps.ByName("messageID"), 10, 64)
+
+	//Validate the request
+	var req editMessageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	if !validMessageText(req.Message) {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	sentAfter := globaltime.Now().Add(-rt.messageEditWindow)
+	err := rt.db.EditMessage(r.Context(), conversationID, messageID, reqCtx.UserID, req.Message, sentAfter)
+	switch {
+	case errors.Is(err, database.ErrMessageNotFound):
+		http.Error(w, "Message not found", http.StatusNotFound)
+		return
+	case errors.Is(err, database.ErrNotMessageSender):
+		http.Error(w, "Only the sender can edit a message", http.StatusForbidden)
+		return
+	case errors.Is(err, database.ErrMessageNotEditable):
+		http.Error(w, "Message can't be edited", http.StatusBadRequest)
+		return
+	case errors.Is(err, database.ErrEditWindowClosed):
+		http.Error(w, "Message is too old to be edited", http.StatusConflict)
+		return
+	case err != nil:
+		reqCtx.Logger.WithError(err).Error("can't edit message")
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	//Return the edited message
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(editMessageResponse{
+		MessageID:      messageID,
+		ConversationID: conversationID,
+		Content:        req.Message,
+	})
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
@@ -1,10 +1,12 @@
 package api
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
 	"github.com/Nyheim99/WASAText/service/api/reqcontext"
+	"github.com/Nyheim99/WASAText/service/database"
 	"github.com/julienschmidt/httprouter"
 )
 
@@ -35,8 +37,27 @@ func (rt *_router) forwardMessage(w http.ResponseWriter, r *http.Request, ps htt
 	}
 	senderID := reqCtx.UserID
 
+	//Check that the user can see the original message
+	originalConversationID, err := rt.db.GetMessageConversationID(r.Context(), originalMessageID)
+	if errors.Is(err, database.ErrMessageNotFound) {
+		http.Error(w, "Message not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	isParticipant, err := rt.db.IsParticipant(r.Context(), originalConversationID, senderID)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !isParticipant {
+		http.Error(w, "Message not found", http.StatusNotFound)
+		return
+	}
+
 	//Forwards the message
-	_, err = rt.db.ForwardMessage(conversationID, senderID, originalMessageID)
+	_, err = rt.db.ForwardMessage(r.Context(), conversationID, senderID, originalMessageID)
 	if err != nil {
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
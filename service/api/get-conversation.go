@@ -19,7 +19,7 @@ func (rt *_router) getConversation(w http.ResponseWriter, r *http.Request, ps ht
 	}
 
 	//Get the conversation
-	conversation, err := rt.db.GetConversation(conversationID)
+	conversation, err := rt.db.GetConversation(r.Context(), conversationID)
 	if err != nil {
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
@@ -29,6 +29,11 @@ func (rt *_router) getConversation(w http.ResponseWriter, r *http.Request, ps ht
 		return
 	}
 
+	for i := range conversation.Participants {
+		conversation.Participants[i].PhotoThumbnails = photoThumbnails(conversation.Participants[i].PhotoURL)
+		rt.fillPresence(&conversation.Participants[i])
+	}
+
 	//Return the conversation
 	w.Header().Set("Content-Type", "application/json")
 	err = json.NewEncoder(w).Encode(conversation)
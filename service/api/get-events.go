@@ -0,0 +1,107 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/Nyheim99/WASAText/service/api/reqcontext"
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	// eventsHeartbeat is how often a comment is sent on an idle event stream, to keep proxies from closing it
+	eventsHeartbeat = 15 * time.Second
+
+	// eventsWriteTimeout is how long writing an event may take before the client is considered gone
+	eventsWriteTimeout = 10 * time.Second
+)
+
+//Stream the events of the user's conversations, as Server-Sent Events
+func (rt *_router) getEvents(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+
+	//Get user ID
+	reqCtx, ok := r.Context().Value("reqCtx").(*reqcontext.RequestContext)
+	if !ok || reqCtx == nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	//Take over the connection: the stream must outlive the write timeout of the server
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	sub := rt.events.Subscribe(reqCtx.UserID)
+	defer sub.Close()
+	defer rt.presence.Connect(reqCtx.UserID)()
+
+	conn, buf, err := hijacker.Hijack()
+	if err != nil {
+		reqCtx.Logger.WithError(err).Error("can't take over the connection for the event stream")
+		return
+	}
+	defer conn.Close()
+	_ = conn.SetReadDeadline(time.Time{})
+
+	//Clients send nothing else: the read ends when they go away
+	gone := make(chan struct{})
+	go func() {
+		_, _ = io.Copy(io.Discard, buf.Reader)
+		close(gone)
+	}()
+
+	write := func(format string, args ...interface{}) bool {
+		_ = conn.SetWriteDeadline(time.Now().Add(eventsWriteTimeout))
+		_, _ = fmt.Fprintf(buf, format, args...)
+		return buf.Flush() == nil
+	}
+
+	//Write the response headers, including the ones already set by middlewares (e.g., CORS)
+	header := w.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "close")
+	_, _ = buf.WriteString("HTTP/1.1 200 OK\r\n")
+	_ = header.Write(buf)
+	if !write("\r\nretry: 3000\n\n") {
+		return
+	}
+
+	heartbeat := time.NewTicker(eventsHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case event, ok := <-sub.Events():
+			if !ok {
+				//The hub is closing, or the client was too slow: it will connect again
+				if sub.Lagged() {
+					reqCtx.Logger.Info("event stream dropped, the client can't keep up")
+				}
+				return
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				reqCtx.Logger.WithError(err).Error("can't encode event")
+				continue
+			}
+			if !write("id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data) {
+				return
+			}
+			rt.markStreamed(reqCtx.UserID, event, reqCtx.Logger)
+
+		case <-heartbeat.C:
+			if !write(": ping\n\n") {
+				return
+			}
+
+		case <-gone:
+			return
+		}
+	}
+}
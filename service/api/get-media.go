@@ -0,0 +1,64 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Nyheim99/WASAText/service/blobstore"
+	"github.com/julienschmidt/httprouter"
+)
+
+//Serves a profile picture or a group photo from the blob store
+func (rt *_router) getMedia(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+
+	//Anyone may load profile pictures and group photos, so other blobs, like message photos, are not served here
+	key := ps.ByName("key")
+	if !blobstore.ValidKey(key) {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	public, err := rt.db.IsPublicPhoto(r.Context(), mediaURL(key))
+	if err != nil {
+		rt.baseLogger.WithError(err).Error("can't check photo")
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	} else if !public {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	//Get the requested size of the photo
+	key, err = rt.thumbnailKey(r, key)
+	if errors.Is(err, errInvalidThumbnailSize) {
+		http.Error(w, "Invalid size", http.StatusBadRequest)
+		return
+	} else if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	//Send the client straight to the storage service, when it can serve the blob itself
+	if presigner, ok := rt.blobs.(blobstore.Presigner); ok {
+		rt.redirectToPresigned(w, r, presigner, key, "")
+		return
+	}
+
+	//Get the blob
+	blob, err := rt.blobs.Open(key)
+	if errors.Is(err, blobstore.ErrNotFound) {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer blob.Close()
+
+	//Blobs are addressed by their content, so they never change
+	w.Header().Set("ETag", `"`+key+`"`)
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+
+	//Stream the blob, the content type is sniffed from its first bytes
+	http.ServeContent(w, r, "", time.Time{}, blob)
+}
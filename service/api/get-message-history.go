@@ -0,0 +1,49 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/Nyheim99/WASAText/service/api/reqcontext"
+	"github.com/Nyheim99/WASAText/service/database"
+	"github.com/julienschmidt/httprouter"
+)
+
+type getMessageHistoryResponse struct {
+	MessageID int64                     `json:"message_id"`
+	Versions  []database.MessageVersion `json:"versions"`
+}
+
+//Get the versions of the text of a message, the current one being the last
+func (rt *_router) getMessageHistory(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+
+	//Get user ID
+	reqCtx, ok := r.Context().Value("reqCtx").(*reqcontext.RequestContext)
+	if !ok || reqCtx == nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	//The message ID was validated by requireMessage
+	messageID, _ := strconv.ParseInt(ps.ByName("messageID"), 10, 64)
+
+	versions, err := rt.db.GetMessageHistory(r.Context(), messageID)
+	if errors.Is(err, database.ErrMessageNotFound) {
+		http.Error(w, "Message not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		reqCtx.Logger.WithError(err).Error("can't get message history")
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(getMessageHistoryResponse{MessageID: messageID, Versions: versions})
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/Nyheim99/WASAText/service/blobstore"
+	"github.com/Nyheim99/WASAText/service/database"
+	"github.com/julienschmidt/httprouter"
+)
+
+//Serves the photo of a message
+func (rt *_router) getMessagePhoto(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+
+	//Get message ID
+	messageID, err := strconv.ParseInt(ps.ByName("messageID"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid message ID", http.StatusBadRequest)
+		return
+	}
+
+	//Get the photo from the database
+	photo, err := rt.db.GetMessagePhoto(r.Context(), messageID)
+	if errors.Is(err, database.ErrMessageNotFound) {
+		http.Error(w, "Photo not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	//Get the requested size of the photo
+	key, err := rt.thumbnailKey(r, photo.Key)
+	if errors.Is(err, errInvalidThumbnailSize) {
+		http.Error(w, "Invalid size", http.StatusBadRequest)
+		return
+	} else if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	//Send the client straight to the storage service, when it can serve the photo itself
+	if presigner, ok := rt.blobs.(blobstore.Presigner); ok {
+		rt.redirectToPresigned(w, r, presigner, key, photo.MimeType)
+		return
+	}
+
+	blob, err := rt.blobs.Open(key)
+	if errors.Is(err, blobstore.ErrNotFound) {
+		http.Error(w, "Photo not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer blob.Close()
+
+	//Photos never change, so they can be cached by the client for as long as it wants. The key is not the ETag, as
+	//it would let the client download the blob from elsewhere.
+	w.Header().Set("Content-Type", photo.MimeType)
+	w.Header().Set("ETag", photoETag(key, messageID))
+	w.Header().Set("Cache-Control", "private, max-age=31536000, immutable")
+
+	//Stream the photo, with support for conditional and range requests
+	http.ServeContent(w, r, "", photo.Timestamp, blob)
+}
+
+// photoETag returns the entity tag of the photo of a message stored under key, which doesn't reveal the key
+func photoETag(key string, messageID int64) string {
+	sum := sha256.Sum256([]byte(key + ":" + strconv.FormatInt(messageID, 10)))
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
@@ -0,0 +1,45 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/Nyheim99/WASAText/service/api/reqcontext"
+	"github.com/Nyheim99/WASAText/service/database"
+	"github.com/julienschmidt/httprouter"
+)
+
+type getMessageReceiptsResponse struct {
+	MessageID int64              `json:"message_id"`
+	Receipts  []database.Receipt `json:"receipts"`
+}
+
+//Get who received and read a message, and when
+func (rt *_router) getMessageReceipts(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+
+	//Get user ID
+	reqCtx, ok := r.Context().Value("reqCtx").(*reqcontext.RequestContext)
+	if !ok || reqCtx == nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	//The message ID was validated by requireMessage
+	messageID, _ := strconv.ParseInt(ps.ByName("messageID"), 10, 64)
+
+	receipts, err := rt.db.GetReceipts(r.Context(), messageID)
+	if err != nil {
+		reqCtx.Logger.WithError(err).Error("can't get receipts")
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(getMessageReceiptsResponse{MessageID: messageID, Receipts: receipts})
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,113 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/Nyheim99/WASAText/service/api/reqcontext"
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	// defaultMessagePageSize is the amount of messages returned when no limit is requested
+	defaultMessagePageSize = 50
+
+	// maxMessagePageSize is the largest page of messages a client can request
+	maxMessagePageSize = 100
+)
+
+//Get a page of messages in a conversation
+func (rt *_router) getMessages(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+
+	//Get conversation ID
+	conversationID, err := strconv.ParseInt(ps.ByName("conversationID"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid conversation ID", http.StatusBadRequest)
+		return
+	}
+
+	//Get user ID
+	reqCtx, ok := r.Context().Value("reqCtx").(*reqcontext.RequestContext)
+	if !ok || reqCtx == nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	//Validate the cursors and page size
+	query := r.URL.Query()
+	before, ok := parseCursor(query.Get("before"))
+	if !ok {
+		http.Error(w, "Invalid before cursor", http.StatusBadRequest)
+		return
+	}
+	after, ok := parseCursor(query.Get("after"))
+	if !ok {
+		http.Error(w, "Invalid after cursor", http.StatusBadRequest)
+		return
+	}
+	if before > 0 && after > 0 {
+		http.Error(w, "Only one of before and after can be set", http.StatusBadRequest)
+		return
+	}
+
+	limit := defaultMessagePageSize
+	if limitStr := query.Get("limit"); limitStr != "" {
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit < 1 || limit > maxMessagePageSize {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+
+	//Get the messages
+	page, err := rt.db.GetMessages(r.Context(), conversationID, reqCtx.UserID, before, after, limit)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	//Photos are loaded separately, through their own URL
+	var received []int64
+	for i := range page.Messages {
+		if page.Messages[i].HasPhoto && !page.Messages[i].IsDeleted {
+			page.Messages[i].PhotoURL = messagePhotoURL(conversationID, page.Messages[i].ID)
+		}
+		if page.Messages[i].SenderID != reqCtx.UserID {
+			received = append(received, page.Messages[i].ID)
+		}
+	}
+
+	//The user has received the messages of others now. The messages are returned anyway, so a failure is logged
+	//rather than returned.
+	if _, err := rt.db.MarkMessagesDelivered(r.Context(), conversationID, reqCtx.UserID, received); err != nil {
+		reqCtx.Logger.WithError(err).Warn("can't mark messages as delivered")
+	}
+
+	//Return the page
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(page)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
+
+//Helper function to parse an optional message ID cursor
+func parseCursor(value string) (int64, bool) {
+	if value == "" {
+		return 0, true
+	}
+	cursor, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || cursor < 1 {
+		return 0, false
+	}
+	return cursor, true
+}
+
+//Helper function to build the URL a message photo is served from
+func messagePhotoURL(conversationID, messageID int64) string {
+	return fmt.Sprintf("/conversations/%d/messages/%d/photo", conversationID, messageID)
+}
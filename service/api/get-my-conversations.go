@@ -20,7 +20,7 @@ func (rt *_router) getMyConversations(w http.ResponseWriter, r *http.Request, ps
 	userID := reqCtx.UserID
 
 	//Get conversations from Database
-	conversations, err := rt.db.GetMyConversations(userID)
+	conversations, err := rt.db.GetMyConversations(r.Context(), userID)
 	if err != nil {
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
@@ -31,6 +31,16 @@ func (rt *_router) getMyConversations(w http.ResponseWriter, r *http.Request, ps
 		conversations = conversations[:50]
 	}
 
+	for i := range conversations {
+		conversations[i].DisplayPhotoThumbnails = photoThumbnails(conversations[i].DisplayPhotoURL)
+
+		//Private conversations show the presence of the other participant
+		if conversations[i].PeerID != 0 {
+			p := rt.presence.Get(conversations[i].PeerID, conversations[i].LastSeen)
+			conversations[i].Presence, conversations[i].LastSeen = p.Status, p.LastSeen
+		}
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 
 	//If the user has no conversations, return an empty string array
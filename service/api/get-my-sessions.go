@@ -0,0 +1,41 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/Nyheim99/WASAText/service/api/reqcontext"
+	"github.com/julienschmidt/httprouter"
+)
+
+//Lists the active sessions of the user
+func (rt *_router) getMySessions(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+
+	//Get the user ID
+	reqCtx, ok := r.Context().Value("reqCtx").(*reqcontext.RequestContext)
+	if !ok || reqCtx == nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	//Get the sessions from the database
+	sessions, err := rt.db.GetSessions(r.Context(), reqCtx.UserID)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	//Flag the session making the request
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == reqCtx.SessionID
+	}
+
+	//Return the session list
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(sessions)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,276 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Nyheim99/WASAText/service/api/reqcontext"
+	"github.com/gorilla/websocket"
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	// socketPingPeriod is how often the server pings the client
+	socketPingPeriod = 30 * time.Second
+
+	// socketPongWait is how long the server waits for any frame from the client, pongs included, before closing the
+	// connection. It must be longer than socketPingPeriod.
+	socketPongWait = 60 * time.Second
+
+	// socketWriteTimeout is how long writing a frame may take before the client is considered gone
+	socketWriteTimeout = 10 * time.Second
+
+	// socketMaxRequest is the size of the largest request a client can send, enough for a text message of 1000
+	// characters of up to 4 bytes each
+	socketMaxRequest = 8 << 10
+)
+
+// Types of the requests a client can send over the socket
+const (
+	socketSendMessage    = "send_message"
+	socketSetReaction    = "set_reaction"
+	socketRemoveReaction = "remove_reaction"
+	socketMarkRead       = "mark_read"
+	socketTyping         = "typing"
+)
+
+var socketUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+
+	// Clients authenticate with a token rather than a cookie, as for the rest of the API: pages from other origins
+	// can't act as the user without it
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// socketRequest is a request from the client. The fields used depend on Type.
+type socketRequest struct {
+	// ID is chosen by the client, and repeated in the reply
+	ID   string `json:"id"`
+	Type string `json:"type"`
+
+	ConversationID    int64  `json:"conversation_id"`
+	MessageID         int64  `json:"message_id"`
+	Message           string `json:"message"`
+	OriginalMessageID int64  `json:"original_message_id"`
+	Emoticon          string `json:"emoticon"`
+}
+
+// socketReply answers a socketRequest, with the status the same request would get over HTTP
+type socketReply struct {
+	// Type is always "reply", which no event has
+	Type   string `json:"type"`
+	ID     string `json:"id"`
+	Status int    `json:"status"`
+	Error  string `json:"error,omitempty"`
+
+	// MessageID is the ID of the message sent by a send_message request
+	MessageID int64 `json:"message_id,omitempty"`
+}
+
+//Exchange events and requests with the client over a WebSocket
+func (rt *_router) getSocket(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+
+	//Get user ID
+	reqCtx, ok := r.Context().Value("reqCtx").(*reqcontext.RequestContext)
+	if !ok || reqCtx == nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	//The upgrader writes the error response itself
+	conn, err := socketUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+
+	sub := rt.events.Subscribe(reqCtx.UserID)
+	defer sub.Close()
+	defer rt.presence.Connect(reqCtx.UserID)()
+
+	//Requests are read and handled one at a time, so a client can't load the database with more than one of them.
+	//Their replies are written by this goroutine only, as the connection supports only one concurrent writer: when the
+	//client doesn't read them, the reader waits, and stops reading the client.
+	replies := make(chan socketReply)
+	done := make(chan struct{})
+	readerDone := make(chan struct{})
+	go func() {
+		defer close(readerDone)
+		rt.readSocket(r, reqCtx, conn, replies, done)
+	}()
+
+	//Let a request being handled finish, while the request context is still valid
+	defer func() {
+		close(done)
+		_ = conn.Close()
+		<-readerDone
+	}()
+
+	write := func(v interface{}) bool {
+		_ = conn.SetWriteDeadline(time.Now().Add(socketWriteTimeout))
+		return conn.WriteJSON(v) == nil
+	}
+	closeWith := func(code int, reason string) {
+		_ = conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(socketWriteTimeout))
+	}
+
+	ping := time.NewTicker(socketPingPeriod)
+	defer ping.Stop()
+
+	for {
+		select {
+		case event, ok := <-sub.Events():
+			if !ok {
+				//The client is expected to connect again and reload, as after a network failure
+				if sub.Lagged() {
+					reqCtx.Logger.Info("socket dropped, the client can't keep up")
+					closeWith(websocket.CloseTryAgainLater, "too slow")
+				} else {
+					closeWith(websocket.CloseGoingAway, "server shutting down")
+				}
+				return
+			}
+			if !write(event) {
+				return
+			}
+			rt.markStreamed(reqCtx.UserID, event, reqCtx.Logger)
+
+		case reply := <-replies:
+			if !write(reply) {
+				return
+			}
+
+		case <-ping.C:
+			if conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(socketWriteTimeout)) != nil {
+				return
+			}
+
+		case <-readerDone:
+			return
+		}
+	}
+}
+
+// readSocket reads the requests of the client and sends their replies, until the connection fails or done is closed
+func (rt *_router) readSocket(r *http.Request, reqCtx *reqcontext.RequestContext, conn *websocket.Conn, replies chan<- socketReply, done <-chan struct{}) {
+	conn.SetReadLimit(socketMaxRequest)
+	_ = conn.SetReadDeadline(time.Now().Add(socketPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(socketPongWait))
+	})
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		_ = conn.SetReadDeadline(time.Now().Add(socketPongWait))
+		rt.presence.Touch(reqCtx.UserID)
+
+		var req socketRequest
+		var reply socketReply
+		if err := json.Unmarshal(data, &req); err != nil {
+			reply = socketReply{Status: http.StatusBadRequest, Error: "Invalid request"}
+		} else {
+			reply = rt.handleSocketRequest(r, reqCtx, req)
+			reply.ID = req.ID
+		}
+		reply.Type = "reply"
+
+		select {
+		case replies <- reply:
+		case <-done:
+			return
+		}
+	}
+}
+
+// handleSocketRequest carries out a request of the client, with the same rules as the matching HTTP operation
+func (rt *_router) handleSocketRequest(r *http.Request, reqCtx *reqcontext.RequestContext, req socketRequest) socketReply {
+	ctx := r.Context()
+	userID := reqCtx.UserID
+
+	//Turn an error into a reply, hiding the ones which are not the client's
+	fail := func(err error, action string) socketReply {
+		var reqErr *requestError
+		if errors.As(err, &reqErr) {
+			return socketReply{Status: reqErr.status, Error: reqErr.message}
+		}
+		reqCtx.Logger.WithError(err).WithField("request", req.Type).Error(action)
+		return socketReply{Status: http.StatusInternalServerError, Error: "Internal server error"}
+	}
+
+	switch req.Type {
+	case socketSendMessage, socketSetReaction, socketRemoveReaction, socketMarkRead, socketTyping:
+	default:
+		return socketReply{Status: http.StatusBadRequest, Error: "Unknown request type"}
+	}
+
+	//Every request acts in a conversation of the user
+	if err := rt.checkParticipant(ctx, req.ConversationID, userID); err != nil {
+		return fail(err, "can't check conversation membership")
+	}
+
+	switch req.Type {
+	case socketSendMessage:
+		//Photos are only sent over HTTP
+		if !validMessageText(req.Message) {
+			return socketReply{Status: http.StatusBadRequest, Error: "Invalid request"}
+		}
+
+		//Replies must stay within the conversation
+		if req.OriginalMessageID != 0 {
+			var reqErr *requestError
+			err := rt.checkMessage(ctx, req.ConversationID, req.OriginalMessageID)
+			if errors.As(err, &reqErr) {
+				return socketReply{Status: http.StatusBadRequest, Error: "Invalid original_message_id"}
+			} else if err != nil {
+				return fail(err, "can't check the original message")
+			}
+		}
+
+		messageID, err := rt.db.SendMessage(ctx, req.ConversationID, userID, &req.Message, nil, nil, req.OriginalMessageID)
+		if err != nil {
+			return fail(err, "can't send message")
+		}
+		return socketReply{Status: http.StatusCreated, MessageID: messageID}
+
+	case socketSetReaction, socketRemoveReaction:
+		if err := rt.checkMessage(ctx, req.ConversationID, req.MessageID); err != nil {
+			return fail(err, "can't check message")
+		}
+
+		if req.Type == socketSetReaction {
+			if req.Emoticon == "" {
+				return socketReply{Status: http.StatusBadRequest, Error: "Invalid request"}
+			}
+			if err := rt.db.CommentMessage(ctx, req.MessageID, userID, req.Emoticon); err != nil {
+				return fail(err, "can't comment message")
+			}
+		} else {
+			req.Emoticon = ""
+			if err := rt.db.UncommentMessage(ctx, req.MessageID, userID); err != nil {
+				return fail(err, "can't uncomment message")
+			}
+		}
+		return socketReply{Status: http.StatusNoContent}
+
+	case socketTyping:
+		if err := rt.publishTyping(ctx, req.ConversationID, userID); err != nil {
+			return fail(err, "can't publish typing")
+		}
+		return socketReply{Status: http.StatusNoContent}
+
+	default:
+		//Messages up to message_id are read, or all of them if it is not set
+		if req.MessageID < 0 {
+			return socketReply{Status: http.StatusBadRequest, Error: "Invalid request"}
+		}
+		if err := rt.db.MarkMessagesAsRead(ctx, req.ConversationID, userID, req.MessageID); err != nil {
+			return fail(err, "can't mark messages as read")
+		}
+		return socketReply{Status: http.StatusNoContent}
+	}
+}
@@ -0,0 +1,71 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/Nyheim99/WASAText/service/api/reqcontext"
+	"github.com/Nyheim99/WASAText/service/database"
+	"github.com/julienschmidt/httprouter"
+)
+
+//Get the thread a message belongs to: its root, and every reply to it or to its replies
+func (rt *_router) getThread(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+
+	//Get user ID
+	reqCtx, ok := r.Context().Value("reqCtx").(*reqcontext.RequestContext)
+	if !ok || reqCtx == nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	//The conversation and message IDs were validated by requireParticipant and requireMessage
+	conversationID, _ := strconv.ParseInt(ps.ByName("conversationID"), 10, 64)
+	messageID, _ := strconv.ParseInt(ps.ByName("messageID"), 10, 64)
+
+	//A reply, however deep in its chain, leads to the root of its thread
+	var thread *database.Thread
+	rootID, err := rt.db.GetThreadRootID(r.Context(), messageID)
+	if err == nil {
+		thread, err = rt.db.GetThread(r.Context(), conversationID, reqCtx.UserID, rootID)
+	}
+	if errors.Is(err, database.ErrMessageNotFound) {
+		http.Error(w, "Message not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		reqCtx.Logger.WithError(err).Error("can't get thread")
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	//Photos are loaded separately, through their own URL
+	messages := make([]*database.Message, 0, len(thread.Replies)+1)
+	messages = append(messages, &thread.Root)
+	for i := range thread.Replies {
+		messages = append(messages, &thread.Replies[i])
+	}
+	var received []int64
+	for _, msg := range messages {
+		if msg.HasPhoto && !msg.IsDeleted {
+			msg.PhotoURL = messagePhotoURL(conversationID, msg.ID)
+		}
+		if msg.SenderID != reqCtx.UserID {
+			received = append(received, msg.ID)
+		}
+	}
+
+	//The user has received the messages of others now. The messages are returned anyway, so a failure is logged
+	//rather than returned.
+	if _, err := rt.db.MarkMessagesDelivered(r.Context(), conversationID, reqCtx.UserID, received); err != nil {
+		reqCtx.Logger.WithError(err).Warn("can't mark messages as delivered")
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(thread); err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
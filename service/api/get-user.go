@@ -20,7 +20,7 @@ func (rt *_router) getUser(w http.ResponseWriter, r *http.Request, ps httprouter
 	userId := reqCtx.UserID
 
 	//Fetch the user from database
-	user, err := rt.db.GetUser(userId)
+	user, err := rt.db.GetUser(r.Context(), userId)
 	if err != nil {
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
@@ -31,6 +31,9 @@ func (rt *_router) getUser(w http.ResponseWriter, r *http.Request, ps httprouter
 		return
 	}
 
+	user.PhotoThumbnails = photoThumbnails(user.PhotoURL)
+	rt.fillPresence(user)
+
 	//Return the user
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
@@ -10,7 +10,7 @@ import (
 func (rt *_router) getUsers(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 
 	//Fetch users from database
-	users, err := rt.db.GetUsers()
+	users, err := rt.db.GetUsers(r.Context())
 	if err != nil {
 		http.Error(w, "Failed to fetch users", http.StatusInternalServerError)
 		return
@@ -27,6 +27,11 @@ func (rt *_router) getUsers(w http.ResponseWriter, r *http.Request, ps httproute
 		users = users[:100]
 	}
 
+	for i := range users {
+		users[i].PhotoThumbnails = photoThumbnails(users[i].PhotoURL)
+		rt.fillPresence(&users[i])
+	}
+
 	//Return the list of users
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
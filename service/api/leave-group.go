@@ -27,7 +27,7 @@ func (rt *_router) leaveGroup(w http.ResponseWriter, r *http.Request, ps httprou
 	UserID := reqCtx.UserID
 
 	//Fetch vonersation from database
-	conversation, err := rt.db.GetConversation(conversationID)
+	conversation, err := rt.db.GetConversation(r.Context(), conversationID)
 	if err != nil {
 		http.Error(w, "Conversation not found", http.StatusNotFound)
 		return
@@ -37,21 +37,8 @@ func (rt *_router) leaveGroup(w http.ResponseWriter, r *http.Request, ps httprou
 		return
 	}
 
-	//Check that the user is member of the group
-	isMember := false
-	for _, participant := range conversation.Participants {
-		if participant.ID == UserID {
-			isMember = true
-			break
-		}
-	}
-	if !isMember {
-		http.Error(w, "User is not a member of the conversation", http.StatusForbidden)
-		return
-	}
-
 	//Leave the group
-	err = rt.db.LeaveGroup(conversationID, UserID)
+	err = rt.db.LeaveGroup(r.Context(), conversationID, UserID)
 	if err != nil {
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
@@ -0,0 +1,109 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/Nyheim99/WASAText/service/imaging"
+)
+
+// legacyPhotoURLPrefix starts the URLs of the profile and group photos saved by the first version of the application,
+// as files under service/photos
+const legacyPhotoURLPrefix = "/service/photos/"
+
+// ImportLegacyMedia moves the media saved by the first version of the application to the blob store: the message
+// photos the migrations set aside, and the profile and group photos saved as files in photosDir. Photos are sanitized
+// and get thumbnails like uploaded ones; the ones that can't be decoded are stored as they are. Profile and group
+// photos whose file is missing are removed. Importing again does nothing.
+func (rt *_router) ImportLegacyMedia(ctx context.Context, photosDir string) error {
+	ids, err := rt.db.GetLegacyMessagePhotoIDs(ctx)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		data, err := rt.db.GetLegacyMessagePhoto(ctx, id)
+		if err != nil {
+			return err
+		}
+		key, mimeType, err := rt.importLegacyPhoto(ctx, data)
+		if err != nil {
+			return fmt.Errorf("importing the photo of message %d: %w", id, err)
+		}
+		if err := rt.db.SetLegacyMessagePhotoKey(ctx, id, key, mimeType); err != nil {
+			return err
+		}
+	}
+
+	urls, err := rt.db.GetLegacyPhotoURLs(ctx, legacyPhotoURLPrefix)
+	if err != nil {
+		return err
+	}
+	photos := os.DirFS(photosDir)
+	for userID, url := range urls.Users {
+		photoURL, err := rt.importLegacyPhotoFile(ctx, photos, url)
+		if err != nil {
+			return fmt.Errorf("importing the photo of user %d: %w", userID, err)
+		}
+		if err := rt.db.SetMyPhoto(ctx, userID, photoURL); err != nil {
+			return err
+		}
+	}
+	for conversationID, url := range urls.Groups {
+		photoURL, err := rt.importLegacyPhotoFile(ctx, photos, url)
+		if err != nil {
+			return fmt.Errorf("importing the photo of group %d: %w", conversationID, err)
+		}
+		if err := rt.db.SetGroupPhoto(ctx, conversationID, photoURL); err != nil {
+			return err
+		}
+	}
+
+	if n := len(ids) + len(urls.Users) + len(urls.Groups); n > 0 {
+		rt.baseLogger.Infof("imported %d legacy photos to the blob store", n)
+	}
+	return nil
+}
+
+// importLegacyPhotoFile stores the photo file a legacy URL was served from, returning its new URL. The URL is empty
+// when the file is missing.
+func (rt *_router) importLegacyPhotoFile(ctx context.Context, photos fs.FS, url string) (string, error) {
+	name := strings.TrimPrefix(url, legacyPhotoURLPrefix)
+	if !fs.ValidPath(name) {
+		rt.baseLogger.Warnf("invalid legacy photo URL %q, removing it", url)
+		return "", nil
+	}
+	data, err := fs.ReadFile(photos, name)
+	if errors.Is(err, fs.ErrNotExist) {
+		rt.baseLogger.Warnf("legacy photo %q not found, removing it", url)
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+
+	key, _, err := rt.importLegacyPhoto(ctx, data)
+	if err != nil {
+		return "", err
+	}
+	return mediaURL(key), nil
+}
+
+// importLegacyPhoto stores a photo saved by the first version of the application, returning its key and MIME type
+func (rt *_router) importLegacyPhoto(ctx context.Context, data []byte) (string, string, error) {
+	key, mimeType, err := rt.storeUploadedPhoto(ctx, bytes.NewReader(data))
+	if errors.Is(err, imaging.ErrUnsupportedFormat) || errors.Is(err, imaging.ErrTooLarge) {
+		//It was accepted once, so it is kept even if it wouldn't be today
+		rt.baseLogger.WithError(err).Warn("storing a legacy photo without sanitizing it")
+		key, err = rt.blobs.Put(bytes.NewReader(data))
+		mimeType = http.DetectContentType(data)
+	}
+	if err != nil {
+		return "", "", err
+	}
+	return key, mimeType, nil
+}
@@ -1,6 +1,9 @@
 package api
 
 import (
+	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
 	"strconv"
 
@@ -8,6 +11,10 @@ import (
 	"github.com/julienschmidt/httprouter"
 )
 
+type markMessagesAsReadRequest struct {
+	UpTo int64 `json:"up_to"`
+}
+
 func (rt *_router) markMessagesAsRead(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 
 	//Get conversation ID
@@ -26,8 +33,19 @@ func (rt *_router) markMessagesAsRead(w http.ResponseWriter, r *http.Request, ps
 	}
 	userID := reqCtx.UserID
 
-	//Mark all messages as read in database
-	err = rt.db.MarkMessagesAsRead(conversationID, userID)
+	//Messages are read up to the one given, or all of them without a body
+	var req markMessagesAsReadRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	if req.UpTo < 0 {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	//Mark the messages as read in database
+	err = rt.db.MarkMessagesAsRead(r.Context(), conversationID, userID, req.UpTo)
 	if err != nil {
 		http.Error(w, "Failed to mark messages as read", http.StatusInternalServerError)
 		return
@@ -0,0 +1,30 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/Nyheim99/WASAText/service/api/reqcontext"
+	"github.com/julienschmidt/httprouter"
+)
+
+//Tell the other participants that the user is typing
+func (rt *_router) notifyTyping(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+
+	//Get user ID
+	reqCtx, ok := r.Context().Value("reqCtx").(*reqcontext.RequestContext)
+	if !ok || reqCtx == nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	//The conversation ID was validated by requireParticipant
+	conversationID, _ := strconv.ParseInt(ps.ByName("conversationID"), 10, 64)
+	if err := rt.publishTyping(r.Context(), conversationID, reqCtx.UserID); err != nil {
+		reqCtx.Logger.WithError(err).Error("can't publish typing")
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -2,15 +2,9 @@ package api
 
 import (
 	"encoding/json"
-	"fmt"
-	"io"
-	"mime/multipart"
 	"net/http"
-	"os"
-	"path/filepath"
 	"regexp"
 	"strconv"
-	"strings"
 
 	"github.com/Nyheim99/WASAText/service/api/reqcontext"
 	"github.com/julienschmidt/httprouter"
@@ -19,8 +13,7 @@ import (
 func (rt *_router) createConversation(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 
 	//Validate request
-	if err := r.ParseMultipartForm(10 << 20); err != nil {
-		http.Error(w, "Invalid request", http.StatusBadRequest)
+	if !parseUploadForm(w, r) {
 		return
 	}
 
@@ -43,7 +36,23 @@ func (rt *_router) createConversation(w http.ResponseWriter, r *http.Request, ps
 
 	var conversationID int64
 	var err error
-	sendMessage := true
+
+	//If the conversation is being created from a forwarded message, dont send a normal message
+	sendMessage := conversationType != "new_user"
+
+	//Validate the message before creating anything, so that an invalid one doesn't leave an empty conversation behind
+	message := r.FormValue("message")
+	if sendMessage {
+		if len(message) < 1 || len(message) > 1000 {
+			http.Error(w, "Invalid message length", http.StatusBadRequest)
+			return
+		}
+
+		if !messageTextPattern.MatchString(message) {
+			http.Error(w, "Invalid message format", http.StatusBadRequest)
+			return
+		}
+	}
 
 
 	//Check if conversation is private and if its created from a forwarded message
@@ -59,17 +68,12 @@ func (rt *_router) createConversation(w http.ResponseWriter, r *http.Request, ps
 		}
 
 		//Create the private conversation
-		conversationID, err = rt.db.CreatePrivateConversation(userID, recipientID)
+		conversationID, err = rt.db.CreatePrivateConversation(r.Context(), userID, recipientID)
 		if err != nil {
 			http.Error(w, "Internal server error", http.StatusInternalServerError)
 			return
 		}
 
-		//If the conversation is being created from a forwarded message, dont send a normal message
-		if conversationType == "new_user" {
-			sendMessage = false
-		}
-
 	} else if conversationType == "group" {
 
 		//Get group name
@@ -105,25 +109,23 @@ func (rt *_router) createConversation(w http.ResponseWriter, r *http.Request, ps
 			return
 		}
 
-		//Create the group conversation in the database
-		conversationID, err = rt.db.CreateGroupConversation(userID, groupName, "", participantIDs)
-		if err != nil {
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
-			return
-		}
-
-		//Handle the group photo if attached
-		if file, handler, err := r.FormFile("group_photo"); err == nil {
+		//Store the group photo if attached, before creating the group so that an invalid photo rejects the request
+		var groupPhoto string
+		if file, _, err := r.FormFile("group_photo"); err == nil {
 			defer file.Close()
-			photoURL, err := rt.saveUploadedFile(file, handler, conversationID)
+			key, _, err := rt.storeUploadedPhoto(r.Context(), file)
 			if err != nil {
-				http.Error(w, "Internal server error", http.StatusInternalServerError)
-				return
-			}
-			if err = rt.db.SetGroupPhoto(conversationID, photoURL); err != nil {
-				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				rt.writePhotoError(w, err)
 				return
 			}
+			groupPhoto = mediaURL(key)
+		}
+
+		//Create the group conversation in the database
+		conversationID, err = rt.db.CreateGroupConversation(r.Context(), userID, groupName, groupPhoto, participantIDs)
+		if err != nil {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
 		}
 	} else {
 		http.Error(w, "Invalid request", http.StatusBadRequest)
@@ -132,21 +134,9 @@ func (rt *_router) createConversation(w http.ResponseWriter, r *http.Request, ps
 
 	//If the conversation is created normally, send the message
 	if sendMessage {
-		message := r.FormValue("message")
-
-		//Validate the message
-		if len(message) < 1 || len(message) > 1000 {
-			http.Error(w, "Invalid message length", http.StatusBadRequest)
-			return
-		}
-
-		if match, _ := regexp.MatchString(`^[a-zA-Z0-9À-ÿ.,!?()\-\"' ]+$`, message); !match {
-			http.Error(w, "Invalid message format", http.StatusBadRequest)
-			return
-		}
 
 		//Send the message in the database
-		_, err = rt.db.SendMessage(conversationID, userID, &message, nil, nil, 0)
+		_, err = rt.db.SendMessage(r.Context(), conversationID, userID, &message, nil, nil, 0)
 		if err != nil {
 			http.Error(w, "Failed to send message", http.StatusInternalServerError)
 			return
@@ -165,31 +155,3 @@ func (rt *_router) createConversation(w http.ResponseWriter, r *http.Request, ps
 	}
 }
 
-
-//Helper function to save the optional group photo
-func (rt *_router) saveUploadedFile(file io.Reader, handler *multipart.FileHeader, conversationID int64) (string, error) {
-	fileExt := strings.ToLower(filepath.Ext(handler.Filename))
-	allowedExtensions := map[string]bool{".jpg": true, ".jpeg": true, ".png": true}
-	if !allowedExtensions[fileExt] {
-		return "", fmt.Errorf("invalid file type. Only JPG and PNG are allowed")
-	}
-
-	fileName := fmt.Sprintf("group_%d%s", conversationID, fileExt)
-	savePath := filepath.Join("service/photos/groups", fileName)
-
-	if err := os.MkdirAll(filepath.Dir(savePath), os.ModePerm); err != nil {
-		return "", fmt.Errorf("unable to create directory: %w", err)
-	}
-
-	out, err := os.Create(savePath)
-	if err != nil {
-		return "", fmt.Errorf("unable to create file: %w", err)
-	}
-	defer out.Close()
-
-	if _, err := io.Copy(out, file); err != nil {
-		return "", fmt.Errorf("unable to save file: %w", err)
-	}
-
-	return fmt.Sprintf("/service/photos/groups/%s", fileName), nil
-}
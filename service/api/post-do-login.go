@@ -6,15 +6,20 @@ import (
 	"net/http"
 	"regexp"
 
+	"github.com/Nyheim99/WASAText/service/globaltime"
 	"github.com/julienschmidt/httprouter"
 )
 
+// maxUserAgentLength is the longest user agent stored for a session
+const maxUserAgentLength = 255
+
 type loginRequest struct {
 	Username string `json:"username"`
 }
 
 type loginResponse struct {
-	Identifier int64 `json:"identifier"`
+	Identifier int64  `json:"identifier"`
+	Token      string `json:"token"`
 }
 
 func (rt *_router) doLogin(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
@@ -37,7 +42,7 @@ func (rt *_router) doLogin(w http.ResponseWriter, r *http.Request, ps httprouter
 	}
 
 	//Check if username exists
-	identifier, err := rt.db.GetUserByUsername(request.Username)
+	identifier, err := rt.db.GetUserByUsername(r.Context(), request.Username)
 	if err != nil {
 		http.Error(w, "Failed to retrieve user from database", http.StatusInternalServerError)
 		return
@@ -45,17 +50,33 @@ func (rt *_router) doLogin(w http.ResponseWriter, r *http.Request, ps httprouter
 
 	//If it does not, create a new user
 	if identifier == 0 {
-		identifier, err = rt.db.CreateUser(request.Username)
+		identifier, err = rt.db.CreateUser(r.Context(), request.Username)
 		if err != nil {
 			http.Error(w, "Failed to create user", http.StatusInternalServerError)
 			return
 		}
 	}
 
-	//Return the identifier
-	response := loginResponse{Identifier: identifier}
+	//Start a new session for the user
+	token, tokenHash, err := newSessionToken()
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	userAgent := r.UserAgent()
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+	err = rt.db.CreateSession(r.Context(), identifier, tokenHash, userAgent, globaltime.Now().Add(rt.sessionLifetime))
+	if err != nil {
+		http.Error(w, "Failed to create session", http.StatusInternalServerError)
+		return
+	}
+
+	//Return the identifier and the session token
+	response := loginResponse{Identifier: identifier, Token: token}
 	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Authorization", fmt.Sprintf("Bearer %d", identifier))
+	w.Header().Set("Authorization", fmt.Sprintf("Bearer %s", token))
 	w.WriteHeader(http.StatusCreated)
 	err = json.NewEncoder(w).Encode(response)
 	if err != nil {
@@ -21,4 +21,7 @@ type RequestContext struct {
 
 	// UserID is the ID of the authenticated user
 	UserID int64
+
+	// SessionID is the ID of the session the request was authenticated with
+	SessionID int64
 }
@@ -0,0 +1,111 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Nyheim99/WASAText/service/api/reqcontext"
+	"github.com/Nyheim99/WASAText/service/database"
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	// defaultSearchPageSize is the amount of results returned when no limit is requested
+	defaultSearchPageSize = 20
+
+	// maxSearchPageSize is the largest page of results a client can request
+	maxSearchPageSize = 50
+
+	// maxSearchLength is the longest text which can be searched
+	maxSearchLength = 200
+)
+
+//Search the messages of the conversations of the user, best matches first
+func (rt *_router) searchMessages(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+
+	//Get user ID
+	reqCtx, ok := r.Context().Value("reqCtx").(*reqcontext.RequestContext)
+	if !ok || reqCtx == nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	//Validate the search and its filters
+	query := r.URL.Query()
+	text := strings.TrimSpace(query.Get("q"))
+	if text == "" || len(text) > maxSearchLength {
+		http.Error(w, "Invalid search", http.StatusBadRequest)
+		return
+	}
+
+	var filter database.SearchFilter
+	var err error
+	if conversation := query.Get("conversation"); conversation != "" {
+		filter.ConversationID, err = strconv.ParseInt(conversation, 10, 64)
+		if err != nil || filter.ConversationID <= 0 {
+			http.Error(w, "Invalid conversation ID", http.StatusBadRequest)
+			return
+		}
+
+		//Searching a conversation the user is not part of is refused, as reading it would be
+		err = rt.checkParticipant(r.Context(), filter.ConversationID, reqCtx.UserID)
+		var reqErr *requestError
+		if errors.As(err, &reqErr) {
+			http.Error(w, reqErr.message, reqErr.status)
+			return
+		} else if err != nil {
+			reqCtx.Logger.WithError(err).Error("can't check participant")
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+	if from := query.Get("from"); from != "" {
+		filter.SenderID, err = strconv.ParseInt(from, 10, 64)
+		if err != nil || filter.SenderID <= 0 {
+			http.Error(w, "Invalid sender ID", http.StatusBadRequest)
+			return
+		}
+	}
+	if before := query.Get("before"); before != "" {
+		filter.Before, err = time.Parse(time.RFC3339, before)
+		if err != nil {
+			http.Error(w, "Invalid before time", http.StatusBadRequest)
+			return
+		}
+	}
+
+	limit := defaultSearchPageSize
+	if limitStr := query.Get("limit"); limitStr != "" {
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit < 1 || limit > maxSearchPageSize {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+	offset := 0
+	if offsetStr := query.Get("offset"); offsetStr != "" {
+		offset, err = strconv.Atoi(offsetStr)
+		if err != nil || offset < 0 {
+			http.Error(w, "Invalid offset", http.StatusBadRequest)
+			return
+		}
+	}
+
+	page, err := rt.db.SearchMessages(r.Context(), reqCtx.UserID, text, filter, limit, offset)
+	if err != nil {
+		reqCtx.Logger.WithError(err).Error("can't search messages")
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(page); err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
@@ -1,20 +1,25 @@
 package api
 
 import (
-	"bytes"
 	"encoding/json"
-	"io"
+	"errors"
 	"net/http"
-	"path/filepath"
 	"regexp"
 	"strconv"
-	"strings"
 	"time"
 
 	"github.com/Nyheim99/WASAText/service/api/reqcontext"
 	"github.com/julienschmidt/httprouter"
 )
 
+// messageTextPattern is the characters text messages can be made of
+var messageTextPattern = regexp.MustCompile(`^[a-zA-Z0-9À-ÿ.,!?()\-\"' ]+$`)
+
+// validMessageText reports whether a text message can be sent
+func validMessageText(text string) bool {
+	return len(text) >= 1 && len(text) <= 1000 && messageTextPattern.MatchString(text)
+}
+
 type SendMessageResponse struct {
 	MessageID   int64  `json:"message_id"`
 	MessageType string `json:"message_type"`
@@ -35,8 +40,7 @@ func (rt *_router) sendMessage(w http.ResponseWriter, r *http.Request, ps httpro
 	}
 
 	//Validate the request
-	if err := r.ParseMultipartForm(10 << 20); err != nil {
-		http.Error(w, "Invalid request", http.StatusBadRequest)
+	if !parseUploadForm(w, r) {
 		return
 	}
 
@@ -52,37 +56,30 @@ func (rt *_router) sendMessage(w http.ResponseWriter, r *http.Request, ps httpro
 	message := r.FormValue("message")
 	var textContent *string
 	if message != "" {
+		if !validMessageText(message) {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
 		textContent = &message
 	}
 
-	//Get photo data, if provided
-	var photoData *[]byte
+	//Get photo, if provided
+	var photoKey *string
 	var photoMimeType *string
-	file, handler, err := r.FormFile("photo")
+	file, _, err := r.FormFile("photo")
 	if err == nil {
 		defer file.Close()
 
-		buf := new(bytes.Buffer)
-		if _, err := io.Copy(buf, file); err != nil {
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
-			return
-		}
-		data := buf.Bytes()
-		photoData = &data
-
-		mimeType := strings.ToLower(filepath.Ext(handler.Filename))
-		if mimeType == ".jpg" || mimeType == ".jpeg" {
-			mimeType = "image/jpeg"
-		} else if mimeType == ".png" {
-			mimeType = "image/png"
-		} else {
-			http.Error(w, "Invalid request", http.StatusBadRequest)
+		key, mimeType, err := rt.storeUploadedPhoto(r.Context(), file)
+		if err != nil {
+			rt.writePhotoError(w, err)
 			return
 		}
+		photoKey = &key
 		photoMimeType = &mimeType
 	}
 
-	if textContent == nil && photoData == nil {
+	if textContent == nil && photoKey == nil {
 		http.Error(w, "Invalid request", http.StatusBadRequest)
 		return
 	}
@@ -96,17 +93,28 @@ func (rt *_router) sendMessage(w http.ResponseWriter, r *http.Request, ps httpro
 			http.Error(w, "Invalid original_message_id", http.StatusBadRequest)
 			return
 		}
+
+		//Replies must stay within the conversation
+		var reqErr *requestError
+		err = rt.checkMessage(r.Context(), conversationID, originalMessageID)
+		if errors.As(err, &reqErr) {
+			http.Error(w, "Invalid original_message_id", http.StatusBadRequest)
+			return
+		} else if err != nil {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
 	}
 
 	//Send the message in the database
-	messageID, err := rt.db.SendMessage(conversationID, senderID, textContent, photoData, photoMimeType, originalMessageID)
+	messageID, err := rt.db.SendMessage(r.Context(), conversationID, senderID, textContent, photoKey, photoMimeType, originalMessageID)
 	if err != nil {
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
 	//Get sender ID
-	sender, err := rt.db.GetUser(senderID)
+	sender, err := rt.db.GetUser(r.Context(), senderID)
 	if err != nil {
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
@@ -120,21 +128,9 @@ func (rt *_router) sendMessage(w http.ResponseWriter, r *http.Request, ps httpro
 	messageType := "text"
 	var content string
 	if textContent != nil {
-
-		//Validate text message
 		content = *textContent
-
-		if len(*textContent) < 1 || len(*textContent) > 1000 {
-			http.Error(w, "Invalid request", http.StatusBadRequest)
-			return
-		}
-
-		if match, _ := regexp.MatchString(`^[a-zA-Z0-9À-ÿ.,!?()\-\"' ]+$`, *textContent); !match {
-			http.Error(w, "Invalid request", http.StatusBadRequest)
-			return
-		}
 	}
-	if photoData != nil {
+	if photoKey != nil {
 		messageType = "photo"
 	}
 
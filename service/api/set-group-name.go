@@ -46,7 +46,7 @@ func (rt *_router) setGroupName(w http.ResponseWriter, r *http.Request, ps httpr
 	}
 
 	//Set the group name in the database
-	err = rt.db.SetGroupName(convID, req.Name)
+	err = rt.db.SetGroupName(r.Context(), convID, req.Name)
 	if err != nil {
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
@@ -2,13 +2,8 @@ package api
 
 import (
 	"encoding/json"
-	"fmt"
-	"io"
 	"net/http"
-	"os"
-	"path/filepath"
 	"strconv"
-	"strings"
 
 	"github.com/julienschmidt/httprouter"
 )
@@ -29,13 +24,11 @@ func (rt *_router) setGroupPhoto(w http.ResponseWriter, r *http.Request, ps http
 	}
 
 	//Validate request
-	err = r.ParseMultipartForm(10 << 20)
-	if err != nil {
-		http.Error(w, "Invalid request", http.StatusBadRequest)
+	if !parseUploadForm(w, r) {
 		return
 	}
 
-	file, handler, err := r.FormFile("photo")
+	file, _, err := r.FormFile("photo")
 	if err != nil {
 		http.Error(w, "Invalid request", http.StatusBadRequest)
 		return
@@ -43,39 +36,16 @@ func (rt *_router) setGroupPhoto(w http.ResponseWriter, r *http.Request, ps http
 
 	defer file.Close()
 
-	allowedExtensions := map[string]bool{".jpg": true, ".jpeg": true, ".png": true}
-	fileExt := strings.ToLower(filepath.Ext(handler.Filename))
-	if !allowedExtensions[fileExt] {
-		http.Error(w, "Invalid request", http.StatusBadRequest)
-		return
-	}
-
 	//Save the uploaded group photo
-	fileName := fmt.Sprintf("group_%d%s", convID, fileExt)
-	savePath := filepath.Join("service/photos/groups", fileName)
-
-	err = os.MkdirAll("service/photos/groups", os.ModePerm)
-	if err != nil {
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return
-	}
-
-	out, err := os.Create(savePath)
+	key, _, err := rt.storeUploadedPhoto(r.Context(), file)
 	if err != nil {
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return
-	}
-	defer out.Close()
-
-	_, err = io.Copy(out, file)
-	if err != nil {
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		rt.writePhotoError(w, err)
 		return
 	}
 
-	photoURL := fmt.Sprintf("/service/photos/groups/%s", fileName)
+	photoURL := mediaURL(key)
 
-	err = rt.db.SetGroupPhoto(convID, photoURL)
+	err = rt.db.SetGroupPhoto(r.Context(), convID, photoURL)
 	if err != nil {
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
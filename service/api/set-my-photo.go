@@ -2,12 +2,7 @@ package api
 
 import (
 	"encoding/json"
-	"fmt"
-	"io"
 	"net/http"
-	"os"
-	"path/filepath"
-	"strings"
 
 	"github.com/Nyheim99/WASAText/service/api/reqcontext"
 	"github.com/julienschmidt/httprouter"
@@ -25,13 +20,11 @@ func (rt *_router) setMyPhoto(w http.ResponseWriter, r *http.Request, ps httprou
 	userID := reqCtx.UserID
 
 	//Validate request
-	err := r.ParseMultipartForm(10 << 20)
-	if err != nil {
-		http.Error(w, "Invalid file upload", http.StatusBadRequest)
+	if !parseUploadForm(w, r) {
 		return
 	}
 
-	file, handler, err := r.FormFile("photo")
+	file, _, err := r.FormFile("photo")
 	if err != nil {
 		http.Error(w, "Invalid file upload", http.StatusBadRequest)
 		return
@@ -39,39 +32,16 @@ func (rt *_router) setMyPhoto(w http.ResponseWriter, r *http.Request, ps httprou
 
 	defer file.Close()
 
-	allowedExtensions := map[string]bool{".jpg": true, ".jpeg": true, ".png": true}
-	fileExt := strings.ToLower(filepath.Ext(handler.Filename))
-	if !allowedExtensions[fileExt] {
-		http.Error(w, "Invalid file upload", http.StatusBadRequest)
-		return
-	}
-
 	//Save uploaded photo
-	fileName := fmt.Sprintf("user_%d%s", userID, fileExt)
-	savePath := filepath.Join("service/photos/users", fileName)
-
-	err = os.MkdirAll("service/photos/users", os.ModePerm)
-	if err != nil {
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return
-	}
-
-	out, err := os.Create(savePath)
+	key, _, err := rt.storeUploadedPhoto(r.Context(), file)
 	if err != nil {
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return
-	}
-	defer out.Close()
-
-	_, err = io.Copy(out, file)
-	if err != nil {
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		rt.writePhotoError(w, err)
 		return
 	}
 
-	photoURL := fmt.Sprintf("/service/photos/users/%s", fileName)
+	photoURL := mediaURL(key)
 
-	err = rt.db.SetMyPhoto(userID, photoURL)
+	err = rt.db.SetMyPhoto(r.Context(), userID, photoURL)
 	if err != nil {
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
@@ -41,7 +41,7 @@ func (rt *_router) setMyUserName(w http.ResponseWriter, r *http.Request, ps http
 	}
 
 	//Check if username is already taken
-	exists, err := rt.db.DoesUsernameExist(req.Username)
+	exists, err := rt.db.DoesUsernameExist(r.Context(), req.Username)
 	if err != nil {
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
@@ -52,7 +52,7 @@ func (rt *_router) setMyUserName(w http.ResponseWriter, r *http.Request, ps http
 	}
 
 	//Updates the username in the database
-	err = rt.db.SetMyUserName(userId, req.Username)
+	err = rt.db.SetMyUserName(r.Context(), userId, req.Username)
 	if err != nil {
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
@@ -2,5 +2,10 @@ package api
 
 // Close should close everything opened in the lifecycle of the `_router`; for example, background goroutines.
 func (rt *_router) Close() error {
+	//Let the subscribers handle the events already published, save the last seen times, then end the event streams,
+	//which the server doesn't track as they have taken over their connections
+	rt.bus.Close()
+	_ = rt.presence.Close()
+	rt.events.Close()
 	return nil
 }
@@ -32,7 +32,7 @@ func (rt *_router) uncommentMessage(w http.ResponseWriter, r *http.Request, ps h
 	}
 
 	//Update the message in the database
-	err = rt.db.UncommentMessage(messageID, userID)
+	err = rt.db.UncommentMessage(r.Context(), messageID, userID)
 	if err != nil {
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
@@ -0,0 +1,66 @@
+/*
+Package blobstore stores the media uploaded by users: profile pictures, group photos and message photos. Every blob is
+addressed by the SHA-256 of its content, so the same file uploaded twice is only stored once, and a key never changes
+meaning once handed out.
+
+To use this package, create a Store (e.g., with NewFilesystem) and pass it to the packages that need to save or load
+media. Only keys should be persisted elsewhere (e.g., in the database), never paths.
+
+Example:
+
+	blobs, err := blobstore.NewFilesystem(cfg.Storage.Directory)
+	if err != nil {
+		return fmt.Errorf("creating blob store: %w", err)
+	}
+
+	key, err := blobs.Put(file)
+	...
+	blob, err := blobs.Open(key)
+*/
+package blobstore
+
+import (
+	"errors"
+	"io"
+)
+
+// ErrNotFound is returned when there is no blob for a key
+var ErrNotFound = errors.New("blob not found")
+
+// Store is a content-addressed store for binary objects
+type Store interface {
+	// Put saves the content read from r and returns its key. Storing content that is already present returns the key
+	// of the existing blob.
+	Put(r io.Reader) (string, error)
+
+	// Open returns the blob stored under key, or ErrNotFound. The caller must close it.
+	Open(key string) (Blob, error)
+}
+
+// Lister is implemented by stores which can enumerate their blobs, e.g. to back them up
+type Lister interface {
+	// Keys calls fn with the key of every stored blob, stopping at the first error it returns
+	Keys(fn func(key string) error) error
+}
+
+// Blob is the content of a stored object
+type Blob interface {
+	io.ReadSeeker
+	io.Closer
+}
+
+// keyLength is the length of a key, the hex-encoded SHA-256 of the content
+const keyLength = 64
+
+// ValidKey reports whether key is well-formed. It does not check that the blob exists.
+func ValidKey(key string) bool {
+	if len(key) != keyLength {
+		return false
+	}
+	for _, c := range key {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
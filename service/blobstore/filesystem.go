@@ -0,0 +1,103 @@
+package blobstore
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+type filesystem struct {
+	root string
+}
+
+// NewFilesystem returns a Store that keeps blobs as files under the directory root, which is created if needed. Blobs
+// are sharded in sub-directories named after the first characters of their key.
+func NewFilesystem(root string) (Store, error) {
+	if root == "" {
+		return nil, errors.New("root directory is required when building a filesystem blob store")
+	}
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, fmt.Errorf("resolving blob store directory: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Join(root, "tmp"), 0o750); err != nil {
+		return nil, fmt.Errorf("creating blob store directory: %w", err)
+	}
+	return &filesystem{root: root}, nil
+}
+
+func (fs *filesystem) Put(r io.Reader) (string, error) {
+	// Write to a temporary file first, hashing while we go: the key is only known at the end
+	tmp, err := os.CreateTemp(filepath.Join(fs.root, "tmp"), "upload-*")
+	if err != nil {
+		return "", fmt.Errorf("creating temporary blob: %w", err)
+	}
+	defer func() {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+	}()
+
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(tmp, hash), r); err != nil {
+		return "", fmt.Errorf("writing blob: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		return "", fmt.Errorf("writing blob: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", fmt.Errorf("writing blob: %w", err)
+	}
+	key := hex.EncodeToString(hash.Sum(nil))
+
+	// Same content, same key: nothing else to do if we already have it
+	path := fs.path(key)
+	if _, err := os.Stat(path); err == nil {
+		return key, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return "", fmt.Errorf("creating blob directory: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", fmt.Errorf("storing blob: %w", err)
+	}
+	return key, nil
+}
+
+func (fs *filesystem) Open(key string) (Blob, error) {
+	if !ValidKey(key) {
+		return nil, ErrNotFound
+	}
+	f, err := os.Open(fs.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("opening blob: %w", err)
+	}
+	return f, nil
+}
+
+func (fs *filesystem) Keys(fn func(key string) error) error {
+	return filepath.WalkDir(fs.root, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		// Uploads in progress are not blobs yet
+		if d.IsDir() && path == filepath.Join(fs.root, "tmp") {
+			return filepath.SkipDir
+		}
+		if d.IsDir() || !ValidKey(d.Name()) {
+			return nil
+		}
+		return fn(d.Name())
+	})
+}
+
+// path returns where the blob for key is stored, e.g. <root>/ab/cd/abcd...
+func (fs *filesystem) path(key string) string {
+	return filepath.Join(fs.root, key[0:2], key[2:4], key)
+}
@@ -0,0 +1,395 @@
+package blobstore
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Nyheim99/WASAText/service/globaltime"
+)
+
+// Presigner is implemented by stores that can hand out temporary URLs, so that clients download blobs directly from
+// the storage service instead of through the API server
+type Presigner interface {
+	// PresignGet returns a URL where the blob stored under key can be downloaded without further authentication. If
+	// contentType is not empty, the storage service is asked to send it as the Content-Type of the response.
+	PresignGet(key string, contentType string) (string, error)
+}
+
+// S3Config is the configuration of an S3-compatible store
+type S3Config struct {
+	// Endpoint is the base URL of the service, e.g. https://s3.eu-south-1.amazonaws.com or http://localhost:9000
+	Endpoint string
+
+	// Region is the region requests are signed for
+	Region string
+
+	// Bucket is the bucket where blobs are stored. It must already exist.
+	Bucket string
+
+	// AccessKeyID and SecretAccessKey are the credentials used to sign requests
+	AccessKeyID     string
+	SecretAccessKey string
+
+	// PathStyle selects path-style URLs (endpoint/bucket/key) instead of virtual-hosted ones (bucket.endpoint/key).
+	// Most self-hosted services, like MinIO, need this.
+	PathStyle bool
+
+	// PresignExpiry is how long a presigned URL stays valid
+	PresignExpiry time.Duration
+
+	// Client is the HTTP client used to talk with the service. If nil, a client with a 30 seconds timeout is used.
+	Client *http.Client
+}
+
+type s3store struct {
+	cfg      S3Config
+	endpoint *url.URL
+	client   *http.Client
+}
+
+// NewS3 returns a Store that keeps blobs as objects in a bucket of an S3-compatible service. The returned Store also
+// implements Presigner and Lister.
+func NewS3(cfg S3Config) (Store, error) {
+	if cfg.Endpoint == "" || cfg.Bucket == "" {
+		return nil, errors.New("endpoint and bucket are required when building an S3 blob store")
+	}
+	if cfg.AccessKeyID == "" || cfg.SecretAccessKey == "" {
+		return nil, errors.New("credentials are required when building an S3 blob store")
+	}
+	endpoint, err := url.Parse(strings.TrimSuffix(cfg.Endpoint, "/"))
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid S3 endpoint %q", cfg.Endpoint)
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	if cfg.PresignExpiry <= 0 {
+		cfg.PresignExpiry = 15 * time.Minute
+	}
+	client := cfg.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	return &s3store{cfg: cfg, endpoint: endpoint, client: client}, nil
+}
+
+func (s *s3store) Put(r io.Reader) (string, error) {
+	// The key is the hash of the content, so the upload has to be spooled before it can be sent
+	tmp, err := os.CreateTemp("", "wasatext-upload-*")
+	if err != nil {
+		return "", fmt.Errorf("creating temporary blob: %w", err)
+	}
+	defer func() {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+	}()
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hash), r)
+	if err != nil {
+		return "", fmt.Errorf("writing blob: %w", err)
+	}
+	key := hex.EncodeToString(hash.Sum(nil))
+
+	// Same content, same key: nothing else to do if we already have it
+	resp, err := s.do(http.MethodHead, key, nil, nil, 0, emptyPayloadHash)
+	if err != nil {
+		return "", err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		return key, nil
+	} else if resp.StatusCode != http.StatusNotFound {
+		return "", fmt.Errorf("s3: checking object: unexpected status %s", resp.Status)
+	}
+
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return "", fmt.Errorf("reading temporary blob: %w", err)
+	}
+	// The payload hash to sign is the key itself
+	resp, err = s.do(http.MethodPut, key, nil, tmp, size, key)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("s3: storing object: %w", responseError(resp))
+	}
+	return key, nil
+}
+
+func (s *s3store) Open(key string) (Blob, error) {
+	if !ValidKey(key) {
+		return nil, ErrNotFound
+	}
+
+	resp, err := s.do(http.MethodGet, key, nil, nil, 0, emptyPayloadHash)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	} else if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("s3: reading object: %w", responseError(resp))
+	}
+
+	// Blobs must be seekable, and media are small enough to be kept in memory
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("s3: reading object: %w", err)
+	}
+	return memoryBlob{bytes.NewReader(data)}, nil
+}
+
+func (s *s3store) PresignGet(key string, contentType string) (string, error) {
+	if !ValidKey(key) {
+		return "", ErrNotFound
+	}
+
+	now := globaltime.Now().UTC()
+	u := s.objectURL(key)
+	query := url.Values{}
+	query.Set("X-Amz-Algorithm", signingAlgorithm)
+	query.Set("X-Amz-Credential", s.cfg.AccessKeyID+"/"+s.scope(now))
+	query.Set("X-Amz-Date", now.Format(amzDateFormat))
+	query.Set("X-Amz-Expires", strconv.Itoa(int(s.cfg.PresignExpiry.Seconds())))
+	query.Set("X-Amz-SignedHeaders", "host")
+	if contentType != "" {
+		query.Set("response-content-type", contentType)
+	}
+	u.RawQuery = canonicalQuery(query)
+
+	headers := map[string]string{"host": u.Host}
+	signature := s.signature(now, http.MethodGet, u, headers, unsignedPayload)
+	u.RawQuery += "&X-Amz-Signature=" + signature
+	return u.String(), nil
+}
+
+// Keys lists the objects of the bucket, a page of at most 1000 keys at a time. Objects whose name is not a key are
+// skipped.
+func (s *s3store) Keys(fn func(key string) error) error {
+	query := url.Values{"list-type": {"2"}}
+	for {
+		resp, err := s.do(http.MethodGet, "", query, nil, 0, emptyPayloadHash)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode != http.StatusOK {
+			err := responseError(resp)
+			_ = resp.Body.Close()
+			return fmt.Errorf("s3: listing objects: %w", err)
+		}
+
+		var page struct {
+			Contents []struct {
+				Key string
+			}
+			IsTruncated           bool
+			NextContinuationToken string
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&page)
+		_ = resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("s3: listing objects: %w", err)
+		}
+
+		for _, object := range page.Contents {
+			if !ValidKey(object.Key) {
+				continue
+			}
+			if err := fn(object.Key); err != nil {
+				return err
+			}
+		}
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			return nil
+		}
+		query.Set("continuation-token", page.NextContinuationToken)
+	}
+}
+
+// do sends a signed request for the object key, or for the bucket if key is empty
+func (s *s3store) do(method, key string, query url.Values, body io.Reader, size int64, payloadHash string) (*http.Response, error) {
+	now := globaltime.Now().UTC()
+	u := s.objectURL(key)
+	u.RawQuery = canonicalQuery(query)
+
+	req, err := http.NewRequest(method, u.String(), body)
+	if err != nil {
+		return nil, fmt.Errorf("s3: building request: %w", err)
+	}
+	req.ContentLength = size
+
+	headers := map[string]string{
+		"host":                 u.Host,
+		"x-amz-content-sha256": payloadHash,
+		"x-amz-date":           now.Format(amzDateFormat),
+	}
+	signedHeaders := signedHeaderNames(headers)
+	signature := s.signature(now, method, u, headers, payloadHash)
+
+	req.Header.Set("X-Amz-Content-Sha256", headers["x-amz-content-sha256"])
+	req.Header.Set("X-Amz-Date", headers["x-amz-date"])
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		signingAlgorithm, s.cfg.AccessKeyID, s.scope(now), signedHeaders, signature))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("s3: sending request: %w", err)
+	}
+	return resp, nil
+}
+
+// objectURL returns the URL of the object key, or of the bucket if key is empty, in path or virtual-hosted style
+func (s *s3store) objectURL(key string) *url.URL {
+	u := *s.endpoint
+	if s.cfg.PathStyle && key == "" {
+		u.Path = u.Path + "/" + s.cfg.Bucket
+	} else if s.cfg.PathStyle {
+		u.Path = u.Path + "/" + s.cfg.Bucket + "/" + key
+	} else {
+		u.Host = s.cfg.Bucket + "." + u.Host
+		u.Path = u.Path + "/" + key
+	}
+	return &u
+}
+
+const (
+	signingAlgorithm = "AWS4-HMAC-SHA256"
+	amzDateFormat    = "20060102T150405Z"
+	unsignedPayload  = "UNSIGNED-PAYLOAD"
+
+	// emptyPayloadHash is the SHA-256 of an empty body
+	emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+// scope returns the credential scope of a request signed at t
+func (s *s3store) scope(t time.Time) string {
+	return t.Format("20060102") + "/" + s.cfg.Region + "/s3/aws4_request"
+}
+
+// signature computes the AWS Signature Version 4 of a request. u must already carry the final query string, and
+// headers must contain every signed header with a lower-case name.
+func (s *s3store) signature(t time.Time, method string, u *url.URL, headers map[string]string, payloadHash string) string {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(headers[name]) + "\n")
+	}
+
+	canonicalRequest := strings.Join([]string{
+		method,
+		canonicalPath(u.Path),
+		u.RawQuery,
+		canonicalHeaders.String(),
+		strings.Join(names, ";"),
+		payloadHash,
+	}, "\n")
+
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		signingAlgorithm,
+		t.Format(amzDateFormat),
+		s.scope(t),
+		hex.EncodeToString(requestHash[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.cfg.SecretAccessKey), t.Format("20060102"))
+	key = hmacSHA256(key, s.cfg.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func signedHeaderNames(headers map[string]string) string {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ";")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	_, _ = mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// canonicalPath URI-encodes every segment of a path, as required by the signature
+func canonicalPath(path string) string {
+	if path == "" {
+		return "/"
+	}
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		segments[i] = uriEncode(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// canonicalQuery encodes a query string with sorted keys, as required by the signature
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		for _, v := range query[k] {
+			parts = append(parts, uriEncode(k)+"="+uriEncode(v))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// uriEncode percent-encodes everything but the unreserved characters of RFC 3986
+func uriEncode(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// responseError builds an error from an unexpected response, including the start of the body returned by the service
+func responseError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Errorf("unexpected status %s: %s", resp.Status, strings.TrimSpace(string(body)))
+}
+
+// memoryBlob is a Blob kept in memory
+type memoryBlob struct {
+	*bytes.Reader
+}
+
+func (memoryBlob) Close() error {
+	return nil
+}
@@ -0,0 +1,73 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// ErrBackupNotSupported is returned by Backup for databases which must be backed up with their own tools, like
+// pg_dump for PostgreSQL
+var ErrBackupNotSupported = errors.New("online backup is only supported for SQLite databases")
+
+// Backup writes a consistent snapshot of the database to the file at path, which must not exist. The database can be in
+// use while the snapshot is taken.
+func Backup(ctx context.Context, db *sql.DB, driver string, path string) error {
+	c, err := newConn(db, driver)
+	if err != nil {
+		return err
+	}
+	if c.driver != DriverSQLite {
+		return ErrBackupNotSupported
+	}
+
+	// VACUUM INTO reads the database in a single transaction, and writes a compacted copy of it
+	if _, err := c.ExecContext(ctx, `VACUUM INTO ?`, path); err != nil {
+		return fmt.Errorf("writing snapshot: %w", err)
+	}
+	return nil
+}
+
+// CheckIntegrity verifies that the database is not corrupted, that every row references rows which exist, and that its
+// schema is one this build knows about. It returns the migration status of the database.
+func CheckIntegrity(ctx context.Context, db *sql.DB, driver string) ([]MigrationStatus, error) {
+	c, err := newConn(db, driver)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.driver == DriverSQLite {
+		rows, err := c.QueryContext(ctx, `PRAGMA integrity_check`)
+		if err != nil {
+			return nil, fmt.Errorf("checking integrity: %w", err)
+		}
+		var problems []string
+		for rows.Next() {
+			var result string
+			if err := rows.Scan(&result); err != nil {
+				_ = rows.Close()
+				return nil, fmt.Errorf("checking integrity: %w", err)
+			}
+			if result != "ok" {
+				problems = append(problems, result)
+			}
+		}
+		_ = rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("checking integrity: %w", err)
+		}
+		if len(problems) > 0 {
+			return nil, fmt.Errorf("database is corrupted: %s", problems[0])
+		}
+
+		err = withTx(ctx, c, func(tx *txConn) error {
+			return checkForeignKeys(ctx, tx)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return migrationStatus(ctx, c)
+}
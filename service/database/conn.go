@@ -0,0 +1,109 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Drivers supported by the package, by the name they are registered with in database/sql
+const (
+	DriverSQLite   = "sqlite3"
+	DriverPostgres = "postgres"
+)
+
+// sqlConn is implemented by both *sql.DB and *sql.Conn, so that conn can also wrap a single connection of the pool
+type sqlConn interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+	PingContext(ctx context.Context) error
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+}
+
+// conn is a connection to the database. Queries are written once, with `?` placeholders and SQL understood by every
+// supported database; conn rewrites the placeholders for the driver in use.
+type conn struct {
+	db     sqlConn
+	driver string
+}
+
+func newConn(db sqlConn, driver string) (*conn, error) {
+	switch driver {
+	case "":
+		driver = DriverSQLite
+	case DriverSQLite, DriverPostgres:
+	default:
+		return nil, fmt.Errorf("unsupported database driver %q", driver)
+	}
+	return &conn{db: db, driver: driver}, nil
+}
+
+// rebind replaces the `?` placeholders of query with the ones of the driver
+func (c *conn) rebind(query string) string {
+	if c.driver != DriverPostgres {
+		return query
+	}
+
+	var b strings.Builder
+	b.Grow(len(query) + 16)
+	n := 0
+	inString := false
+	for i := 0; i < len(query); i++ {
+		ch := query[i]
+		if ch == '\'' {
+			inString = !inString
+		} else if ch == '?' && !inString {
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+			continue
+		}
+		b.WriteByte(ch)
+	}
+	return b.String()
+}
+
+func (c *conn) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return c.db.ExecContext(ctx, c.rebind(query), args...)
+}
+
+func (c *conn) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return c.db.QueryContext(ctx, c.rebind(query), args...)
+}
+
+func (c *conn) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return c.db.QueryRowContext(ctx, c.rebind(query), args...)
+}
+
+func (c *conn) PingContext(ctx context.Context) error {
+	return c.db.PingContext(ctx)
+}
+
+func (c *conn) BeginTx(ctx context.Context) (*txConn, error) {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &txConn{tx: tx, conn: c}, nil
+}
+
+// txConn is a transaction on a conn, see withTx
+type txConn struct {
+	tx   *sql.Tx
+	conn *conn
+}
+
+func (t *txConn) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return t.tx.ExecContext(ctx, t.conn.rebind(query), args...)
+}
+
+func (t *txConn) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return t.tx.QueryContext(ctx, t.conn.rebind(query), args...)
+}
+
+func (t *txConn) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return t.tx.QueryRowContext(ctx, t.conn.rebind(query), args...)
+}
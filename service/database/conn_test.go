@@ -0,0 +1,62 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+)
+
+func TestRebind(t *testing.T) {
+	tests := []struct {
+		query, postgres string
+	}{
+		{`SELECT 1`, `SELECT 1`},
+		{`SELECT * FROM t WHERE a = ? AND b = ?`, `SELECT * FROM t WHERE a = $1 AND b = $2`},
+		{`SELECT '?' FROM t WHERE a = ?`, `SELECT '?' FROM t WHERE a = $1`},
+		{`SELECT 'it''s?', ? FROM t`, `SELECT 'it''s?', $1 FROM t`},
+		{`VALUES (?, ?), (?, ?)`, `VALUES ($1, $2), ($3, $4)`},
+	}
+	for _, tt := range tests {
+		sqlite := conn{driver: DriverSQLite}
+		if got := sqlite.rebind(tt.query); got != tt.query {
+			t.Errorf("SQLite rebind(%q) = %q, want it unchanged", tt.query, got)
+		}
+		postgres := conn{driver: DriverPostgres}
+		if got := postgres.rebind(tt.query); got != tt.postgres {
+			t.Errorf("PostgreSQL rebind(%q) = %q, want %q", tt.query, got, tt.postgres)
+		}
+	}
+}
+
+func TestInsertReturning(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, driver string, sqldb *sql.DB) {
+		f := newFixture(t, driver, sqldb)
+		ctx := context.Background()
+
+		carol, err := f.db.CreateUser(ctx, "carol")
+		if err != nil || carol != f.bob+1 {
+			t.Errorf("CreateUser returned %d (%v), want %d", carol, err, f.bob+1)
+		}
+
+		groupID, err := f.db.CreateGroupConversation(ctx, f.alice, "friends", "", []int64{f.bob, carol})
+		if err != nil || groupID != f.conversationID+1 {
+			t.Errorf("CreateGroupConversation returned %d (%v), want %d", groupID, err, f.conversationID+1)
+		}
+
+		first := f.send(t, f.alice, "hello", 0)
+		reply := f.send(t, f.bob, "hi", first)
+		if reply != first+1 {
+			t.Errorf("SendMessage returned %d, want %d", reply, first+1)
+		}
+		forwarded, err := f.db.ForwardMessage(ctx, groupID, f.alice, first)
+		if err != nil || forwarded != reply+1 {
+			t.Errorf("ForwardMessage returned %d (%v), want %d", forwarded, err, reply+1)
+		}
+
+		//Only the messages which weren't delivered yet are returned
+		delivered, err := f.db.MarkMessagesDelivered(ctx, f.conversationID, f.bob, []int64{first, reply})
+		if err != nil || len(delivered) != 1 || delivered[0] != first {
+			t.Errorf("MarkMessagesDelivered returned %v (%v), want [%d]", delivered, err, first)
+		}
+	})
+}
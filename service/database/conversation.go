@@ -1,99 +1,119 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
+	"time"
 )
 
-//Checks if a private conversaiton exists, if not then creates a new one
-func (db *appdbimpl) CreatePrivateConversation(userID, recipientID int64) (int64, error) {
-	
-	//Check if a conversation already exists
-	var existingConversationID int64
-	err := db.c.QueryRow(`
-		SELECT c.id 
-		FROM conversations c
-		JOIN conversation_participants cp1 ON c.id = cp1.conversation_id
-		JOIN conversation_participants cp2 ON c.id = cp2.conversation_id
-		WHERE c.conversation_type = 'private' 
-		AND cp1.user_id = ? 
-		AND cp2.user_id = ?
-	`, userID, recipientID).Scan(&existingConversationID)
-
-	if err == nil {
-		return existingConversationID, fmt.Errorf("a private conversation between these users already exists")
-	} else if !errors.Is(err, sql.ErrNoRows) {
-		return 0, fmt.Errorf("failed to check for existing conversation: %w", err)
-	}
+// ErrConversationNotFound is returned when a conversation does not exist
+var ErrConversationNotFound = errors.New("conversation not found")
 
-	//If no conversation already exists, create a new one
-	result, err := db.c.Exec(`
-		INSERT INTO conversations (conversation_type) VALUES ('private')
-	`)
-	if err != nil {
-		return 0, fmt.Errorf("failed to create conversation: %w", err)
-	}
+//Checks if a private conversaiton exists, if not then creates a new one
+func (db *appdbimpl) CreatePrivateConversation(ctx context.Context, userID, recipientID int64) (int64, error) {
+	ctx, cancel := db.timeout(ctx)
+	defer cancel()
+
+	var conversationID, existingConversationID int64
+
+	err := withTx(ctx, db.c, func(tx *txConn) error {
+
+		//Check if a conversation already exists
+		err := tx.QueryRowContext(ctx, `
+			SELECT c.id 
+			FROM conversations c
+			JOIN conversation_participants cp1 ON c.id = cp1.conversation_id
+			JOIN conversation_participants cp2 ON c.id = cp2.conversation_id
+			WHERE c.conversation_type = 'private' 
+			AND cp1.user_id = ? 
+			AND cp2.user_id = ?
+		`, userID, recipientID).Scan(&existingConversationID)
+
+		if err == nil {
+			return fmt.Errorf("a private conversation between these users already exists")
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("failed to check for existing conversation: %w", err)
+		}
 
-	var conversationID int64
+		//If no conversation already exists, create a new one
+		err = tx.QueryRowContext(ctx, `
+			INSERT INTO conversations (conversation_type) VALUES ('private') RETURNING id
+		`).Scan(&conversationID)
+		if err != nil {
+			return fmt.Errorf("failed to create conversation: %w", err)
+		}
 
-	conversationID, err = result.LastInsertId()
-	if err != nil {
-		return 0, fmt.Errorf("failed to retrieve conversation ID: %w", err)
-	}
+		//Insert participants
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO conversation_participants (conversation_id, user_id)
+			VALUES (?, ?), (?, ?)
+		`, conversationID, recipientID, conversationID, userID)
+		if err != nil {
+			return fmt.Errorf("failed to add participants: %w", err)
+		}
 
-	//Insert participants
-	_, err = db.c.Exec(`
-		INSERT INTO conversation_participants (conversation_id, user_id)
-		VALUES (?, ?), (?, ?)
-	`, conversationID, recipientID, conversationID, userID)
+		return nil
+	})
 	if err != nil {
-		return 0, fmt.Errorf("failed to add participants: %w", err)
+		return existingConversationID, err
 	}
 
 	return conversationID, nil
 }
 
 //Creates a new group conversation
-func (db *appdbimpl) CreateGroupConversation(creatorID int64, name, photoURL string, participants []int64) (int64, error) {
-	
-	//Create a new group conversation
-	result, err := db.c.Exec(`
-		INSERT INTO conversations (conversation_type, name, photo_url)
-		VALUES ('group', ?, ?)
-	`, name, photoURL)
-	if err != nil {
-		return 0, fmt.Errorf("failed to create group conversation: %w", err)
-	}
+func (db *appdbimpl) CreateGroupConversation(ctx context.Context, creatorID int64, name, photoURL string, participants []int64) (int64, error) {
+	ctx, cancel := db.timeout(ctx)
+	defer cancel()
 
-	conversationID, err := result.LastInsertId()
-	if err != nil {
-		return 0, fmt.Errorf("failed to retrieve conversation ID: %w", err)
-	}
+	var conversationID int64
 
-	//Insert participants
-	participantValues := ""
-	args := []interface{}{}
-	for _, participantID := range participants {
-		participantValues += "(?, ?),"
-		args = append(args, conversationID, participantID)
-	}
-	participantValues += "(?, ?)"
-	args = append(args, conversationID, creatorID)
+	err := withTx(ctx, db.c, func(tx *txConn) error {
+
+		//Create a new group conversation
+		err := tx.QueryRowContext(ctx, `
+			INSERT INTO conversations (conversation_type, name, photo_url)
+			VALUES ('group', ?, ?)
+			RETURNING id
+		`, name, photoURL).Scan(&conversationID)
+		if err != nil {
+			return fmt.Errorf("failed to create group conversation: %w", err)
+		}
+
+		//Insert participants
+		participantValues := ""
+		args := []interface{}{}
+		for _, participantID := range participants {
+			participantValues += "(?, ?),"
+			args = append(args, conversationID, participantID)
+		}
+		participantValues += "(?, ?)"
+		args = append(args, conversationID, creatorID)
+
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO conversation_participants (conversation_id, user_id)
+			VALUES `+participantValues, args...)
+		if err != nil {
+			return fmt.Errorf("failed to add participants: %w", err)
+		}
 
-	_, err = db.c.Exec(`
-		INSERT INTO conversation_participants (conversation_id, user_id)
-		VALUES `+participantValues, args...)
+		return nil
+	})
 	if err != nil {
-		return 0, fmt.Errorf("failed to add participants: %w", err)
+		return 0, err
 	}
 
 	return conversationID, nil
 }
 
 //Updates a group's name
-func (db *appdbimpl) SetGroupName(conversationID int64, name string) error {
-	_, err := db.c.Exec(
+func (db *appdbimpl) SetGroupName(ctx context.Context, conversationID int64, name string) error {
+	ctx, cancel := db.timeout(ctx)
+	defer cancel()
+
+	_, err := db.c.ExecContext(ctx, 
 		`UPDATE conversations SET name = ? WHERE id = ? AND conversation_type = 'group'`,
 		name, conversationID,
 	)
@@ -104,9 +124,12 @@ func (db *appdbimpl) SetGroupName(conversationID int64, name string) error {
 }
 
 //Updates a group's photo
-func (db *appdbimpl) SetGroupPhoto(conversationID int64, photoURL string) error {
-	_, err := db.c.Exec(
-		`UPDATE conversations SET photo_url = $1 WHERE id = $2`,
+func (db *appdbimpl) SetGroupPhoto(ctx context.Context, conversationID int64, photoURL string) error {
+	ctx, cancel := db.timeout(ctx)
+	defer cancel()
+
+	_, err := db.c.ExecContext(ctx, 
+		`UPDATE conversations SET photo_url = ? WHERE id = ?`,
 		photoURL, conversationID,
 	)
 	if err != nil {
@@ -115,22 +138,103 @@ func (db *appdbimpl) SetGroupPhoto(conversationID int64, photoURL string) error
 	return nil
 }
 
+//Checks if a user is a participant of a conversation, returns ErrConversationNotFound if the conversation does not exist
+func (db *appdbimpl) IsParticipant(ctx context.Context, conversationID, userID int64) (bool, error) {
+	ctx, cancel := db.timeout(ctx)
+	defer cancel()
+
+	var conversationExists, isParticipant bool
+	err := db.c.QueryRowContext(ctx, `
+		SELECT
+			EXISTS(SELECT 1 FROM conversations WHERE id = ?),
+			EXISTS(SELECT 1 FROM conversation_participants WHERE conversation_id = ? AND user_id = ?)
+	`, conversationID, conversationID, userID).Scan(&conversationExists, &isParticipant)
+	if err != nil {
+		return false, fmt.Errorf("failed to check conversation membership: %w", err)
+	}
+	if !conversationExists {
+		return false, ErrConversationNotFound
+	}
+	return isParticipant, nil
+}
+
+//Get the identifiers of the participants of a conversation
+func (db *appdbimpl) GetParticipantIDs(ctx context.Context, conversationID int64) ([]int64, error) {
+	ctx, cancel := db.timeout(ctx)
+	defer cancel()
+
+	rows, err := db.c.QueryContext(ctx, `
+		SELECT user_id FROM conversation_participants WHERE conversation_id = ?
+	`, conversationID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve participants: %w", err)
+	}
+	defer rows.Close()
+
+	var participantIDs []int64
+	for rows.Next() {
+		var userID int64
+		if err := rows.Scan(&userID); err != nil {
+			return nil, fmt.Errorf("failed to scan participant: %w", err)
+		}
+		participantIDs = append(participantIDs, userID)
+	}
+	return participantIDs, rows.Err()
+}
+
+//Get the users who share a conversation with a user
+func (db *appdbimpl) GetContactIDs(ctx context.Context, userID int64) ([]int64, error) {
+	ctx, cancel := db.timeout(ctx)
+	defer cancel()
+
+	rows, err := db.c.QueryContext(ctx, `
+		SELECT DISTINCT other.user_id
+		FROM conversation_participants mine
+		JOIN conversation_participants other ON other.conversation_id = mine.conversation_id
+		WHERE mine.user_id = ? AND other.user_id != ?
+	`, userID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve contacts: %w", err)
+	}
+	defer rows.Close()
+
+	var contactIDs []int64
+	for rows.Next() {
+		var contactID int64
+		if err := rows.Scan(&contactID); err != nil {
+			return nil, fmt.Errorf("failed to scan contact: %w", err)
+		}
+		contactIDs = append(contactIDs, contactID)
+	}
+	return contactIDs, rows.Err()
+}
+
 type ConversationPreview struct {
-	ConversationID       int64   `json:"conversation_id"`
-	ConversationType     string  `json:"conversation_type"`
-	DisplayName          string  `json:"display_name"`
-	DisplayPhotoURL      string  `json:"display_photo_url"`
-	LastMessageID        int64   `json:"last_message_id"`
-	LastMessageContent   *string `json:"last_message_content,omitempty"`
-	LastMessageHasPhoto  bool    `json:"last_message_has_photo"`
-	LastMessageTimestamp string  `json:"last_message_timestamp"`
-	LastMessageSenderID  int64   `json:"last_message_sender_id,omitempty"`
-	LastMessageSender    string  `json:"last_message_sender,omitempty"`
-	LastMessageIsDeleted bool    `json:"last_message_is_deleted"`
+	ConversationID         int64             `json:"conversation_id"`
+	ConversationType       string            `json:"conversation_type"`
+	DisplayName            string            `json:"display_name"`
+	DisplayPhotoURL        string            `json:"display_photo_url"`
+	DisplayPhotoThumbnails map[string]string `json:"display_photo_thumbnails,omitempty"`
+	LastMessageID          int64             `json:"last_message_id"`
+	LastMessageContent     *string           `json:"last_message_content,omitempty"`
+	LastMessageHasPhoto    bool              `json:"last_message_has_photo"`
+	LastMessageTimestamp   string            `json:"last_message_timestamp"`
+	LastMessageSenderID    int64             `json:"last_message_sender_id,omitempty"`
+	LastMessageSender      string            `json:"last_message_sender,omitempty"`
+	LastMessageIsDeleted   bool              `json:"last_message_is_deleted"`
+
+	// PeerID is the other participant of a private conversation. Presence is theirs, and is filled in by the API as
+	// for User.
+	PeerID   int64      `json:"peer_id,omitempty"`
+	LastSeen *time.Time `json:"last_seen,omitempty"`
+	Presence string     `json:"presence,omitempty"`
 }
 
-//Get all of a user's conversations
-func (db *appdbimpl) GetMyConversations(userID int64) ([]ConversationPreview, error) {
+//Get all of a user's conversations, with the last message they can see in each
+func (db *appdbimpl) GetMyConversations(ctx context.Context, userID int64) ([]ConversationPreview, error) {
+
+	ctx, cancel := db.timeout(ctx)
+	defer cancel()
 
 	//Fetch conversations
 	query := `
@@ -146,18 +250,31 @@ func (db *appdbimpl) GetMyConversations(userID int64) ([]ConversationPreview, er
 				ELSE c.photo_url
 			END AS display_photo_url,
 			m.id AS last_message_id,  -- Retrieve last message ID
-			m.content AS last_message_content,
-			CASE WHEN m.photo_data IS NOT NULL THEN 1 ELSE 0 END AS last_message_has_photo,
-			COALESCE(m.timestamp, '1970-01-01T00:00:00Z') AS last_message_timestamp,
+			CASE WHEN m.is_deleted THEN NULL ELSE m.content END AS last_message_content,
+			CASE WHEN m.photo_key IS NOT NULL THEN 1 ELSE 0 END AS last_message_has_photo,
+			m.timestamp AS last_message_timestamp,
 			m.sender_id AS last_message_sender_id,
 			sender.username AS last_message_sender,
-			CASE WHEN m.is_deleted = 1 THEN 1 ELSE 0 END AS last_message_is_deleted
+			CASE WHEN m.is_deleted THEN 1 ELSE 0 END AS last_message_is_deleted,
+			CASE WHEN c.conversation_type = 'private' THEN u.id END AS peer_id,
+			CASE WHEN c.conversation_type = 'private' THEN u.last_seen_at END AS peer_last_seen_at
 		FROM 
 			conversations c
 		JOIN 
 			conversation_participants cp ON c.id = cp.conversation_id
 		LEFT JOIN 
-			messages m ON c.last_message_id = m.id
+			messages m ON m.id = CASE
+				WHEN NOT EXISTS (
+					SELECT 1 FROM hidden_messages h WHERE h.message_id = c.last_message_id AND h.user_id = cp.user_id
+				) THEN c.last_message_id
+				-- The last message is hidden from the user, show the last one they can see
+				ELSE (
+					SELECT MAX(m2.id) FROM messages m2
+					WHERE m2.conversation_id = c.id AND NOT EXISTS (
+						SELECT 1 FROM hidden_messages h WHERE h.message_id = m2.id AND h.user_id = cp.user_id
+					)
+				)
+			END
 		LEFT JOIN 
 			users u ON u.id = (
 				SELECT cp2.user_id
@@ -170,11 +287,11 @@ func (db *appdbimpl) GetMyConversations(userID int64) ([]ConversationPreview, er
 		WHERE 
 			cp.user_id = ?
 		ORDER BY 
-    	m.timestamp DESC
+    	m.timestamp DESC NULLS LAST
 		LIMIT 50;
 	`
 
-	rows, err := db.c.Query(query, userID, userID)
+	rows, err := db.c.QueryContext(ctx, query, userID, userID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query conversations: %w", err)
 	}
@@ -188,7 +305,10 @@ func (db *appdbimpl) GetMyConversations(userID int64) ([]ConversationPreview, er
 		var lastMessageSenderID sql.NullInt64
 		var lastMessageSender sql.NullString
 		var lastMessageIsDeleted int
-		var lastMessageID int64
+		var lastMessageID sql.NullInt64
+		var lastMessageTimestamp sql.NullTime
+		var peerID sql.NullInt64
+		var peerLastSeen sql.NullInt64
 
 		if err := rows.Scan(
 			&conversation.ConversationID,
@@ -198,17 +318,27 @@ func (db *appdbimpl) GetMyConversations(userID int64) ([]ConversationPreview, er
 			&lastMessageID,
 			&conversation.LastMessageContent,
 			&lastMessageHasPhoto,
-			&conversation.LastMessageTimestamp,
+			&lastMessageTimestamp,
 			&lastMessageSenderID,
 			&lastMessageSender,
 			&lastMessageIsDeleted,
+			&peerID,
+			&peerLastSeen,
 		); err != nil {
 			return nil, fmt.Errorf("failed to scan conversation row: %w", err)
 		}
 
 		conversation.LastMessageHasPhoto = lastMessageHasPhoto == 1
 		conversation.LastMessageIsDeleted = lastMessageIsDeleted == 1
-		conversation.LastMessageID = lastMessageID
+		conversation.LastMessageID = lastMessageID.Int64
+		conversation.PeerID = peerID.Int64
+		conversation.LastSeen = unixTime(peerLastSeen)
+
+		//Conversations without messages report the epoch as the time of their last message
+		if !lastMessageTimestamp.Valid {
+			lastMessageTimestamp.Time = time.Unix(0, 0)
+		}
+		conversation.LastMessageTimestamp = lastMessageTimestamp.Time.UTC().Format(time.RFC3339)
 
 		if lastMessageSenderID.Valid {
 			conversation.LastMessageSenderID = lastMessageSenderID.Int64
@@ -231,16 +361,18 @@ type ConversationDetails struct {
 	DisplayName      string    `json:"display_name"`
 	PhotoURL         string    `json:"display_photo_url"`
 	Participants     []User    `json:"participants,omitempty"`
-	Messages         []Message `json:"messages,omitempty"`
 }
 
-//Get the details of a conversation
-func (db *appdbimpl) GetConversation(conversationID int64) (*ConversationDetails, error) {
+//Get the details of a conversation, without its messages
+func (db *appdbimpl) GetConversation(ctx context.Context, conversationID int64) (*ConversationDetails, error) {
 	
+	ctx, cancel := db.timeout(ctx)
+	defer cancel()
+
 	//Fetch conversation
 	var conversation ConversationDetails
 
-	err := db.c.QueryRow(`
+	err := db.c.QueryRowContext(ctx, `
 		SELECT id, conversation_type, name, photo_url
 		FROM conversations
 		WHERE id = ?`, conversationID).Scan(
@@ -250,131 +382,15 @@ func (db *appdbimpl) GetConversation(conversationID int64) (*ConversationDetails
 		&conversation.PhotoURL,
 	)
 	if errors.Is(err, sql.ErrNoRows) {
-		return nil, fmt.Errorf("conversation not found")
+		return nil, ErrConversationNotFound
 	} else if err != nil {
 		return nil, fmt.Errorf("failed to retrieve conversation: %w", err)
 	}
 
-	// Fetch messages
-	messageRows, err := db.c.Query(`
-		SELECT 
-			m.id, m.conversation_id, m.sender_id, u.username, 
-			m.content, m.photo_data, m.photo_mime_type, m.timestamp, m.status, 
-			m.is_reply, m.original_message_id, 
-			m.is_forwarded, m.is_deleted,
-			COALESCE(om.content, '[Photo Message]') AS original_message_content,
-    	COALESCE(ou.username, 'Unknown') AS original_message_sender
-	FROM messages m
-	JOIN users u ON m.sender_id = u.id
-	LEFT JOIN messages om ON m.original_message_id = om.id
-	LEFT JOIN users ou ON om.sender_id = ou.id
-	WHERE m.conversation_id = ?
-	ORDER BY m.timestamp ASC`, conversationID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to retrieve messages: %w", err)
-	}
-	defer messageRows.Close()
-
-	messages := []Message{}
-	for messageRows.Next() {
-		var msg Message
-		var originalMessageContent sql.NullString
-		var originalMessageSender sql.NullString
-		var photoData []byte
-		var photoMimeType sql.NullString
-
-		err := messageRows.Scan(
-			&msg.ID,
-			&msg.ConversationID,
-			&msg.SenderID,
-			&msg.SenderUsername,
-			&msg.Content,
-			&photoData,
-			&photoMimeType,
-			&msg.Timestamp,
-			&msg.Status,
-			&msg.IsReply,
-			&msg.OriginalMessageID,
-			&msg.IsForwarded,
-			&msg.IsDeleted,
-			&originalMessageContent,
-			&originalMessageSender,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan message: %w", err)
-		}
-
-		if len(photoData) > 0 {
-			msg.PhotoData = &photoData
-		}
-		if photoMimeType.Valid {
-			msg.PhotoMimeType = &photoMimeType.String
-		}
-
-		if msg.IsReply && originalMessageContent.Valid {
-			msg.OriginalMessage = &OriginalMessage{
-				ID:      msg.OriginalMessageID,
-				Content: originalMessageContent.String,
-				Sender:  originalMessageSender.String,
-			}
-		}
-
-		//Check if message is read by everyone
-		var readCount int
-		err = db.c.QueryRow(`
-			SELECT COUNT(*) 
-			FROM message_status 
-			WHERE message_id = ? AND is_read = TRUE
-		`, msg.ID).Scan(&readCount)
-		if err != nil {
-			return nil, fmt.Errorf("failed to retrieve message status: %w", err)
-		}
-
-		var participantCount int
-		err = db.c.QueryRow(`
-			SELECT COUNT(*) 
-			FROM conversation_participants 
-			WHERE conversation_id = ?
-		`, conversationID).Scan(&participantCount)
-		if err != nil {
-			return nil, fmt.Errorf("failed to retrieve participant count: %w", err)
-		}
-
-		if readCount == participantCount {
-			msg.Status = "read"
-		} else {
-			msg.Status = "sent"
-		}
-
-		//Fetch reactions
-		reactionRows, err := db.c.Query(`
-			SELECT user_id, message_id, emoticon
-			FROM reactions
-			WHERE message_id = ?`, msg.ID)
-		if err != nil {
-			return nil, fmt.Errorf("failed to retrieve reactions: %w", err)
-		}
-		defer reactionRows.Close()
-
-		reactions := []Reaction{}
-		for reactionRows.Next() {
-			var reaction Reaction
-			if err := reactionRows.Scan(&reaction.UserID, &reaction.MessageID, &reaction.Emoticon); err != nil {
-				return nil, fmt.Errorf("failed to scan reaction: %w", err)
-			}
-			reactions = append(reactions, reaction)
-		}
-		msg.Reactions = reactions
-
-		messages = append(messages, msg)
-	}
-
-	conversation.Messages = messages
-
 	//If its a group conversation, also get all participants
 	if conversation.ConversationType == "group" {
-		participantRows, err := db.c.Query(`
-        SELECT id, username, photo_url 
+		participantRows, err := db.c.QueryContext(ctx, `
+        SELECT id, username, photo_url, last_seen_at
         FROM users 
         WHERE id IN (
             SELECT user_id FROM conversation_participants WHERE conversation_id = ?
@@ -387,10 +403,12 @@ func (db *appdbimpl) GetConversation(conversationID int64) (*ConversationDetails
 		participants := []User{}
 		for participantRows.Next() {
 			var user User
-			err := participantRows.Scan(&user.ID, &user.Username, &user.PhotoURL)
+			var lastSeen sql.NullInt64
+			err := participantRows.Scan(&user.ID, &user.Username, &user.PhotoURL, &lastSeen)
 			if err != nil {
 				return nil, fmt.Errorf("failed to scan participant: %w", err)
 			}
+			user.LastSeen = unixTime(lastSeen)
 			participants = append(participants, user)
 		}
 
@@ -401,98 +419,106 @@ func (db *appdbimpl) GetConversation(conversationID int64) (*ConversationDetails
 }
 
 //Add new members to a group
-func (db *appdbimpl) AddToGroup(conversationID int64, newParticipants []int64) error {
+func (db *appdbimpl) AddToGroup(ctx context.Context, conversationID int64, newParticipants []int64) error {
+	ctx, cancel := db.timeout(ctx)
+	defer cancel()
+
 	if len(newParticipants) == 0 {
 		return fmt.Errorf("no participants to add")
 	}
 
-	var conversationType string
-	err := db.c.QueryRow(`
-		SELECT conversation_type FROM conversations WHERE id = ?
-	`, conversationID).Scan(&conversationType)
+	return withTx(ctx, db.c, func(tx *txConn) error {
+		var conversationType string
+		err := tx.QueryRowContext(ctx, `
+			SELECT conversation_type FROM conversations WHERE id = ?
+		`, conversationID).Scan(&conversationType)
 
-	if errors.Is(err, sql.ErrNoRows) {
-		return fmt.Errorf("conversation does not exist")
-	} else if err != nil {
-		return fmt.Errorf("failed to retrieve conversation: %w", err)
-	}
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("conversation does not exist")
+		} else if err != nil {
+			return fmt.Errorf("failed to retrieve conversation: %w", err)
+		}
 
-	if conversationType != "group" {
-		return fmt.Errorf("cannot add members to a private conversation")
-	}
+		if conversationType != "group" {
+			return fmt.Errorf("cannot add members to a private conversation")
+		}
 
-	query := "INSERT INTO conversation_participants (conversation_id, user_id) VALUES "
-	args := []interface{}{}
-	for _, userID := range newParticipants {
-		query += "(?, ?),"
-		args = append(args, conversationID, userID)
-	}
+		query := "INSERT INTO conversation_participants (conversation_id, user_id) VALUES "
+		args := []interface{}{}
+		for _, userID := range newParticipants {
+			query += "(?, ?),"
+			args = append(args, conversationID, userID)
+		}
 
-	query = query[:len(query)-1]
+		query = query[:len(query)-1]
 
-	_, err = db.c.Exec(query, args...)
-	if err != nil {
-		return fmt.Errorf("failed to add participants: %w", err)
-	}
+		_, err = tx.ExecContext(ctx, query, args...)
+		if err != nil {
+			return fmt.Errorf("failed to add participants: %w", err)
+		}
 
-	return nil
+		return nil
+	})
 }
 
 //Removes the user from the group, if it leaves only 1 participant left, also delete the group
-func (db *appdbimpl) LeaveGroup(conversationID int64, userID int64) error {
-
-	//Leave the conversation if it exists
-	var conversationType string
-	err := db.c.QueryRow(`
-		SELECT conversation_type FROM conversations WHERE id = ?
-	`, conversationID).Scan(&conversationType)
-
-	if errors.Is(err, sql.ErrNoRows) {
-		return fmt.Errorf("conversation does not exist")
-	} else if err != nil {
-		return fmt.Errorf("failed to retrieve conversation: %w", err)
-	}
-
-	if conversationType != "group" {
-		return fmt.Errorf("cannot leave a private conversation")
-	}
-
-	_, err = db.c.Exec(`
-		DELETE FROM conversation_participants 
-		WHERE conversation_id = ? AND user_id = ?
-	`, conversationID, userID)
-
-	if err != nil {
-		return fmt.Errorf("failed to remove user from group: %w", err)
-	}
-
-	var participantCount int
-	err = db.c.QueryRow(`
-		SELECT COUNT(*) FROM conversation_participants WHERE conversation_id = ?
-	`, conversationID).Scan(&participantCount)
+func (db *appdbimpl) LeaveGroup(ctx context.Context, conversationID int64, userID int64) error {
+	ctx, cancel := db.timeout(ctx)
+	defer cancel()
+
+	return withTx(ctx, db.c, func(tx *txConn) error {
+
+		//Leave the conversation if it exists
+		var conversationType string
+		err := tx.QueryRowContext(ctx, `
+			SELECT conversation_type FROM conversations WHERE id = ?
+		`, conversationID).Scan(&conversationType)
+
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("conversation does not exist")
+		} else if err != nil {
+			return fmt.Errorf("failed to retrieve conversation: %w", err)
+		}
 
-	if err != nil {
-		return fmt.Errorf("failed to check remaining participants: %w", err)
-	}
+		if conversationType != "group" {
+			return fmt.Errorf("cannot leave a private conversation")
+		}
 
-	//If only 1 participant is left, delete the group
-	if participantCount == 1 {
-		_, err = db.c.Exec(`
-			DELETE FROM conversations WHERE id = ?
-		`, conversationID)
+		_, err = tx.ExecContext(ctx, `
+			DELETE FROM conversation_participants 
+			WHERE conversation_id = ? AND user_id = ?
+		`, conversationID, userID)
 
 		if err != nil {
-			return fmt.Errorf("failed to delete group conversation: %w", err)
+			return fmt.Errorf("failed to remove user from group: %w", err)
 		}
 
-		_, err = db.c.Exec(`
-			DELETE FROM conversation_participants WHERE conversation_id = ?
-		`, conversationID)
+		var participantCount int
+		err = tx.QueryRowContext(ctx, `
+			SELECT COUNT(*) FROM conversation_participants WHERE conversation_id = ?
+		`, conversationID).Scan(&participantCount)
 
 		if err != nil {
-			return fmt.Errorf("failed to remove last participant: %w", err)
+			return fmt.Errorf("failed to check remaining participants: %w", err)
 		}
-	}
 
-	return nil
+		//If only 1 participant is left, delete the group, removing the rows which reference it first
+		if participantCount == 1 {
+			statements := []string{
+				`UPDATE conversations SET last_message_id = NULL WHERE id = ?`,
+				`DELETE FROM reactions WHERE message_id IN (SELECT id FROM messages WHERE conversation_id = ?)`,
+				`DELETE FROM message_status WHERE message_id IN (SELECT id FROM messages WHERE conversation_id = ?)`,
+				`DELETE FROM messages WHERE conversation_id = ?`,
+				`DELETE FROM conversation_participants WHERE conversation_id = ?`,
+				`DELETE FROM conversations WHERE id = ?`,
+			}
+			for _, statement := range statements {
+				if _, err := tx.ExecContext(ctx, statement, conversationID); err != nil {
+					return fmt.Errorf("failed to delete group conversation: %w", err)
+				}
+			}
+		}
+
+		return nil
+	})
 }
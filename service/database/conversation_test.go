@@ -0,0 +1,124 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestIsParticipant(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, driver string, sqldb *sql.DB) {
+		f := newFixture(t, driver, sqldb)
+		ctx := context.Background()
+
+		carol, err := f.db.CreateUser(ctx, "carol")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		//The API answers 403 to users outside the conversation, and 404 when there is no conversation
+		if ok, err := f.db.IsParticipant(ctx, f.conversationID, f.bob); !ok || err != nil {
+			t.Errorf("bob is not a participant (%v)", err)
+		}
+		if ok, err := f.db.IsParticipant(ctx, f.conversationID, carol); ok || err != nil {
+			t.Errorf("carol is a participant: %t (%v)", ok, err)
+		}
+		if _, err := f.db.IsParticipant(ctx, f.conversationID+1, f.bob); !errors.Is(err, ErrConversationNotFound) {
+			t.Errorf("missing conversation returned %v, want ErrConversationNotFound", err)
+		}
+	})
+}
+
+func TestGetMyConversationsHiddenMessages(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, driver string, sqldb *sql.DB) {
+		f := newFixture(t, driver, sqldb)
+		ctx := context.Background()
+
+		first := f.send(t, f.alice, "first", 0)
+		last := f.send(t, f.bob, "last", 0)
+
+		lastMessage := func(userID int64) (int64, string) {
+			t.Helper()
+			conversations, err := f.db.GetMyConversations(ctx, userID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(conversations) != 1 {
+				t.Fatalf("got %d conversations, want 1", len(conversations))
+			}
+			c := conversations[0]
+			content := ""
+			if c.LastMessageContent != nil {
+				content = *c.LastMessageContent
+			}
+			return c.LastMessageID, content
+		}
+
+		//Hiding the last message shows the one before it, to that user only
+		if err := f.db.HideMessage(ctx, f.conversationID, last, f.alice); err != nil {
+			t.Fatal(err)
+		}
+		if id, content := lastMessage(f.alice); id != first || content != "first" {
+			t.Errorf("alice sees %d %q as the last message, want %d", id, content, first)
+		}
+		if id, _ := lastMessage(f.bob); id != last {
+			t.Errorf("bob sees %d as the last message, want %d", id, last)
+		}
+
+		//Once everything is hidden the conversation is still listed, without a last message
+		if err := f.db.HideMessage(ctx, f.conversationID, first, f.alice); err != nil {
+			t.Fatal(err)
+		}
+		if id, content := lastMessage(f.alice); id != 0 || content != "" {
+			t.Errorf("alice sees %d %q as the last message after hiding everything", id, content)
+		}
+	})
+}
+
+func BenchmarkGetMyConversations(b *testing.B) {
+	for _, size := range []int{10, 100, 1000} {
+		b.Run(fmt.Sprint(size), func(b *testing.B) {
+			sqldb := openSQLite(b)
+			f := newFixture(b, DriverSQLite, sqldb)
+			ctx := context.Background()
+
+			//Alice talks with size other users, ten messages each, so that the last message has to be found
+			for i := 1; i < size; i++ {
+				userID, err := f.db.CreateUser(ctx, fmt.Sprintf("user%d", i))
+				if err != nil {
+					b.Fatal(err)
+				}
+				conversationID, err := f.db.CreatePrivateConversation(ctx, f.alice, userID)
+				if err != nil {
+					b.Fatal(err)
+				}
+				for j := 0; j < 10; j++ {
+					content := fmt.Sprintf("message number %d", j)
+					if _, err := f.db.SendMessage(ctx, conversationID, userID, &content, nil, nil, 0); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+			seedConversation(b, f, 10)
+
+			//Only the 50 most recent conversations are returned
+			want := size
+			if want > 50 {
+				want = 50
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				conversations, err := f.db.GetMyConversations(ctx, f.alice)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if len(conversations) != want {
+					b.Fatalf("got %d conversations, want %d", len(conversations), want)
+				}
+			}
+		})
+	}
+}
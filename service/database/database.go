@@ -2,8 +2,12 @@
 Package database is the middleware between the app database and the code. All data (de)serialization (save/load) from a
 persistent database are handled here. Database specific logic should never escape this package.
 
-To use this package you need to apply migrations to the database if needed/wanted, connect to it (using the database
-data source name from config), and then initialize an instance of AppDatabase from the DB connection.
+To use this package you need to connect to the database (using the database data source name from config), apply the
+pending migrations with Migrate, and then initialize an instance of AppDatabase from the DB connection. New refuses
+databases with pending migrations. The migrations are the SQL scripts in the migrations directory, see migrate.go.
+
+Both SQLite (DriverSQLite) and PostgreSQL (DriverPostgres) are supported. Queries are written once, using `?`
+placeholders and SQL that both databases understand; only the migrations are written for each of them.
 
 For example, this code adds a parameter in `webapi` executable for the database data source name (add it to the
 main.WebAPIConfiguration structure):
@@ -25,135 +29,134 @@ This is an example on how to migrate the DB and connect to it:
 		logger.Debug("database stopping")
 		_ = db.Close()
 	}()
+	if _, err := database.Migrate(db, database.DriverSQLite); err != nil {
+		return fmt.Errorf("migrating the database: %w", err)
+	}
 
 Then you can initialize the AppDatabase and pass it to the api package.
 */
 package database
 
 import (
+	"context"
 	"database/sql"
 	"errors"
-	"fmt"
+	"time"
 )
 
-// AppDatabase is the high level interface for the DB
+// AppDatabase is the high level interface for the DB. Every method takes the context of the operation it is part of
+// (usually the HTTP request), and is aborted when the context is cancelled or after the configured query timeout.
 type AppDatabase interface {
-	GetUserByUsername(username string) (int64, error)
-	CreateUser(username string) (int64, error)
-	DoesUsernameExist(username string) (bool, error)
-
-	GetUser(userId int64) (*User, error)
-	GetUsers() ([]User, error)
-
-	SetMyUserName(userID int64, username string) error
-	SetMyPhoto(userID int64, photoURL string) error
-
-	CreatePrivateConversation(userID, recipientID int64) (int64, error)
-	CreateGroupConversation(creatorID int64, name, photoURL string, participants []int64) (int64, error)
-
-	SetGroupName(conversationID int64, name string) error
-	SetGroupPhoto(conversationID int64, photoURL string) error
-
-	AddToGroup(conversationID int64, newParticipants []int64) error
-	LeaveGroup(conversationID int64, userID int64) error
-
-	GetConversation(conversationID int64) (*ConversationDetails, error)
-	GetMyConversations(userID int64) ([]ConversationPreview, error)
-
-	SendMessage(conversationID, senderID int64, content *string, photoData *[]byte, photoMimeType *string, originalMessageID int64) (int64, error)
-	DeleteMessage(conversationID, messageID, userID int64) error
-	CommentMessage(messageID, userID int64, emoticon string) error
-	UncommentMessage(messageID, userID int64) error
-	ForwardMessage(conversationID, senderID, originalMessageID int64) (int64, error)
+	GetUserByUsername(ctx context.Context, username string) (int64, error)
+	CreateUser(ctx context.Context, username string) (int64, error)
+	DoesUsernameExist(ctx context.Context, username string) (bool, error)
+
+	CreateSession(ctx context.Context, userID int64, tokenHash, userAgent string, expiresAt time.Time) error
+	GetSession(ctx context.Context, tokenHash string) (*Session, error)
+	TouchSession(ctx context.Context, sessionID int64) error
+	GetSessions(ctx context.Context, userID int64) ([]Session, error)
+	DeleteSession(ctx context.Context, userID, sessionID int64) error
+
+	GetUser(ctx context.Context, userId int64) (*User, error)
+	GetUsers(ctx context.Context) ([]User, error)
+	SetLastSeen(ctx context.Context, lastSeen map[int64]time.Time) error
+
+	SetMyUserName(ctx context.Context, userID int64, username string) error
+	SetMyPhoto(ctx context.Context, userID int64, photoURL string) error
+	IsPublicPhoto(ctx context.Context, photoURL string) (bool, error)
+
+	CreatePrivateConversation(ctx context.Context, userID, recipientID int64) (int64, error)
+	CreateGroupConversation(ctx context.Context, creatorID int64, name, photoURL string, participants []int64) (int64, error)
+
+	SetGroupName(ctx context.Context, conversationID int64, name string) error
+	SetGroupPhoto(ctx context.Context, conversationID int64, photoURL string) error
+
+	AddToGroup(ctx context.Context, conversationID int64, newParticipants []int64) error
+	LeaveGroup(ctx context.Context, conversationID int64, userID int64) error
+
+	IsParticipant(ctx context.Context, conversationID, userID int64) (bool, error)
+	GetParticipantIDs(ctx context.Context, conversationID int64) ([]int64, error)
+	GetContactIDs(ctx context.Context, userID int64) ([]int64, error)
+	GetMessageConversationID(ctx context.Context, messageID int64) (int64, error)
+
+	GetConversation(ctx context.Context, conversationID int64) (*ConversationDetails, error)
+	GetMessages(ctx context.Context, conversationID, viewerID, before, after int64, limit int) (*MessagePage, error)
+	GetThreadRootID(ctx context.Context, messageID int64) (int64, error)
+	GetThread(ctx context.Context, conversationID, viewerID, rootID int64) (*Thread, error)
+	GetMessagePhoto(ctx context.Context, messageID int64) (*MessagePhoto, error)
+	GetMyConversations(ctx context.Context, userID int64) ([]ConversationPreview, error)
+
+	SaveThumbnails(ctx context.Context, blobKey string, thumbnails map[int]string) error
+	GetThumbnail(ctx context.Context, blobKey string, size int) (string, error)
+
+	GetLegacyMessagePhotoIDs(ctx context.Context) ([]int64, error)
+	GetLegacyMessagePhoto(ctx context.Context, messageID int64) ([]byte, error)
+	SetLegacyMessagePhotoKey(ctx context.Context, messageID int64, photoKey, photoMimeType string) error
+	GetLegacyPhotoURLs(ctx context.Context, prefix string) (*LegacyPhotoURLs, error)
+
+	SendMessage(ctx context.Context, conversationID, senderID int64, content *string, photoKey, photoMimeType *string, originalMessageID int64) (int64, error)
+	DeleteMessage(ctx context.Context, conversationID, messageID, userID int64, sentAfter time.Time) error
+	HideMessage(ctx context.Context, conversationID, messageID, userID int64) error
+	EditMessage(ctx context.Context, conversationID, messageID, userID int64, content string, sentAfter time.Time) error
+	GetMessageHistory(ctx context.Context, messageID int64) ([]MessageVersion, error)
+	CommentMessage(ctx context.Context, messageID, userID int64, emoticon string) error
+	UncommentMessage(ctx context.Context, messageID, userID int64) error
+	ForwardMessage(ctx context.Context, conversationID, senderID, originalMessageID int64) (int64, error)
+
+	MarkMessagesAsRead(ctx context.Context, conversationID, userID, upTo int64) error
+	MarkMessagesDelivered(ctx context.Context, conversationID, userID int64, messageIDs []int64) ([]int64, error)
+	GetReceipts(ctx context.Context, messageID int64) ([]Receipt, error)
+
+	SearchMessages(ctx context.Context, userID int64, text string, filter SearchFilter, limit, offset int) (*SearchPage, error)
+
+	Ping(ctx context.Context) error
+}
 
-	MarkMessagesAsRead(conversationID, userID int64) error
+// Config contains the options of an AppDatabase
+type Config struct {
+	// Driver is the name of the database/sql driver of the connection, DriverSQLite (the default) or DriverPostgres
+	Driver string
 
-	Ping() error
+	// QueryTimeout bounds the duration of every operation on the database, zero means no timeout
+	QueryTimeout time.Duration
 }
 
 type appdbimpl struct {
-	c *sql.DB
+	c            *conn
+	queryTimeout time.Duration
 }
 
-// New returns a new instance of AppDatabase based on the SQLite connection `db`.
+// New returns a new instance of AppDatabase based on the connection `db`, opened with the driver in the configuration.
 // `db` is required - an error will be returned if `db` is `nil`.
-func New(db *sql.DB) (AppDatabase, error) {
+func New(db *sql.DB, cfg Config) (AppDatabase, error) {
 	if db == nil {
 		return nil, errors.New("database is required when building an AppDatabase")
 	}
 
-	// Create database if it does not exist
-	sqlStmts := []string{
-		`CREATE TABLE IF NOT EXISTS users (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			username TEXT UNIQUE NOT NULL CHECK (LENGTH(username) BETWEEN 3 AND 16),
-			photo_url TEXT DEFAULT ''
-		);`,
-		`CREATE TABLE IF NOT EXISTS conversations (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			name TEXT DEFAULT '',
-			conversation_type TEXT CHECK(conversation_type IN ('private', 'group')) NOT NULL,
-			photo_url TEXT DEFAULT '',
-			last_message_id INTEGER,
-			FOREIGN KEY (last_message_id) REFERENCES messages(id)
-		);`,
-		`CREATE TABLE IF NOT EXISTS conversation_participants (
-			conversation_id INTEGER NOT NULL,
-			user_id INTEGER NOT NULL,
-			PRIMARY KEY (conversation_id, user_id),
-			FOREIGN KEY (conversation_id) REFERENCES conversations(id),
-			FOREIGN KEY (user_id) REFERENCES users(id)
-		);`,
-		`CREATE TABLE IF NOT EXISTS messages (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		conversation_id INTEGER NOT NULL,
-		sender_id INTEGER NOT NULL,
-		content TEXT DEFAULT NULL,
-		photo_data BLOB DEFAULT NULL,
-		photo_mime_type TEXT DEFAULT NULL,
-		timestamp DATETIME DEFAULT CURRENT_TIMESTAMP,
-		status TEXT CHECK(status IN ('sent', 'read')) DEFAULT 'sent',
-		is_reply BOOLEAN DEFAULT FALSE,
-		original_message_id INTEGER NOT NULL DEFAULT 0,
-		is_forwarded BOOLEAN DEFAULT FALSE,
-		is_deleted BOOLEAN DEFAULT FALSE,
-		CHECK (
-			(content IS NOT NULL AND photo_data IS NULL) OR
-			(content IS NULL AND photo_data IS NOT NULL)
-		),
-		FOREIGN KEY (conversation_id) REFERENCES conversations(id),
-		FOREIGN KEY (sender_id) REFERENCES users(id),
-		FOREIGN KEY (original_message_id) REFERENCES messages(id)
-		);`,
-		`CREATE TABLE IF NOT EXISTS message_status (
-			message_id INTEGER NOT NULL,
-			user_id INTEGER NOT NULL,
-			is_read BOOLEAN DEFAULT FALSE,
-			FOREIGN KEY (message_id) REFERENCES messages(id),
-			FOREIGN KEY (user_id) REFERENCES users(id),
-			PRIMARY KEY (message_id, user_id)
-		);`,
-		`CREATE TABLE IF NOT EXISTS reactions (
-			message_id INTEGER NOT NULL,
-			user_id INTEGER NOT NULL,
-			emoticon TEXT NOT NULL,
-			FOREIGN KEY (message_id) REFERENCES messages(id),
-			FOREIGN KEY (user_id) REFERENCES users(id),
-			PRIMARY KEY (message_id, user_id)
-		);`,
-		`CREATE INDEX IF NOT EXISTS idx_messages_timestamp ON messages (conversation_id, timestamp DESC);`,
+	c, err := newConn(db, cfg.Driver)
+	if err != nil {
+		return nil, err
 	}
 
-	for _, sqlStmt := range sqlStmts {
-		_, err := db.Exec(sqlStmt)
-		if err != nil {
-			return nil, fmt.Errorf("error creating database structure: %w", err)
-		}
+	// Refuse to work on a database whose schema doesn't match this code
+	if err := checkSchema(context.Background(), c); err != nil {
+		return nil, err
 	}
 
-	return &appdbimpl{c: db}, nil
+	return &appdbimpl{c: c, queryTimeout: cfg.QueryTimeout}, nil
 }
 
-func (db *appdbimpl) Ping() error {
-	return db.c.Ping()
+// timeout derives the context of a single operation from ctx, applying the query timeout
+func (db *appdbimpl) timeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if db.queryTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, db.queryTimeout)
+}
+
+func (db *appdbimpl) Ping(ctx context.Context) error {
+	ctx, cancel := db.timeout(ctx)
+	defer cancel()
+
+	return db.c.PingContext(ctx)
 }
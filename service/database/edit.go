@@ -0,0 +1,120 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	// ErrMessageNotEditable is returned when a message has no text of its own to edit: photos, forwarded messages and
+	// deleted messages
+	ErrMessageNotEditable = errors.New("message can't be edited")
+
+	// ErrEditWindowClosed is returned when a message is too old to be edited
+	ErrEditWindowClosed = errors.New("message is too old to be edited")
+)
+
+// MessageVersion is a version of the text of a message, and when it was written
+type MessageVersion struct {
+	Content   string    `json:"content"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+//Replace the text of a message sent by the user after sentAfter, keeping the previous version
+func (db *appdbimpl) EditMessage(ctx context.Context, conversationID, messageID, userID int64, content string, sentAfter time.Time) error {
+	ctx, cancel := db.timeout(ctx)
+	defer cancel()
+
+	return withTx(ctx, db.c, func(tx *txConn) error {
+		var senderID int64
+		var previous sql.NullString
+		var isForwarded, isDeleted bool
+		var timestamp time.Time
+		err := tx.QueryRowContext(ctx, `
+			SELECT sender_id, content, is_forwarded, is_deleted, timestamp FROM messages WHERE id = ? AND conversation_id = ?
+		`, messageID, conversationID).Scan(&senderID, &previous, &isForwarded, &isDeleted, &timestamp)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrMessageNotFound
+		} else if err != nil {
+			return fmt.Errorf("failed to retrieve message: %w", err)
+		}
+
+		switch {
+		case senderID != userID:
+			return ErrNotMessageSender
+		case !previous.Valid || isForwarded || isDeleted:
+			return ErrMessageNotEditable
+		case timestamp.Before(sentAfter):
+			return ErrEditWindowClosed
+		case previous.String == content:
+			return nil
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO message_edits (message_id, content, replaced_at) VALUES (?, ?, CURRENT_TIMESTAMP)
+		`, messageID, previous.String)
+		if err != nil {
+			return fmt.Errorf("failed to save the previous version: %w", err)
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			UPDATE messages SET content = ?, edited_at = CURRENT_TIMESTAMP WHERE id = ?
+		`, content, messageID)
+		if err != nil {
+			return fmt.Errorf("failed to edit message: %w", err)
+		}
+		return nil
+	})
+}
+
+//Get the versions of the text of a message, from the first one to the current one
+func (db *appdbimpl) GetMessageHistory(ctx context.Context, messageID int64) ([]MessageVersion, error) {
+	ctx, cancel := db.timeout(ctx)
+	defer cancel()
+
+	var current sql.NullString
+	var isDeleted bool
+	var timestamp time.Time
+	var editedAt sql.NullTime
+	err := db.c.QueryRowContext(ctx, `
+		SELECT content, is_deleted, timestamp, edited_at FROM messages WHERE id = ?
+	`, messageID).Scan(&current, &isDeleted, &timestamp, &editedAt)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && (isDeleted || !current.Valid)) {
+		return nil, ErrMessageNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to retrieve message: %w", err)
+	}
+
+	rows, err := db.c.QueryContext(ctx, `
+		SELECT content, replaced_at FROM message_edits WHERE message_id = ? ORDER BY id
+	`, messageID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve edits: %w", err)
+	}
+	defer rows.Close()
+
+	//Every version was written when the one before it was replaced, the first one when the message was sent
+	versions := []MessageVersion{}
+	writtenAt := timestamp
+	for rows.Next() {
+		var version MessageVersion
+		var replacedAt time.Time
+		if err := rows.Scan(&version.Content, &replacedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan edit: %w", err)
+		}
+		version.Timestamp = writtenAt
+		versions = append(versions, version)
+		writtenAt = replacedAt
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error during row iteration: %w", err)
+	}
+
+	if editedAt.Valid {
+		writtenAt = editedAt.Time
+	}
+	return append(versions, MessageVersion{Content: current.String, Timestamp: writtenAt}), nil
+}
@@ -0,0 +1,123 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestEditMessage(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, driver string, sqldb *sql.DB) {
+		f := newFixture(t, driver, sqldb)
+		ctx := context.Background()
+		id := f.send(t, f.alice, "hello", 0)
+
+		if err := f.db.EditMessage(ctx, f.conversationID, id, f.bob, "hi", time.Time{}); !errors.Is(err, ErrNotMessageSender) {
+			t.Errorf("editing the message of another user returned %v, want ErrNotMessageSender", err)
+		}
+		if err := f.db.EditMessage(ctx, f.conversationID, id, f.alice, "hi", time.Now().Add(time.Hour)); !errors.Is(err, ErrEditWindowClosed) {
+			t.Errorf("editing after the window returned %v, want ErrEditWindowClosed", err)
+		}
+		if err := f.db.EditMessage(ctx, f.conversationID, id, f.alice, "hi", time.Now().Add(-time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+		if err := f.db.EditMessage(ctx, f.conversationID, id, f.alice, "hey", time.Time{}); err != nil {
+			t.Fatal(err)
+		}
+
+		//Sending the same text again is not an edit
+		if err := f.db.EditMessage(ctx, f.conversationID, id, f.alice, "hey", time.Time{}); err != nil {
+			t.Fatal(err)
+		}
+		if n := count(t, driver, sqldb, `SELECT COUNT(*) FROM message_edits WHERE message_id = ?`, id); n != 2 {
+			t.Errorf("%d previous versions saved, want 2", n)
+		}
+
+		page, err := f.db.GetMessages(ctx, f.conversationID, f.bob, 0, 0, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg := page.Messages[0]
+		if msg.Content == nil || *msg.Content != "hey" || msg.EditedAt == nil {
+			t.Fatalf("edited message is %+v", msg)
+		}
+
+		//The versions come from the first to the current one, each one written when the one before it was replaced
+		history, err := f.db.GetMessageHistory(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(history) != 3 || history[0].Content != "hello" || history[1].Content != "hi" || history[2].Content != "hey" {
+			t.Fatalf("unexpected history %+v", history)
+		}
+		if !history[0].Timestamp.Equal(msg.Timestamp) || !history[2].Timestamp.Equal(*msg.EditedAt) ||
+			history[1].Timestamp.Before(history[0].Timestamp) || history[2].Timestamp.Before(history[1].Timestamp) {
+			t.Errorf("history has times %v, %v and %v for a message sent at %v and edited at %v",
+				history[0].Timestamp, history[1].Timestamp, history[2].Timestamp, msg.Timestamp, *msg.EditedAt)
+		}
+	})
+}
+
+func TestEditMessageNotEditable(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, driver string, sqldb *sql.DB) {
+		f := newFixture(t, driver, sqldb)
+		ctx := context.Background()
+
+		key, mimeType := "photo", "image/png"
+		photo, err := f.db.SendMessage(ctx, f.conversationID, f.alice, nil, &key, &mimeType, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		forwarded, err := f.db.ForwardMessage(ctx, f.conversationID, f.alice, f.send(t, f.alice, "hello", 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		deleted := f.send(t, f.alice, "deleted", 0)
+		if err := f.db.DeleteMessage(ctx, f.conversationID, deleted, f.alice, time.Time{}); err != nil {
+			t.Fatal(err)
+		}
+
+		for name, id := range map[string]int64{"photo": photo, "forwarded": forwarded, "deleted": deleted} {
+			if err := f.db.EditMessage(ctx, f.conversationID, id, f.alice, "edited", time.Time{}); !errors.Is(err, ErrMessageNotEditable) {
+				t.Errorf("editing the %s message returned %v, want ErrMessageNotEditable", name, err)
+			}
+		}
+		if n := count(t, driver, sqldb, `SELECT COUNT(*) FROM message_edits`); n != 0 {
+			t.Errorf("%d previous versions saved, want 0", n)
+		}
+	})
+}
+
+// Replies show whether the message they quote was edited
+func TestEditMessageReplyPreview(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, driver string, sqldb *sql.DB) {
+		f := newFixture(t, driver, sqldb)
+		ctx := context.Background()
+
+		edited := f.send(t, f.alice, "hello", 0)
+		unedited := f.send(t, f.alice, "how are you?", 0)
+		f.send(t, f.bob, "hi", edited)
+		f.send(t, f.bob, "fine", unedited)
+		if err := f.db.EditMessage(ctx, f.conversationID, edited, f.alice, "hello bob", time.Time{}); err != nil {
+			t.Fatal(err)
+		}
+
+		page, err := f.db.GetMessages(ctx, f.conversationID, f.bob, 0, 0, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page.Messages) != 4 {
+			t.Fatalf("got %d messages, want 4", len(page.Messages))
+		}
+		editedAt := page.Messages[0].EditedAt
+		if preview := page.Messages[2].OriginalMessage; preview == nil || preview.Content != "hello bob" ||
+			preview.EditedAt == nil || editedAt == nil || !preview.EditedAt.Equal(*editedAt) {
+			t.Errorf("reply to the edited message quotes %+v, edited at %v", preview, editedAt)
+		}
+		if preview := page.Messages[3].OriginalMessage; preview == nil || preview.EditedAt != nil {
+			t.Errorf("reply to the unedited message quotes %+v", preview)
+		}
+	})
+}
@@ -0,0 +1,159 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/Nyheim99/WASAText/service/eventbus"
+)
+
+// WithEvents returns an AppDatabase which publishes to bus the domain events of the changes made through it, once
+// they are saved. Reads, and writes which have no event, go straight to db.
+func WithEvents(db AppDatabase, bus *eventbus.Bus) AppDatabase {
+	return &eventDatabase{AppDatabase: db, bus: bus}
+}
+
+type eventDatabase struct {
+	AppDatabase
+	bus *eventbus.Bus
+}
+
+func (db *eventDatabase) SendMessage(ctx context.Context, conversationID, senderID int64, content *string, photoKey, photoMimeType *string, originalMessageID int64) (int64, error) {
+	messageID, err := db.AppDatabase.SendMessage(ctx, conversationID, senderID, content, photoKey, photoMimeType, originalMessageID)
+	if err != nil {
+		return 0, err
+	}
+	event := eventbus.MessageSent{
+		ConversationID:    conversationID,
+		MessageID:         messageID,
+		SenderID:          senderID,
+		OriginalMessageID: originalMessageID,
+	}
+	if originalMessageID > 0 {
+		event.ThreadRootID = db.threadOf(ctx, messageID)
+	}
+	db.bus.Publish(event)
+	return messageID, nil
+}
+
+func (db *eventDatabase) ForwardMessage(ctx context.Context, conversationID, senderID, originalMessageID int64) (int64, error) {
+	messageID, err := db.AppDatabase.ForwardMessage(ctx, conversationID, senderID, originalMessageID)
+	if err != nil {
+		return 0, err
+	}
+	db.bus.Publish(eventbus.MessageSent{
+		ConversationID:    conversationID,
+		MessageID:         messageID,
+		SenderID:          senderID,
+		OriginalMessageID: originalMessageID,
+		Forwarded:         true,
+	})
+	return messageID, nil
+}
+
+func (db *eventDatabase) DeleteMessage(ctx context.Context, conversationID, messageID, userID int64, sentAfter time.Time) error {
+	if err := db.AppDatabase.DeleteMessage(ctx, conversationID, messageID, userID, sentAfter); err != nil {
+		return err
+	}
+	db.bus.Publish(eventbus.MessageDeleted{
+		ConversationID: conversationID,
+		MessageID:      messageID,
+		UserID:         userID,
+		ThreadRootID:   db.threadOf(ctx, messageID),
+	})
+	return nil
+}
+
+func (db *eventDatabase) HideMessage(ctx context.Context, conversationID, messageID, userID int64) error {
+	if err := db.AppDatabase.HideMessage(ctx, conversationID, messageID, userID); err != nil {
+		return err
+	}
+	db.bus.Publish(eventbus.MessageHidden{ConversationID: conversationID, MessageID: messageID, UserID: userID})
+	return nil
+}
+
+func (db *eventDatabase) EditMessage(ctx context.Context, conversationID, messageID, userID int64, content string, sentAfter time.Time) error {
+	if err := db.AppDatabase.EditMessage(ctx, conversationID, messageID, userID, content, sentAfter); err != nil {
+		return err
+	}
+	db.bus.Publish(eventbus.MessageEdited{ConversationID: conversationID, MessageID: messageID, UserID: userID})
+	return nil
+}
+
+// CommentMessage and UncommentMessage look the conversation of the message up first, as their events need it
+func (db *eventDatabase) CommentMessage(ctx context.Context, messageID, userID int64, emoticon string) error {
+	conversationID, err := db.AppDatabase.GetMessageConversationID(ctx, messageID)
+	if err != nil {
+		return err
+	}
+	if err := db.AppDatabase.CommentMessage(ctx, messageID, userID, emoticon); err != nil {
+		return err
+	}
+	db.bus.Publish(eventbus.ReactionSet{ConversationID: conversationID, MessageID: messageID, UserID: userID, Emoticon: emoticon})
+	return nil
+}
+
+func (db *eventDatabase) UncommentMessage(ctx context.Context, messageID, userID int64) error {
+	conversationID, err := db.AppDatabase.GetMessageConversationID(ctx, messageID)
+	if err != nil {
+		return err
+	}
+	if err := db.AppDatabase.UncommentMessage(ctx, messageID, userID); err != nil {
+		return err
+	}
+	db.bus.Publish(eventbus.ReactionRemoved{ConversationID: conversationID, MessageID: messageID, UserID: userID})
+	return nil
+}
+
+func (db *eventDatabase) MarkMessagesAsRead(ctx context.Context, conversationID, userID, upTo int64) error {
+	if err := db.AppDatabase.MarkMessagesAsRead(ctx, conversationID, userID, upTo); err != nil {
+		return err
+	}
+	db.bus.Publish(eventbus.MessagesRead{ConversationID: conversationID, UserID: userID, UpTo: upTo})
+	return nil
+}
+
+func (db *eventDatabase) MarkMessagesDelivered(ctx context.Context, conversationID, userID int64, messageIDs []int64) ([]int64, error) {
+	delivered, err := db.AppDatabase.MarkMessagesDelivered(ctx, conversationID, userID, messageIDs)
+	if err != nil {
+		return nil, err
+	}
+	if len(delivered) > 0 {
+		db.bus.Publish(eventbus.MessagesDelivered{ConversationID: conversationID, UserID: userID, MessageIDs: delivered})
+	}
+	return delivered, nil
+}
+
+func (db *eventDatabase) AddToGroup(ctx context.Context, conversationID int64, newParticipants []int64) error {
+	if err := db.AppDatabase.AddToGroup(ctx, conversationID, newParticipants); err != nil {
+		return err
+	}
+	db.bus.Publish(eventbus.MembersAdded{ConversationID: conversationID, UserIDs: newParticipants})
+	return nil
+}
+
+func (db *eventDatabase) LeaveGroup(ctx context.Context, conversationID int64, userID int64) error {
+	if err := db.AppDatabase.LeaveGroup(ctx, conversationID, userID); err != nil {
+		return err
+	}
+	db.bus.Publish(eventbus.MemberLeft{ConversationID: conversationID, UserID: userID})
+	return nil
+}
+
+func (db *eventDatabase) SetGroupName(ctx context.Context, conversationID int64, name string) error {
+	if err := db.AppDatabase.SetGroupName(ctx, conversationID, name); err != nil {
+		return err
+	}
+	db.bus.Publish(eventbus.GroupRenamed{ConversationID: conversationID, Name: name})
+	return nil
+}
+
+// threadOf returns the thread of a reply, for the events about it, or zero if the message is not a reply. The change
+// is already saved when it's called, so a failure only leaves the event without its thread.
+func (db *eventDatabase) threadOf(ctx context.Context, messageID int64) int64 {
+	rootID, err := db.AppDatabase.GetThreadRootID(ctx, messageID)
+	if err != nil || rootID == messageID {
+		return 0
+	}
+	return rootID
+}
@@ -0,0 +1,163 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// Databases created before media were moved to the blob store keep the photo of each message in the photo_data column
+// of messages, which the migrations don't know about. Before the initial schema is applied to such a database, the
+// photos are set aside in legacy_message_photos and the messages get a placeholder key, legacyPhotoKeyPrefix followed
+// by their ID, until the application moves the photos to the blob store.
+const legacyPhotosScript = `
+CREATE TABLE IF NOT EXISTS legacy_message_photos (
+	message_id INTEGER PRIMARY KEY,
+	data BLOB NOT NULL
+);
+
+INSERT INTO legacy_message_photos (message_id, data)
+SELECT id, photo_data FROM messages WHERE photo_data IS NOT NULL;
+
+ALTER TABLE messages ADD COLUMN photo_key TEXT DEFAULT NULL;
+
+UPDATE messages SET photo_key = '` + legacyPhotoKeyPrefix + `' || id WHERE photo_data IS NOT NULL;
+`
+
+// legacyPhotoKeyPrefix starts the placeholder keys of the photos still in legacy_message_photos
+const legacyPhotoKeyPrefix = "legacy:"
+
+// hasLegacyPhotos reports whether a SQLite database keeps message photos in the messages table
+func hasLegacyPhotos(ctx context.Context, c *conn) (bool, error) {
+	var photoData, photoKey bool
+	err := c.QueryRowContext(ctx, `
+		SELECT COALESCE(MAX(name = 'photo_data'), FALSE), COALESCE(MAX(name = 'photo_key'), FALSE)
+		FROM pragma_table_info('messages')
+	`).Scan(&photoData, &photoKey)
+	if err != nil {
+		return false, fmt.Errorf("reading the schema of messages: %w", err)
+	}
+	return photoData && !photoKey, nil
+}
+
+// LegacyPhotoURLs are the photo URLs of users and groups which start with a given prefix, by user and conversation ID
+type LegacyPhotoURLs struct {
+	Users  map[int64]string
+	Groups map[int64]string
+}
+
+//Get the IDs of the messages whose photo is still in legacy_message_photos
+func (db *appdbimpl) GetLegacyMessagePhotoIDs(ctx context.Context) ([]int64, error) {
+	ctx, cancel := db.timeout(ctx)
+	defer cancel()
+
+	//Only SQLite databases adopted by the migrations have the table
+	if db.c.driver != DriverSQLite {
+		return nil, nil
+	}
+	var exists bool
+	err := db.c.QueryRowContext(ctx, `
+		SELECT COUNT(*) > 0 FROM sqlite_master WHERE type = 'table' AND name = 'legacy_message_photos'
+	`).Scan(&exists)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look for legacy photos: %w", err)
+	}
+	if !exists {
+		return nil, nil
+	}
+
+	rows, err := db.c.QueryContext(ctx, `SELECT message_id FROM legacy_message_photos ORDER BY message_id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve legacy photos: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan legacy photo: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error during row iteration: %w", err)
+	}
+	return ids, nil
+}
+
+//Get the content of a photo still in legacy_message_photos
+func (db *appdbimpl) GetLegacyMessagePhoto(ctx context.Context, messageID int64) ([]byte, error) {
+	ctx, cancel := db.timeout(ctx)
+	defer cancel()
+
+	var data []byte
+	err := db.c.QueryRowContext(ctx, `
+		SELECT data FROM legacy_message_photos WHERE message_id = ?
+	`, messageID).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrMessageNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to retrieve legacy photo: %w", err)
+	}
+	return data, nil
+}
+
+//Point a message to its photo moved out of legacy_message_photos, which forgets it. Messages which don't have the
+//placeholder key anymore are left as they are.
+func (db *appdbimpl) SetLegacyMessagePhotoKey(ctx context.Context, messageID int64, photoKey, photoMimeType string) error {
+	ctx, cancel := db.timeout(ctx)
+	defer cancel()
+
+	return withTx(ctx, db.c, func(tx *txConn) error {
+		_, err := tx.ExecContext(ctx, `
+			UPDATE messages SET photo_key = ?, photo_mime_type = ? WHERE id = ? AND photo_key = ?
+		`, photoKey, photoMimeType, messageID, legacyPhotoKeyPrefix+strconv.FormatInt(messageID, 10))
+		if err != nil {
+			return fmt.Errorf("failed to update message photo: %w", err)
+		}
+
+		_, err = tx.ExecContext(ctx, `DELETE FROM legacy_message_photos WHERE message_id = ?`, messageID)
+		if err != nil {
+			return fmt.Errorf("failed to delete legacy photo: %w", err)
+		}
+		return nil
+	})
+}
+
+//Get the photo URLs of users and groups starting with prefix
+func (db *appdbimpl) GetLegacyPhotoURLs(ctx context.Context, prefix string) (*LegacyPhotoURLs, error) {
+	ctx, cancel := db.timeout(ctx)
+	defer cancel()
+
+	urls := LegacyPhotoURLs{Users: map[int64]string{}, Groups: map[int64]string{}}
+	for _, table := range []struct {
+		query string
+		urls  map[int64]string
+	}{
+		{`SELECT id, photo_url FROM users WHERE SUBSTR(photo_url, 1, ?) = ?`, urls.Users},
+		{`SELECT id, photo_url FROM conversations WHERE SUBSTR(photo_url, 1, ?) = ?`, urls.Groups},
+	} {
+		rows, err := db.c.QueryContext(ctx, table.query, len(prefix), prefix)
+		if err != nil {
+			return nil, fmt.Errorf("failed to retrieve photo URLs: %w", err)
+		}
+		for rows.Next() {
+			var id int64
+			var url string
+			if err := rows.Scan(&id, &url); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("failed to scan photo URL: %w", err)
+			}
+			table.urls[id] = url
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, fmt.Errorf("error during row iteration: %w", err)
+		}
+	}
+	return &urls, nil
+}
@@ -0,0 +1,53 @@
+package database
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestLegacyMedia(t *testing.T) {
+	_, db := openBaseline(t)
+	ctx := context.Background()
+
+	ids, err := db.GetLegacyMessagePhotoIDs(ctx)
+	if err != nil || !reflect.DeepEqual(ids, []int64{3}) {
+		t.Fatalf("legacy photos %v (%v), want [3]", ids, err)
+	}
+	data, err := db.GetLegacyMessagePhoto(ctx, 3)
+	if err != nil || len(data) != 73 {
+		t.Fatalf("legacy photo has %d bytes (%v), want 73", len(data), err)
+	}
+
+	if err := db.SetLegacyMessagePhotoKey(ctx, 3, "key", "image/png"); err != nil {
+		t.Fatal(err)
+	}
+	photo, err := db.GetMessagePhoto(ctx, 3)
+	if err != nil || photo.Key != "key" {
+		t.Errorf("message photo %+v (%v)", photo, err)
+	}
+	if ids, err := db.GetLegacyMessagePhotoIDs(ctx); err != nil || len(ids) != 0 {
+		t.Errorf("legacy photos left after the import: %v (%v)", ids, err)
+	}
+
+	urls, err := db.GetLegacyPhotoURLs(ctx, "/service/photos/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := LegacyPhotoURLs{
+		Users:  map[int64]string{1: "/service/photos/users/user_1.png"},
+		Groups: map[int64]string{2: "/service/photos/groups/group_2.png"},
+	}
+	if !reflect.DeepEqual(*urls, want) {
+		t.Errorf("legacy photo URLs %+v, want %+v", *urls, want)
+	}
+}
+
+func TestLegacyMediaOnNewDatabase(t *testing.T) {
+	db := newTestDatabase(t, DriverSQLite, openSQLite(t))
+	ctx := context.Background()
+
+	if ids, err := db.GetLegacyMessagePhotoIDs(ctx); err != nil || len(ids) != 0 {
+		t.Errorf("new database has legacy photos %v (%v)", ids, err)
+	}
+}
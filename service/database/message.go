@@ -1,102 +1,212 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Nyheim99/WASAText/service/globaltime"
+)
+
+var (
+	// ErrMessageNotFound is returned when a message does not exist
+	ErrMessageNotFound = errors.New("message not found")
+
+	// ErrNotMessageSender is returned when a user changes a message someone else sent
+	ErrNotMessageSender = errors.New("message was sent by another user")
+
+	// ErrDeleteWindowClosed is returned when a message is too old to be deleted for everyone
+	ErrDeleteWindowClosed = errors.New("message is too old to be deleted for everyone")
 )
 
+//Get the identifier of the conversation a message belongs to
+func (db *appdbimpl) GetMessageConversationID(ctx context.Context, messageID int64) (int64, error) {
+	ctx, cancel := db.timeout(ctx)
+	defer cancel()
+
+	var conversationID int64
+	err := db.c.QueryRowContext(ctx, `SELECT conversation_id FROM messages WHERE id = ?`, messageID).Scan(&conversationID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrMessageNotFound
+	} else if err != nil {
+		return 0, fmt.Errorf("failed to retrieve message: %w", err)
+	}
+	return conversationID, nil
+}
+
+//Get the photo of a message, returns ErrMessageNotFound if the message has no photo or has been deleted
+func (db *appdbimpl) GetMessagePhoto(ctx context.Context, messageID int64) (*MessagePhoto, error) {
+	ctx, cancel := db.timeout(ctx)
+	defer cancel()
+
+	var photo MessagePhoto
+	err := db.c.QueryRowContext(ctx, `
+		SELECT photo_key, photo_mime_type, timestamp
+		FROM messages
+		WHERE id = ? AND photo_key IS NOT NULL AND is_deleted = FALSE
+	`, messageID).Scan(&photo.Key, &photo.MimeType, &photo.Timestamp)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrMessageNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to retrieve message photo: %w", err)
+	}
+	return &photo, nil
+}
+
 //Sends a new message
-func (db *appdbimpl) SendMessage(conversationID, senderID int64, content *string, photoData *[]byte, photoMimeType *string, originalMessageID int64) (int64, error) {
-	if (content != nil && photoData != nil) || (content == nil && photoData == nil) {
+func (db *appdbimpl) SendMessage(ctx context.Context, conversationID, senderID int64, content, photoKey, photoMimeType *string, originalMessageID int64) (int64, error) {
+	ctx, cancel := db.timeout(ctx)
+	defer cancel()
+
+	if (content != nil && photoKey != nil) || (content == nil && photoKey == nil) {
 		return 0, fmt.Errorf("a message must contain either text or an image, but not both")
 	}
 
 	isReply := originalMessageID > 0
-	var result sql.Result
-	var err error
+	originalMessage := sql.NullInt64{Int64: originalMessageID, Valid: isReply}
+	var messageID int64
 
-	if content != nil {
-		result, err = db.c.Exec(`
-			INSERT INTO messages (conversation_id, sender_id, content, timestamp, status, is_reply, original_message_id)
-			VALUES (?, ?, ?, CURRENT_TIMESTAMP, 'sent', ?, ?)
-		`, conversationID, senderID, *content, isReply, originalMessageID)
-	} else {
-		result, err = db.c.Exec(`
-			INSERT INTO messages (conversation_id, sender_id, photo_data, photo_mime_type, timestamp, status, is_reply, original_message_id)
-			VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP, 'sent', ?, ?)
-		`, conversationID, senderID, *photoData, *photoMimeType, isReply, originalMessageID)
-	}
+	err := withTx(ctx, db.c, func(tx *txConn) error {
+		//A reply joins the thread of the message it replies to, or starts one if that message is not a reply
+		var threadRoot sql.NullInt64
+		if isReply {
+			err := tx.QueryRowContext(ctx, `
+				SELECT COALESCE(thread_root_id, id) FROM messages WHERE id = ?
+			`, originalMessageID).Scan(&threadRoot)
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrMessageNotFound
+			} else if err != nil {
+				return fmt.Errorf("failed to retrieve the thread of the original message: %w", err)
+			}
+		}
 
-	if err != nil {
-		return 0, fmt.Errorf("failed to add message: %w", err)
-	}
+		var row *sql.Row
+		if content != nil {
+			row = tx.QueryRowContext(ctx, `
+				INSERT INTO messages (conversation_id, sender_id, content, timestamp, status, is_reply, original_message_id, thread_root_id)
+				VALUES (?, ?, ?, CURRENT_TIMESTAMP, 'sent', ?, ?, ?)
+				RETURNING id
+			`, conversationID, senderID, *content, isReply, originalMessage, threadRoot)
+		} else {
+			row = tx.QueryRowContext(ctx, `
+				INSERT INTO messages (conversation_id, sender_id, photo_key, photo_mime_type, timestamp, status, is_reply, original_message_id, thread_root_id)
+				VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP, 'sent', ?, ?, ?)
+				RETURNING id
+			`, conversationID, senderID, *photoKey, *photoMimeType, isReply, originalMessage, threadRoot)
+		}
+		if err := row.Scan(&messageID); err != nil {
+			return fmt.Errorf("failed to add message: %w", err)
+		}
 
-	messageID, err := result.LastInsertId()
+		return deliverMessage(ctx, tx, conversationID, senderID, messageID)
+	})
 	if err != nil {
-		return 0, fmt.Errorf("failed to retrieve message ID: %w", err)
+		return 0, err
 	}
 
-	_, err = db.c.Exec(`
-		INSERT INTO message_status (message_id, user_id, is_read)
-		SELECT ?, user_id, CASE WHEN user_id = ? THEN TRUE ELSE FALSE END
+	return messageID, nil
+}
+
+//Creates the status rows of a new message for every participant, and makes it the last message of the conversation.
+//The sender has received and read it already.
+func deliverMessage(ctx context.Context, tx *txConn, conversationID, senderID, messageID int64) error {
+	now := globaltime.Now().Unix()
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO message_status (message_id, user_id, is_read, delivered_at, read_at)
+		SELECT CAST(? AS BIGINT), user_id, user_id = ?,
+			CASE WHEN user_id = ? THEN CAST(? AS BIGINT) END, CASE WHEN user_id = ? THEN CAST(? AS BIGINT) END
 		FROM conversation_participants
 		WHERE conversation_id = ?
-	`, messageID, senderID, conversationID)
+	`, messageID, senderID, senderID, now, senderID, now, conversationID)
 	if err != nil {
-		return 0, fmt.Errorf("failed to insert message status for participants: %w", err)
+		return fmt.Errorf("failed to insert message status for participants: %w", err)
 	}
 
-	_, err = db.c.Exec(`
+	_, err = tx.ExecContext(ctx, `
 		UPDATE conversations
 		SET last_message_id = ?
 		WHERE id = ?
 	`, messageID, conversationID)
 	if err != nil {
-		return 0, fmt.Errorf("failed to update last message ID: %w", err)
+		return fmt.Errorf("failed to update last message ID: %w", err)
 	}
 
-	return messageID, nil
+	return nil
 }
 
-//Deletes a message
-func (db *appdbimpl) DeleteMessage(conversationID, messageID, userID int64) error {
-	var count int
-	err := db.c.QueryRow(`
-		SELECT COUNT(*) FROM messages 
-		WHERE id = ? AND conversation_id = ? AND sender_id = ? AND is_deleted = FALSE
-	`, messageID, conversationID, userID).Scan(&count)
+//Deletes a message for everyone, which only its sender can do if they sent it after sentAfter
+func (db *appdbimpl) DeleteMessage(ctx context.Context, conversationID, messageID, userID int64, sentAfter time.Time) error {
+	ctx, cancel := db.timeout(ctx)
+	defer cancel()
 
-	if err != nil {
-		return fmt.Errorf("failed to check message existence: %w", err)
-	}
+	return withTx(ctx, db.c, func(tx *txConn) error {
+		var senderID int64
+		var isDeleted bool
+		var timestamp time.Time
+		err := tx.QueryRowContext(ctx, `
+			SELECT sender_id, is_deleted, timestamp FROM messages
+			WHERE id = ? AND conversation_id = ?
+		`, messageID, conversationID).Scan(&senderID, &isDeleted, &timestamp)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrMessageNotFound
+		} else if err != nil {
+			return fmt.Errorf("failed to check message existence: %w", err)
+		}
 
-	if count == 0 {
-		return fmt.Errorf("message not found or already deleted")
-	}
+		switch {
+		case isDeleted:
+			return ErrMessageNotFound
+		case senderID != userID:
+			return ErrNotMessageSender
+		case timestamp.Before(sentAfter):
+			return ErrDeleteWindowClosed
+		}
 
-	_, err = db.c.Exec(`
-		UPDATE messages 
-		SET is_deleted = TRUE
-		WHERE id = ? AND conversation_id = ? AND sender_id = ?
-	`, messageID, conversationID, userID)
-	if err != nil {
-		return fmt.Errorf("failed to delete message: %w", err)
-	}
+		_, err = tx.ExecContext(ctx, `
+			UPDATE messages 
+			SET is_deleted = TRUE
+			WHERE id = ? AND conversation_id = ? AND sender_id = ?
+		`, messageID, conversationID, userID)
+		if err != nil {
+			return fmt.Errorf("failed to delete message: %w", err)
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			DELETE FROM message_status WHERE message_id = ?
+		`, messageID)
+		if err != nil {
+			return fmt.Errorf("failed to delete message status: %w", err)
+		}
+
+		return nil
+	})
+}
+
+//Hide a message of a conversation from the view of a user only, hiding it again does nothing
+func (db *appdbimpl) HideMessage(ctx context.Context, conversationID, messageID, userID int64) error {
+	ctx, cancel := db.timeout(ctx)
+	defer cancel()
 
-	_, err = db.c.Exec(`
-	DELETE FROM message_status WHERE message_id = ?
-`, messageID)
+	_, err := db.c.ExecContext(ctx, `
+		INSERT INTO hidden_messages (user_id, message_id)
+		SELECT ?, id FROM messages WHERE id = ? AND conversation_id = ?
+		ON CONFLICT (user_id, message_id) DO NOTHING
+	`, userID, messageID, conversationID)
 	if err != nil {
-		return fmt.Errorf("failed to delete message status: %w", err)
+		return fmt.Errorf("failed to hide message: %w", err)
 	}
-
 	return nil
 }
 
 //Comments a messsage
-func (db *appdbimpl) CommentMessage(messageID, userID int64, emoticon string) error {
-	_, err := db.c.Exec(`
+func (db *appdbimpl) CommentMessage(ctx context.Context, messageID, userID int64, emoticon string) error {
+	ctx, cancel := db.timeout(ctx)
+	defer cancel()
+
+	_, err := db.c.ExecContext(ctx, `
 		INSERT INTO reactions (message_id, user_id, emoticon)
 		VALUES (?, ?, ?)
 		ON CONFLICT (message_id, user_id) 
@@ -111,8 +221,11 @@ func (db *appdbimpl) CommentMessage(messageID, userID int64, emoticon string) er
 }
 
 //Uncomments a message
-func (db *appdbimpl) UncommentMessage(messageID, userID int64) error {
-	_, err := db.c.Exec(`
+func (db *appdbimpl) UncommentMessage(ctx context.Context, messageID, userID int64) error {
+	ctx, cancel := db.timeout(ctx)
+	defer cancel()
+
+	_, err := db.c.ExecContext(ctx, `
 		DELETE FROM reactions WHERE message_id = ? AND user_id = ?
 	`, messageID, userID)
 
@@ -124,92 +237,174 @@ func (db *appdbimpl) UncommentMessage(messageID, userID int64) error {
 }
 
 //Forwards a message
-func (db *appdbimpl) ForwardMessage(conversationID, senderID, originalMessageID int64) (int64, error) {
-	var content sql.NullString
-	var photoData []byte
-	var photoMimeType sql.NullString
-	err := db.c.QueryRow(`
-		SELECT content, photo_data, photo_mime_type 
-		FROM messages 
-		WHERE id = ? AND is_deleted = FALSE
-	`, originalMessageID).Scan(&content, &photoData, &photoMimeType)
-	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return 0, fmt.Errorf("original message not found")
+func (db *appdbimpl) ForwardMessage(ctx context.Context, conversationID, senderID, originalMessageID int64) (int64, error) {
+	ctx, cancel := db.timeout(ctx)
+	defer cancel()
+
+	var messageID int64
+
+	err := withTx(ctx, db.c, func(tx *txConn) error {
+		var content sql.NullString
+		var photoKey sql.NullString
+		var photoMimeType sql.NullString
+		err := tx.QueryRowContext(ctx, `
+			SELECT content, photo_key, photo_mime_type 
+			FROM messages 
+			WHERE id = ? AND is_deleted = FALSE
+		`, originalMessageID).Scan(&content, &photoKey, &photoMimeType)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return fmt.Errorf("original message not found")
+			}
+			return fmt.Errorf("failed to retrieve original message: %w", err)
 		}
-		return 0, fmt.Errorf("failed to retrieve original message: %w", err)
-	}
 
-	var result sql.Result
-	if content.Valid {
-		result, err = db.c.Exec(`
-			INSERT INTO messages (conversation_id, sender_id, content, timestamp, is_forwarded, original_message_id)
-			VALUES (?, ?, ?, CURRENT_TIMESTAMP, TRUE, ?)
-		`, conversationID, senderID, content.String, originalMessageID)
-	} else {
-		result, err = db.c.Exec(`
-			INSERT INTO messages (conversation_id, sender_id, photo_data, photo_mime_type, timestamp, is_forwarded, original_message_id)
-			VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP, TRUE, ?)
-		`, conversationID, senderID, photoData, photoMimeType.String, originalMessageID)
-	}
+		var row *sql.Row
+		if content.Valid {
+			row = tx.QueryRowContext(ctx, `
+				INSERT INTO messages (conversation_id, sender_id, content, timestamp, is_forwarded, original_message_id)
+				VALUES (?, ?, ?, CURRENT_TIMESTAMP, TRUE, ?)
+				RETURNING id
+			`, conversationID, senderID, content.String, originalMessageID)
+		} else {
+			row = tx.QueryRowContext(ctx, `
+				INSERT INTO messages (conversation_id, sender_id, photo_key, photo_mime_type, timestamp, is_forwarded, original_message_id)
+				VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP, TRUE, ?)
+				RETURNING id
+			`, conversationID, senderID, photoKey.String, photoMimeType.String, originalMessageID)
+		}
+		if err := row.Scan(&messageID); err != nil {
+			return fmt.Errorf("failed to forward message: %w", err)
+		}
+
+		return deliverMessage(ctx, tx, conversationID, senderID, messageID)
+	})
 	if err != nil {
-		return 0, fmt.Errorf("failed to forward message: %w", err)
+		return 0, err
 	}
 
-	messageID, err := result.LastInsertId()
-	if err != nil {
-		return 0, fmt.Errorf("failed to retrieve new message ID: %w", err)
+	return messageID, nil
+}
+
+//Marks the messages of a conversation as read by a user, all of them or the ones up to upTo if it is not zero. The
+//messages are received as well, if they were not already.
+func (db *appdbimpl) MarkMessagesAsRead(ctx context.Context, conversationID, userID, upTo int64) error {
+	ctx, cancel := db.timeout(ctx)
+	defer cancel()
+
+	messages, args := `SELECT id FROM messages WHERE conversation_id = ?`, []interface{}{conversationID}
+	if upTo > 0 {
+		messages, args = messages+` AND id <= ?`, append(args, upTo)
 	}
 
-	_, err = db.c.Exec(`
-		INSERT INTO message_status (message_id, user_id, is_read)
-		SELECT ?, user_id, CASE WHEN user_id = ? THEN TRUE ELSE FALSE END
-		FROM conversation_participants
-		WHERE conversation_id = ?
-	`, messageID, senderID, conversationID)
-	if err != nil {
-		return 0, fmt.Errorf("failed to insert message status for participants: %w", err)
+	return withTx(ctx, db.c, func(tx *txConn) error {
+		now := globaltime.Now().Unix()
+		_, err := tx.ExecContext(ctx, `
+			UPDATE message_status 
+			SET is_read = TRUE, read_at = ?, delivered_at = COALESCE(delivered_at, ?)
+			WHERE user_id = ? AND is_read = FALSE AND message_id IN (`+messages+`)
+		`, append([]interface{}{now, now, userID}, args...)...)
+		if err != nil {
+			return fmt.Errorf("failed to mark messages as read: %w", err)
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			UPDATE messages 
+			SET status = 'read'
+			WHERE id IN (
+				SELECT message_id 
+				FROM message_status 
+				WHERE conversation_id = ? 
+				GROUP BY message_id 
+				HAVING COUNT(user_id) = (SELECT COUNT(*) FROM conversation_participants WHERE conversation_id = ?)
+			)
+		`, conversationID, conversationID)
+		if err != nil {
+			return fmt.Errorf("failed to update message status to read: %w", err)
+		}
+
+		return nil
+	})
+}
+
+//Marks messages of a conversation as received by a user, and returns the ones which were not received before
+func (db *appdbimpl) MarkMessagesDelivered(ctx context.Context, conversationID, userID int64, messageIDs []int64) ([]int64, error) {
+	if len(messageIDs) == 0 {
+		return nil, nil
 	}
 
-	_, err = db.c.Exec(`
-		UPDATE conversations
-		SET last_message_id = ?
-		WHERE id = ?
-	`, messageID, conversationID)
+	ctx, cancel := db.timeout(ctx)
+	defer cancel()
+
+	placeholders := make([]string, len(messageIDs))
+	args := []interface{}{globaltime.Now().Unix(), userID, conversationID}
+	for i, messageID := range messageIDs {
+		placeholders[i] = "?"
+		args = append(args, messageID)
+	}
+
+	rows, err := db.c.QueryContext(ctx, `
+		UPDATE message_status
+		SET delivered_at = ?
+		WHERE user_id = ? AND delivered_at IS NULL AND is_read = FALSE AND message_id IN (
+			SELECT id FROM messages WHERE conversation_id = ? AND id IN (`+strings.Join(placeholders, ", ")+`)
+		)
+		RETURNING message_id
+	`, args...)
 	if err != nil {
-		return 0, fmt.Errorf("failed to update last message ID for conversation: %w", err)
+		return nil, fmt.Errorf("failed to mark messages as delivered: %w", err)
 	}
+	defer rows.Close()
 
-	return messageID, nil
+	var delivered []int64
+	for rows.Next() {
+		var messageID int64
+		if err := rows.Scan(&messageID); err != nil {
+			return nil, fmt.Errorf("failed to scan delivered message: %w", err)
+		}
+		delivered = append(delivered, messageID)
+	}
+	return delivered, rows.Err()
 }
 
-//Marks all messages in a specific conversation as read
-func (db *appdbimpl) MarkMessagesAsRead(conversationID, userID int64) error {
-	_, err := db.c.Exec(`
-		UPDATE message_status 
-		SET is_read = TRUE 
-		WHERE message_id IN (
-			SELECT id FROM messages WHERE conversation_id = ?
-		) AND user_id = ?
-	`, conversationID, userID)
-	if err != nil {
-		return fmt.Errorf("failed to mark messages as read: %w", err)
-	}
-
-	_, err = db.c.Exec(`
-		UPDATE messages 
-		SET status = 'read'
-		WHERE id IN (
-			SELECT message_id 
-			FROM message_status 
-			WHERE conversation_id = ? 
-			GROUP BY message_id 
-			HAVING COUNT(user_id) = (SELECT COUNT(*) FROM conversation_participants WHERE conversation_id = ?)
-		)
-	`, conversationID, conversationID)
+//Get who received and read a message, except its sender
+func (db *appdbimpl) GetReceipts(ctx context.Context, messageID int64) ([]Receipt, error) {
+	ctx, cancel := db.timeout(ctx)
+	defer cancel()
+
+	rows, err := db.c.QueryContext(ctx, `
+		SELECT ms.user_id, u.username, ms.is_read, ms.delivered_at, ms.read_at
+		FROM message_status ms
+		JOIN messages m ON m.id = ms.message_id
+		JOIN users u ON u.id = ms.user_id
+		WHERE ms.message_id = ? AND ms.user_id != m.sender_id
+		ORDER BY u.username
+	`, messageID)
 	if err != nil {
-		return fmt.Errorf("failed to update message status to read: %w", err)
+		return nil, fmt.Errorf("failed to retrieve receipts: %w", err)
 	}
+	defer rows.Close()
 
-	return nil
+	receipts := []Receipt{}
+	for rows.Next() {
+		var receipt Receipt
+		var isRead bool
+		var deliveredAt, readAt sql.NullInt64
+		if err := rows.Scan(&receipt.UserID, &receipt.Username, &isRead, &deliveredAt, &readAt); err != nil {
+			return nil, fmt.Errorf("failed to scan receipt: %w", err)
+		}
+
+		//Messages read before receipts were recorded have no times
+		receipt.DeliveredAt, receipt.ReadAt = unixTime(deliveredAt), unixTime(readAt)
+		switch {
+		case isRead:
+			receipt.Status = "read"
+		case deliveredAt.Valid:
+			receipt.Status = "delivered"
+		default:
+			receipt.Status = "sent"
+		}
+		receipts = append(receipts, receipt)
+	}
+	return receipts, rows.Err()
 }
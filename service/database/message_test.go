@@ -0,0 +1,282 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Nyheim99/WASAText/service/globaltime"
+)
+
+func TestMarkMessagesDelivered(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, driver string, sqldb *sql.DB) {
+		f := newFixture(t, driver, sqldb)
+		ctx := context.Background()
+
+		carol, err := f.db.CreateUser(ctx, "carol")
+		if err != nil {
+			t.Fatal(err)
+		}
+		other, err := f.db.CreatePrivateConversation(ctx, f.alice, carol)
+		if err != nil {
+			t.Fatal(err)
+		}
+		content := "not for bob"
+		elsewhere, err := f.db.SendMessage(ctx, other, f.alice, &content, nil, nil, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		first := f.send(t, f.alice, "first", 0)
+		second := f.send(t, f.alice, "second", 0)
+		own := f.send(t, f.bob, "own", 0)
+
+		//Messages of other conversations and the ones the user sent are left out
+		delivered, err := f.db.MarkMessagesDelivered(ctx, f.conversationID, f.bob, []int64{first, own, elsewhere})
+		if err != nil || !reflect.DeepEqual(delivered, []int64{first}) {
+			t.Errorf("first delivery returned %v (%v), want [%d]", delivered, err, first)
+		}
+		delivered, err = f.db.MarkMessagesDelivered(ctx, f.conversationID, f.bob, []int64{first, second})
+		if err != nil || !reflect.DeepEqual(delivered, []int64{second}) {
+			t.Errorf("second delivery returned %v (%v), want [%d]", delivered, err, second)
+		}
+		delivered, err = f.db.MarkMessagesDelivered(ctx, f.conversationID, f.bob, []int64{first, second})
+		if err != nil || len(delivered) != 0 {
+			t.Errorf("delivering again returned %v (%v), want nothing", delivered, err)
+		}
+
+		receipts, err := f.db.GetReceipts(ctx, first)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(receipts) != 1 || receipts[0].UserID != f.bob || receipts[0].Status != "delivered" {
+			t.Errorf("unexpected receipts %+v", receipts)
+		}
+		receipts, err = f.db.GetReceipts(ctx, elsewhere)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(receipts) != 1 || receipts[0].UserID != carol || receipts[0].Status != "sent" {
+			t.Errorf("unexpected receipts of the other conversation %+v", receipts)
+		}
+	})
+}
+
+// checkReceipt fails the test if a receipt doesn't have the status and times, nil when the time is missing
+func checkReceipt(t *testing.T, r Receipt, username, status string, deliveredAt, readAt *time.Time) {
+	t.Helper()
+	sameTime := func(got, want *time.Time) bool {
+		return (got == nil && want == nil) || (got != nil && want != nil && got.Equal(*want))
+	}
+	if r.Username != username || r.Status != status || !sameTime(r.DeliveredAt, deliveredAt) || !sameTime(r.ReadAt, readAt) {
+		t.Errorf("got receipt %s %s %v %v, want %s %s %v %v",
+			r.Username, r.Status, r.DeliveredAt, r.ReadAt, username, status, deliveredAt, readAt)
+	}
+}
+
+func TestGetReceipts(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, driver string, sqldb *sql.DB) {
+		start := time.Date(2024, 2, 2, 15, 4, 5, 0, time.UTC)
+		globaltime.FixedTime = start
+		defer func() { globaltime.FixedTime = time.Time{} }()
+
+		f := newFixture(t, driver, sqldb)
+		ctx := context.Background()
+
+		carol, err := f.db.CreateUser(ctx, "carol")
+		if err != nil {
+			t.Fatal(err)
+		}
+		dave, err := f.db.CreateUser(ctx, "dave")
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.conversationID, err = f.db.CreateGroupConversation(ctx, f.alice, "friends", "", []int64{f.bob, carol, dave})
+		if err != nil {
+			t.Fatal(err)
+		}
+		id := f.send(t, f.alice, "hello", 0)
+
+		//Bob receives the message, and later reads it. Carol reads it at once, which means receiving it as well.
+		delivered := start.Add(time.Minute)
+		globaltime.FixedTime = delivered
+		if _, err := f.db.MarkMessagesDelivered(ctx, f.conversationID, f.bob, []int64{id}); err != nil {
+			t.Fatal(err)
+		}
+		read := start.Add(2 * time.Minute)
+		globaltime.FixedTime = read
+		if err := f.db.MarkMessagesAsRead(ctx, f.conversationID, carol, 0); err != nil {
+			t.Fatal(err)
+		}
+
+		//The sender is left out
+		receipts, err := f.db.GetReceipts(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(receipts) != 3 {
+			t.Fatalf("got %d receipts, want 3", len(receipts))
+		}
+		checkReceipt(t, receipts[0], "bob", "delivered", &delivered, nil)
+		checkReceipt(t, receipts[1], "carol", "read", &read, &read)
+		checkReceipt(t, receipts[2], "dave", "sent", nil, nil)
+		if receipts[0].UserID != f.bob || receipts[1].UserID != carol || receipts[2].UserID != dave {
+			t.Errorf("receipts are for users %d, %d and %d", receipts[0].UserID, receipts[1].UserID, receipts[2].UserID)
+		}
+
+		later := start.Add(3 * time.Minute)
+		globaltime.FixedTime = later
+		if err := f.db.MarkMessagesAsRead(ctx, f.conversationID, f.bob, 0); err != nil {
+			t.Fatal(err)
+		}
+		receipts, err = f.db.GetReceipts(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkReceipt(t, receipts[0], "bob", "read", &delivered, &later)
+	})
+}
+
+func TestMarkMessagesAsRead(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, driver string, sqldb *sql.DB) {
+		start := time.Date(2024, 2, 2, 15, 4, 5, 0, time.UTC)
+		globaltime.FixedTime = start
+		defer func() { globaltime.FixedTime = time.Time{} }()
+
+		f := newFixture(t, driver, sqldb)
+		ctx := context.Background()
+		first := f.send(t, f.alice, "first", 0)
+		second := f.send(t, f.alice, "second", 0)
+		third := f.send(t, f.alice, "third", 0)
+
+		receipt := func(id int64) Receipt {
+			t.Helper()
+			receipts, err := f.db.GetReceipts(ctx, id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(receipts) != 1 {
+				t.Fatalf("got %d receipts, want 1", len(receipts))
+			}
+			return receipts[0]
+		}
+
+		//Only the messages up to the given one are read
+		if err := f.db.MarkMessagesAsRead(ctx, f.conversationID, f.bob, second); err != nil {
+			t.Fatal(err)
+		}
+		checkReceipt(t, receipt(first), "bob", "read", &start, &start)
+		checkReceipt(t, receipt(second), "bob", "read", &start, &start)
+		checkReceipt(t, receipt(third), "bob", "sent", nil, nil)
+
+		//Reading everything keeps the time the first messages were read
+		later := start.Add(time.Minute)
+		globaltime.FixedTime = later
+		if err := f.db.MarkMessagesAsRead(ctx, f.conversationID, f.bob, 0); err != nil {
+			t.Fatal(err)
+		}
+		checkReceipt(t, receipt(first), "bob", "read", &start, &start)
+		checkReceipt(t, receipt(third), "bob", "read", &later, &later)
+	})
+}
+
+func TestDeleteMessage(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, driver string, sqldb *sql.DB) {
+		f := newFixture(t, driver, sqldb)
+		ctx := context.Background()
+		id := f.send(t, f.alice, "hello", 0)
+		reply := f.send(t, f.bob, "hi", id)
+
+		if err := f.db.DeleteMessage(ctx, f.conversationID, id, f.bob, time.Time{}); !errors.Is(err, ErrNotMessageSender) {
+			t.Errorf("deleting the message of another user returned %v, want ErrNotMessageSender", err)
+		}
+		if err := f.db.DeleteMessage(ctx, f.conversationID, id, f.alice, time.Now().Add(time.Hour)); !errors.Is(err, ErrDeleteWindowClosed) {
+			t.Errorf("deleting after the window returned %v, want ErrDeleteWindowClosed", err)
+		}
+		if err := f.db.DeleteMessage(ctx, f.conversationID, id, f.alice, time.Now().Add(-time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+		if n := count(t, driver, sqldb, `SELECT COUNT(*) FROM messages WHERE id = ? AND is_deleted`, id); n != 1 {
+			t.Error("the message wasn't deleted")
+		}
+		if n := count(t, driver, sqldb, `SELECT COUNT(*) FROM message_status WHERE message_id = ?`, id); n != 0 {
+			t.Errorf("%d statuses of the deleted message left", n)
+		}
+		if err := f.db.DeleteMessage(ctx, f.conversationID, id, f.alice, time.Time{}); !errors.Is(err, ErrMessageNotFound) {
+			t.Errorf("deleting again returned %v, want ErrMessageNotFound", err)
+		}
+
+		//The text of the deleted message is gone, also from the reply to it
+		page, err := f.db.GetMessages(ctx, f.conversationID, f.bob, 0, 0, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page.Messages) != 2 || page.Messages[0].ID != id || page.Messages[1].ID != reply {
+			t.Fatalf("got %v, want messages %d and %d", messageIDs(page), id, reply)
+		}
+		if deleted := page.Messages[0]; !deleted.IsDeleted || deleted.Content != nil {
+			t.Errorf("deleted message is shown as %+v", deleted)
+		}
+		if original := page.Messages[1].OriginalMessage; original == nil || original.ID != id || original.Content != "" {
+			t.Errorf("reply to the deleted message quotes %+v", original)
+		}
+
+		//Same for the last message of the conversation
+		if err := f.db.DeleteMessage(ctx, f.conversationID, reply, f.bob, time.Time{}); err != nil {
+			t.Fatal(err)
+		}
+		conversations, err := f.db.GetMyConversations(ctx, f.alice)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(conversations) != 1 || !conversations[0].LastMessageIsDeleted || conversations[0].LastMessageContent != nil {
+			t.Errorf("deleted last message is shown as %+v", conversations)
+		}
+	})
+}
+
+func TestHideMessage(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, driver string, sqldb *sql.DB) {
+		f := newFixture(t, driver, sqldb)
+		ctx := context.Background()
+		id := f.send(t, f.alice, "hello", 0)
+
+		//Hiding again does nothing, and messages of other conversations can't be hidden through this one
+		for i := 0; i < 2; i++ {
+			if err := f.db.HideMessage(ctx, f.conversationID, id, f.bob); err != nil {
+				t.Fatalf("hiding %d times: %v", i+1, err)
+			}
+		}
+		if err := f.db.HideMessage(ctx, f.conversationID+1, id, f.alice); err != nil {
+			t.Fatal(err)
+		}
+		if n := count(t, driver, sqldb, `SELECT COUNT(*) FROM hidden_messages`); n != 1 {
+			t.Errorf("%d messages hidden, want 1", n)
+		}
+
+		//The message is gone for bob only
+		for _, tt := range []struct {
+			name   string
+			userID int64
+			want   int
+		}{{"alice", f.alice, 1}, {"bob", f.bob, 0}} {
+			page, err := f.db.GetMessages(ctx, f.conversationID, tt.userID, 0, 0, 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(page.Messages) != tt.want {
+				t.Errorf("%s sees %d messages, want %d", tt.name, len(page.Messages), tt.want)
+			}
+			conversations, err := f.db.GetMyConversations(ctx, tt.userID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(conversations) != 1 || (conversations[0].LastMessageID == id) != (tt.want == 1) {
+				t.Errorf("%s sees %+v", tt.name, conversations)
+			}
+		}
+	})
+}
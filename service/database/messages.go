@@ -0,0 +1,254 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"strings"
+)
+
+type MessagePage struct {
+	Messages   []Message `json:"messages"`
+	HasMore    bool      `json:"has_more"`
+	NextCursor int64     `json:"next_cursor,omitempty"`
+}
+
+//Get a page of at most limit messages of a conversation, leaving out the ones viewerID hid. By default the newest
+//messages are returned, older pages are loaded with before and newer ones with after, both being message IDs. Only one
+//of the two cursors can be set.
+func (db *appdbimpl) GetMessages(ctx context.Context, conversationID, viewerID, before, after int64, limit int) (*MessagePage, error) {
+	ctx, cancel := db.timeout(ctx)
+	defer cancel()
+
+	if before > 0 && after > 0 {
+		return nil, fmt.Errorf("only one of before and after can be set")
+	}
+
+	//Walk backwards from the cursor, unless we are asked for newer messages
+	cursorCondition, order, cursor := "id < ?", "DESC", before
+	if after > 0 {
+		cursorCondition, order, cursor = "id > ?", "ASC", after
+	} else if before <= 0 {
+		cursorCondition, cursor = "id <= ?", math.MaxInt64
+	}
+
+	//Fetch one message more than requested, to know if there are more pages
+	messages, err := db.queryMessages(ctx, conversationID, viewerID, `
+		SELECT id FROM messages
+		WHERE conversation_id = ? AND `+cursorCondition+`
+			AND NOT EXISTS (
+				SELECT 1 FROM hidden_messages h WHERE h.message_id = messages.id AND h.user_id = ?
+			)
+		ORDER BY id `+order+`
+		LIMIT ?`, order, conversationID, cursor, viewerID, limit+1)
+	if err != nil {
+		return nil, err
+	}
+
+	page := MessagePage{Messages: messages}
+	if len(messages) > limit {
+		page.Messages = messages[:limit]
+		page.HasMore = true
+	}
+
+	//Pages are always returned in chronological order
+	if after <= 0 {
+		for i, j := 0, len(page.Messages)-1; i < j; i, j = i+1, j-1 {
+			page.Messages[i], page.Messages[j] = page.Messages[j], page.Messages[i]
+		}
+	}
+
+	if page.HasMore {
+		if after > 0 {
+			page.NextCursor = page.Messages[len(page.Messages)-1].ID
+		} else {
+			page.NextCursor = page.Messages[0].ID
+		}
+	}
+
+	return &page, nil
+}
+
+//Helper function to load the messages of a conversation whose IDs are selected by pageQuery, in the given order of
+//their IDs, with their status, the original message they reply to, their thread and their reactions. The replies
+//viewerID hid are not counted in the threads.
+func (db *appdbimpl) queryMessages(ctx context.Context, conversationID, viewerID int64, pageQuery string, order string, pageArgs ...interface{}) ([]Message, error) {
+
+	// The status of every message in the page is computed in the same query, by comparing how many received and read it
+	// with the amount of participants. Deleted replies are not counted in threads, and the text of deleted messages is
+	// left out, also from the replies to them.
+	args := append(pageArgs, viewerID, conversationID)
+	messageRows, err := db.c.QueryContext(ctx, `
+		WITH page AS (`+pageQuery+`
+		),
+		status_counts AS (
+			SELECT message_id,
+				SUM(CASE WHEN is_read THEN 1 ELSE 0 END) AS read_count,
+				SUM(CASE WHEN is_read OR delivered_at IS NOT NULL THEN 1 ELSE 0 END) AS delivered_count
+			FROM message_status
+			WHERE message_id IN (SELECT id FROM page)
+			GROUP BY message_id
+		),
+		thread_stats AS (
+			SELECT thread_root_id, COUNT(*) AS reply_count, MAX(id) AS last_reply_id
+			FROM messages r
+			WHERE thread_root_id IN (SELECT id FROM page) AND NOT is_deleted
+				AND NOT EXISTS (
+					SELECT 1 FROM hidden_messages h WHERE h.message_id = r.id AND h.user_id = ?
+				)
+			GROUP BY thread_root_id
+		)
+		SELECT 
+			m.id, m.conversation_id, m.sender_id, u.username, 
+			CASE WHEN m.is_deleted THEN NULL ELSE m.content END AS content,
+			m.photo_key IS NOT NULL AS has_photo, m.photo_mime_type, m.timestamp, m.edited_at,
+			m.is_reply, COALESCE(m.original_message_id, 0) AS original_message_id, 
+			m.is_forwarded, m.is_deleted,
+			CASE WHEN om.is_deleted THEN '' ELSE COALESCE(om.content, '[Photo Message]') END AS original_message_content,
+			COALESCE(ou.username, 'Unknown') AS original_message_sender,
+			om.edited_at AS original_message_edited_at,
+			COALESCE(m.thread_root_id, 0) AS thread_root_id,
+			COALESCE(ts.reply_count, 0) AS reply_count,
+			lr.timestamp AS last_reply_at,
+			COALESCE(sc.read_count, 0) = pc.participant_count AS is_read,
+			COALESCE(sc.delivered_count, 0) = pc.participant_count AS is_delivered
+		FROM page
+		JOIN messages m ON m.id = page.id
+		JOIN users u ON m.sender_id = u.id
+		LEFT JOIN messages om ON m.original_message_id = om.id
+		LEFT JOIN users ou ON om.sender_id = ou.id
+		LEFT JOIN thread_stats ts ON ts.thread_root_id = m.id
+		LEFT JOIN messages lr ON lr.id = ts.last_reply_id
+		LEFT JOIN status_counts sc ON sc.message_id = m.id
+		CROSS JOIN (
+			SELECT COUNT(*) AS participant_count
+			FROM conversation_participants
+			WHERE conversation_id = ?
+		) pc
+		ORDER BY m.id `+order, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve messages: %w", err)
+	}
+	defer messageRows.Close()
+
+	messages := []Message{}
+	for messageRows.Next() {
+		var msg Message
+		var originalMessageContent sql.NullString
+		var originalMessageSender sql.NullString
+		var photoMimeType sql.NullString
+		var editedAt, originalMessageEditedAt, lastReplyAt sql.NullTime
+		var isRead, isDelivered bool
+
+		err := messageRows.Scan(
+			&msg.ID,
+			&msg.ConversationID,
+			&msg.SenderID,
+			&msg.SenderUsername,
+			&msg.Content,
+			&msg.HasPhoto,
+			&photoMimeType,
+			&msg.Timestamp,
+			&editedAt,
+			&msg.IsReply,
+			&msg.OriginalMessageID,
+			&msg.IsForwarded,
+			&msg.IsDeleted,
+			&originalMessageContent,
+			&originalMessageSender,
+			&originalMessageEditedAt,
+			&msg.ThreadRootID,
+			&msg.ReplyCount,
+			&lastReplyAt,
+			&isRead,
+			&isDelivered,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan message: %w", err)
+		}
+
+		if photoMimeType.Valid {
+			msg.PhotoMimeType = &photoMimeType.String
+		}
+		if editedAt.Valid {
+			msg.EditedAt = &editedAt.Time
+		}
+		if lastReplyAt.Valid {
+			msg.LastReplyAt = &lastReplyAt.Time
+		}
+
+		if msg.IsReply && originalMessageContent.Valid {
+			msg.OriginalMessage = &OriginalMessage{
+				ID:      msg.OriginalMessageID,
+				Content: originalMessageContent.String,
+				Sender:  originalMessageSender.String,
+			}
+			if originalMessageEditedAt.Valid {
+				msg.OriginalMessage.EditedAt = &originalMessageEditedAt.Time
+			}
+		}
+
+		//A message is delivered, and then read, once everyone has received, and then read, it
+		switch {
+		case isRead:
+			msg.Status = "read"
+		case isDelivered:
+			msg.Status = "delivered"
+		default:
+			msg.Status = "sent"
+		}
+
+		messages = append(messages, msg)
+	}
+	if err := messageRows.Err(); err != nil {
+		return nil, fmt.Errorf("error during row iteration: %w", err)
+	}
+
+	//Fetch the reactions of all the messages at once
+	if err := db.loadReactions(ctx, messages); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+//Helper function to fill in the reactions of a list of messages with a single query
+func (db *appdbimpl) loadReactions(ctx context.Context, messages []Message) error {
+	if len(messages) == 0 {
+		return nil
+	}
+
+	placeholders := make([]string, len(messages))
+	args := make([]interface{}, len(messages))
+	byID := make(map[int64]*Message, len(messages))
+	for i := range messages {
+		placeholders[i] = "?"
+		args[i] = messages[i].ID
+		messages[i].Reactions = []Reaction{}
+		byID[messages[i].ID] = &messages[i]
+	}
+
+	reactionRows, err := db.c.QueryContext(ctx, `
+		SELECT user_id, message_id, emoticon
+		FROM reactions
+		WHERE message_id IN (`+strings.Join(placeholders, ", ")+`)`, args...)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve reactions: %w", err)
+	}
+	defer reactionRows.Close()
+
+	for reactionRows.Next() {
+		var reaction Reaction
+		if err := reactionRows.Scan(&reaction.UserID, &reaction.MessageID, &reaction.Emoticon); err != nil {
+			return fmt.Errorf("failed to scan reaction: %w", err)
+		}
+		if msg, ok := byID[reaction.MessageID]; ok {
+			msg.Reactions = append(msg.Reactions, reaction)
+		}
+	}
+	if err := reactionRows.Err(); err != nil {
+		return fmt.Errorf("error during row iteration: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,200 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// messageIDs returns the IDs of the messages of a page, in order
+func messageIDs(page *MessagePage) []int64 {
+	ids := []int64{}
+	for _, msg := range page.Messages {
+		ids = append(ids, msg.ID)
+	}
+	return ids
+}
+
+func TestGetMessagesPaging(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, driver string, sqldb *sql.DB) {
+		f := newFixture(t, driver, sqldb)
+		ctx := context.Background()
+
+		var ids []int64
+		for i := 0; i < 5; i++ {
+			ids = append(ids, f.send(t, f.alice, fmt.Sprintf("message number %d", i), 0))
+		}
+
+		tests := []struct {
+			name          string
+			before, after int64
+			want          []int64
+			hasMore       bool
+			nextCursor    int64
+		}{
+			{"newest", 0, 0, ids[3:5], true, ids[3]},
+			{"older", ids[3], 0, ids[1:3], true, ids[1]},
+			{"oldest", ids[1], 0, ids[0:1], false, 0},
+			{"newer", 0, ids[0], ids[1:3], true, ids[2]},
+			{"newest after", 0, ids[2], ids[3:5], false, 0},
+		}
+		for _, tt := range tests {
+			page, err := f.db.GetMessages(ctx, f.conversationID, f.bob, tt.before, tt.after, 2)
+			if err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+			if got := messageIDs(page); !reflect.DeepEqual(got, tt.want) || page.HasMore != tt.hasMore || page.NextCursor != tt.nextCursor {
+				t.Errorf("%s: got %v, has more %t, next cursor %d, want %v, %t, %d",
+					tt.name, got, page.HasMore, page.NextCursor, tt.want, tt.hasMore, tt.nextCursor)
+			}
+		}
+
+		if _, err := f.db.GetMessages(ctx, f.conversationID, f.bob, ids[3], ids[1], 2); err == nil {
+			t.Error("both cursors were accepted")
+		}
+
+		//Hidden messages are skipped, and don't take the place of others in the page
+		if err := f.db.HideMessage(ctx, f.conversationID, ids[4], f.bob); err != nil {
+			t.Fatal(err)
+		}
+		page, err := f.db.GetMessages(ctx, f.conversationID, f.bob, 0, 0, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := messageIDs(page); !reflect.DeepEqual(got, ids[2:4]) {
+			t.Errorf("bob sees %v after hiding %d, want %v", got, ids[4], ids[2:4])
+		}
+	})
+}
+
+func TestGetMessagesStatus(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, driver string, sqldb *sql.DB) {
+		f := newFixture(t, driver, sqldb)
+		ctx := context.Background()
+		id := f.send(t, f.alice, "hello", 0)
+
+		status := func() string {
+			t.Helper()
+			page, err := f.db.GetMessages(ctx, f.conversationID, f.alice, 0, 0, 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(page.Messages) != 1 {
+				t.Fatalf("got %d messages, want 1", len(page.Messages))
+			}
+			return page.Messages[0].Status
+		}
+
+		if got := status(); got != "sent" {
+			t.Errorf("new message is %s, want sent", got)
+		}
+		if _, err := f.db.MarkMessagesDelivered(ctx, f.conversationID, f.bob, []int64{id}); err != nil {
+			t.Fatal(err)
+		}
+		if got := status(); got != "delivered" {
+			t.Errorf("received message is %s, want delivered", got)
+		}
+		if err := f.db.MarkMessagesAsRead(ctx, f.conversationID, f.bob, 0); err != nil {
+			t.Fatal(err)
+		}
+		if got := status(); got != "read" {
+			t.Errorf("read message is %s, want read", got)
+		}
+	})
+}
+
+// A message of a group is delivered once every participant received it, and read once every participant read it
+func TestGetMessagesStatusInGroup(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, driver string, sqldb *sql.DB) {
+		f := newFixture(t, driver, sqldb)
+		ctx := context.Background()
+
+		carol, err := f.db.CreateUser(ctx, "carol")
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.conversationID, err = f.db.CreateGroupConversation(ctx, f.alice, "friends", "", []int64{f.bob, carol})
+		if err != nil {
+			t.Fatal(err)
+		}
+		id := f.send(t, f.alice, "hello", 0)
+
+		status := func() string {
+			t.Helper()
+			page, err := f.db.GetMessages(ctx, f.conversationID, f.alice, 0, 0, 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return page.Messages[0].Status
+		}
+
+		steps := []struct {
+			name string
+			mark func() error
+			want string
+		}{
+			{"bob read it", func() error { return f.db.MarkMessagesAsRead(ctx, f.conversationID, f.bob, 0) }, "sent"},
+			{"carol received it", func() error {
+				_, err := f.db.MarkMessagesDelivered(ctx, f.conversationID, carol, []int64{id})
+				return err
+			}, "delivered"},
+			{"carol read it", func() error { return f.db.MarkMessagesAsRead(ctx, f.conversationID, carol, 0) }, "read"},
+		}
+		for _, step := range steps {
+			if err := step.mark(); err != nil {
+				t.Fatalf("%s: %v", step.name, err)
+			}
+			if got := status(); got != step.want {
+				t.Errorf("message is %s once %s, want %s", got, step.name, step.want)
+			}
+		}
+	})
+}
+
+// seedConversation fills the conversation of the fixture with n messages, one in ten being a reply to the one before
+// it, and returns their IDs
+func seedConversation(b *testing.B, f *fixture, n int) []int64 {
+	b.Helper()
+	ids := make([]int64, 0, n)
+	for i := 0; i < n; i++ {
+		sender, original := f.alice, int64(0)
+		if i%2 == 1 {
+			sender = f.bob
+		}
+		if i%10 == 9 {
+			original = ids[i-1]
+		}
+		ids = append(ids, f.send(b, sender, fmt.Sprintf("message number %d", i), original))
+	}
+	return ids
+}
+
+func BenchmarkGetMessages(b *testing.B) {
+	for _, size := range []int{100, 1000, 10000} {
+		b.Run(fmt.Sprint(size), func(b *testing.B) {
+			sqldb := openSQLite(b)
+			f := newFixture(b, DriverSQLite, sqldb)
+			ids := seedConversation(b, f, size)
+			ctx := context.Background()
+			b.ResetTimer()
+
+			b.Run("newest", func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					if _, err := f.db.GetMessages(ctx, f.conversationID, f.bob, 0, 0, 50); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+			b.Run("older", func(b *testing.B) {
+				before := ids[len(ids)/2]
+				for i := 0; i < b.N; i++ {
+					if _, err := f.db.GetMessages(ctx, f.conversationID, f.bob, before, 0, 50); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,325 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/Nyheim99/WASAText/service/globaltime"
+)
+
+// Migrations are SQL scripts named <version>_<name>.up.sql and <version>_<name>.down.sql, where version is a number,
+// in the directory of the driver they are written for. They are applied in order of version, each one in its own
+// transaction; the versions applied to a database are recorded in the schema_migrations table. Every driver must have
+// the same migrations, and a migration must never be changed once released: add a new one instead.
+//
+//go:embed migrations/*/*.sql
+var migrationFiles embed.FS
+
+var migrationFileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// ErrUnknownMigration is returned when the database has a migration applied which this build doesn't know about, for
+// example because it was migrated by a newer version of the application
+var ErrUnknownMigration = errors.New("database has unknown migrations applied")
+
+// ErrSchemaOutOfDate is returned by New when the database has pending migrations
+var ErrSchemaOutOfDate = errors.New("database schema is out of date, migrations must be applied first")
+
+// MigrationStatus describes a migration and whether it is applied to the database
+type MigrationStatus struct {
+	Version int
+	Name    string
+
+	// AppliedAt is nil for pending migrations
+	AppliedAt *time.Time
+}
+
+type migration struct {
+	version int
+	name    string
+	up      string
+	down    string
+}
+
+// loadMigrations reads the embedded migrations of a driver, sorted by version
+func loadMigrations(driver string) ([]migration, error) {
+	dir := "migrations/" + driver
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, fmt.Errorf("reading migrations: %w", err)
+	}
+
+	byVersion := make(map[int]*migration)
+	for _, entry := range entries {
+		match := migrationFileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("invalid migration file name %q", entry.Name())
+		}
+		version, _ := strconv.Atoi(match[1])
+
+		content, err := fs.ReadFile(migrationFiles, dir+"/"+entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("reading migration %q: %w", entry.Name(), err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &migration{version: version, name: match[2]}
+			byVersion[version] = m
+		} else if m.name != match[2] {
+			return nil, fmt.Errorf("migrations %q and %q have the same version", m.name, match[2])
+		}
+		if match[3] == "up" {
+			m.up = string(content)
+		} else {
+			m.down = string(content)
+		}
+	}
+
+	migrations := make([]migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.up == "" || m.down == "" {
+			return nil, fmt.Errorf("migration %d_%s must have both an up and a down script", m.version, m.name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].version < migrations[j].version })
+	return migrations, nil
+}
+
+// appliedMigrations returns the versions applied to the database, with the time they were applied
+func appliedMigrations(ctx context.Context, c *conn) (map[int]time.Time, error) {
+	_, err := c.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at BIGINT NOT NULL
+	);`)
+	if err != nil {
+		return nil, fmt.Errorf("creating schema_migrations: %w", err)
+	}
+
+	rows, err := c.QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("reading schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedAt int64
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, fmt.Errorf("reading schema_migrations: %w", err)
+		}
+		applied[version] = time.Unix(appliedAt, 0).UTC()
+	}
+	return applied, rows.Err()
+}
+
+// GetMigrationStatus returns all the known migrations, in order, with the time they were applied to the database. The
+// driver is the name of the database/sql driver of db.
+func GetMigrationStatus(db *sql.DB, driver string) ([]MigrationStatus, error) {
+	c, err := newConn(db, driver)
+	if err != nil {
+		return nil, err
+	}
+	return migrationStatus(context.Background(), c)
+}
+
+func migrationStatus(ctx context.Context, c *conn) ([]MigrationStatus, error) {
+	migrations, err := loadMigrations(c.driver)
+	if err != nil {
+		return nil, err
+	}
+	applied, err := appliedMigrations(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+
+	status := make([]MigrationStatus, 0, len(migrations))
+	for _, m := range migrations {
+		s := MigrationStatus{Version: m.version, Name: m.name}
+		if appliedAt, ok := applied[m.version]; ok {
+			s.AppliedAt = &appliedAt
+			delete(applied, m.version)
+		}
+		status = append(status, s)
+	}
+	if len(applied) > 0 {
+		return status, ErrUnknownMigration
+	}
+	return status, nil
+}
+
+// Migrate applies all the pending migrations to the database, returning the ones that were applied
+func Migrate(db *sql.DB, driver string) ([]MigrationStatus, error) {
+	c, err := newConn(db, driver)
+	if err != nil {
+		return nil, err
+	}
+	ctx := context.Background()
+
+	status, err := migrationStatus(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	migrations, err := loadMigrations(c.driver)
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLite databases created before the blob store are adopted by the initial schema too, see legacyPhotosScript
+	var legacyPhotos bool
+	if c.driver == DriverSQLite && len(status) > 0 && status[0].AppliedAt == nil {
+		if legacyPhotos, err = hasLegacyPhotos(ctx, c); err != nil {
+			return nil, err
+		}
+	}
+
+	var done []MigrationStatus
+	for i, m := range migrations {
+		if status[i].AppliedAt != nil {
+			continue
+		}
+
+		script := m.up
+		if legacyPhotos && i == 0 {
+			script = legacyPhotosScript + script
+		}
+
+		now := globaltime.Now()
+		err = runMigration(ctx, db, c.driver, script, func(tx *txConn) error {
+			// Rollbacks are not checked, as the schemas of the first migrations predate foreign key enforcement. For
+			// the same reason the initial schema isn't either: the databases it adopts reference message 0 when a
+			// message has no original, which the next migration repairs.
+			if c.driver == DriverSQLite && i > 0 {
+				if err := checkForeignKeys(ctx, tx); err != nil {
+					return err
+				}
+			}
+			_, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)`,
+				m.version, m.name, now.Unix())
+			return err
+		})
+		if err != nil {
+			return done, fmt.Errorf("applying migration %d_%s: %w", m.version, m.name, err)
+		}
+		done = append(done, MigrationStatus{Version: m.version, Name: m.name, AppliedAt: &now})
+	}
+	return done, nil
+}
+
+// Rollback reverts the last `steps` applied migrations, returning the ones that were reverted
+func Rollback(db *sql.DB, driver string, steps int) ([]MigrationStatus, error) {
+	c, err := newConn(db, driver)
+	if err != nil {
+		return nil, err
+	}
+	ctx := context.Background()
+
+	status, err := migrationStatus(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	migrations, err := loadMigrations(c.driver)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []MigrationStatus
+	for i := len(migrations) - 1; i >= 0 && len(done) < steps; i-- {
+		m := migrations[i]
+		if status[i].AppliedAt == nil {
+			continue
+		}
+
+		err = runMigration(ctx, db, c.driver, m.down, func(tx *txConn) error {
+			_, err := tx.ExecContext(ctx, `DELETE FROM schema_migrations WHERE version = ?`, m.version)
+			return err
+		})
+		if err != nil {
+			return done, fmt.Errorf("reverting migration %d_%s: %w", m.version, m.name, err)
+		}
+		done = append(done, MigrationStatus{Version: m.version, Name: m.name})
+	}
+	return done, nil
+}
+
+// runMigration runs a migration script and records it with `record`, in a single transaction.
+//
+// SQLite tables can only be rebuilt with foreign keys disabled, which can't be done within a transaction: there the
+// migration runs on a connection of its own with foreign keys disabled.
+func runMigration(ctx context.Context, db *sql.DB, driver string, script string, record func(tx *txConn) error) error {
+	sc, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer sc.Close()
+
+	c, err := newConn(sc, driver)
+	if err != nil {
+		return err
+	}
+
+	if c.driver == DriverSQLite {
+		var foreignKeys bool
+		if err := sc.QueryRowContext(ctx, `PRAGMA foreign_keys`).Scan(&foreignKeys); err != nil {
+			return err
+		}
+		if foreignKeys {
+			if _, err := sc.ExecContext(ctx, `PRAGMA foreign_keys = OFF`); err != nil {
+				return err
+			}
+			defer func() { _, _ = sc.ExecContext(context.Background(), `PRAGMA foreign_keys = ON`) }()
+		}
+	}
+
+	return withTx(ctx, c, func(tx *txConn) error {
+		// Scripts have no placeholders and may contain question marks, so they are not rebound
+		if _, err := tx.tx.ExecContext(ctx, script); err != nil {
+			return err
+		}
+		return record(tx)
+	})
+}
+
+// checkForeignKeys returns an error if a row of a SQLite database references a row which doesn't exist
+func checkForeignKeys(ctx context.Context, tx *txConn) error {
+	rows, err := tx.QueryContext(ctx, `PRAGMA foreign_key_check`)
+	if err != nil {
+		return fmt.Errorf("checking foreign keys: %w", err)
+	}
+	defer rows.Close()
+
+	if rows.Next() {
+		var table, parent string
+		var rowID sql.NullInt64
+		var fkID int
+		if err := rows.Scan(&table, &rowID, &parent, &fkID); err != nil {
+			return fmt.Errorf("checking foreign keys: %w", err)
+		}
+		return fmt.Errorf("row %d of %s references a missing row of %s", rowID.Int64, table, parent)
+	}
+	return rows.Err()
+}
+
+// checkSchema returns ErrSchemaOutOfDate if the database has pending migrations
+func checkSchema(ctx context.Context, c *conn) error {
+	status, err := migrationStatus(ctx, c)
+	if err != nil {
+		return err
+	}
+	for _, s := range status {
+		if s.AppliedAt == nil {
+			return fmt.Errorf("%w: %d_%s is pending", ErrSchemaOutOfDate, s.Version, s.Name)
+		}
+	}
+	return nil
+}
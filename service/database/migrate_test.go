@@ -0,0 +1,90 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+)
+
+// openBaseline opens a database written by the first version of the application, see testdata/baseline.sql, and
+// migrates it
+func openBaseline(t *testing.T) (*sql.DB, AppDatabase) {
+	t.Helper()
+	db := openSQLite(t)
+
+	dump, err := os.ReadFile("testdata/baseline.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(string(dump)); err != nil {
+		t.Fatalf("loading the baseline database: %v", err)
+	}
+
+	if _, err := Migrate(db, DriverSQLite); err != nil {
+		t.Fatalf("migrating the baseline database: %v", err)
+	}
+	appdb, err := New(db, Config{Driver: DriverSQLite})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, appdb
+}
+
+func TestMigrateBaselineDatabase(t *testing.T) {
+	db, appdb := openBaseline(t)
+	ctx := context.Background()
+
+	//The photo was set aside, and the message points to it
+	var photoKey, mimeType string
+	err := db.QueryRow(`SELECT photo_key, photo_mime_type FROM messages WHERE id = 3`).Scan(&photoKey, &mimeType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if photoKey != legacyPhotoKeyPrefix+"3" || mimeType != "image/png" {
+		t.Errorf("photo message has key %q and type %q", photoKey, mimeType)
+	}
+	var size int
+	if err := db.QueryRow(`SELECT LENGTH(data) FROM legacy_message_photos WHERE message_id = 3`).Scan(&size); err != nil {
+		t.Fatal(err)
+	}
+	if size != 73 {
+		t.Errorf("legacy photo has %d bytes, want 73", size)
+	}
+
+	//Messages without an original don't reference message 0 anymore, and replies are threaded
+	rows := map[int64]sql.NullInt64{}
+	r, err := db.QueryContext(ctx, `SELECT id, original_message_id FROM messages`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	for r.Next() {
+		var id int64
+		var original sql.NullInt64
+		if err := r.Scan(&id, &original); err != nil {
+			t.Fatal(err)
+		}
+		rows[id] = original
+	}
+	if len(rows) != 4 || rows[1].Valid || rows[4].Int64 != 1 {
+		t.Errorf("unexpected original messages %v", rows)
+	}
+
+	var rootID int64
+	if err := db.QueryRow(`SELECT thread_root_id FROM messages WHERE id = 4`).Scan(&rootID); err != nil || rootID != 1 {
+		t.Errorf("reply has thread root %d (%v), want 1", rootID, err)
+	}
+
+	//Photos can be sent, now that the CHECK constraint is on photo_key
+	key, mime := "key", "image/png"
+	if _, err := appdb.SendMessage(ctx, 1, 1, nil, &key, &mime, 0); err != nil {
+		t.Errorf("sending a photo: %v", err)
+	}
+
+	//Migrating again does nothing
+	applied, err := Migrate(db, DriverSQLite)
+	if err != nil || len(applied) != 0 {
+		t.Errorf("second migration applied %v (%v)", applied, err)
+	}
+}
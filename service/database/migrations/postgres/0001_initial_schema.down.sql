@@ -0,0 +1,11 @@
+DROP INDEX IF EXISTS idx_messages_conversation;
+DROP INDEX IF EXISTS idx_messages_timestamp;
+DROP TABLE IF EXISTS thumbnails;
+DROP TABLE IF EXISTS sessions;
+DROP TABLE IF EXISTS reactions;
+DROP TABLE IF EXISTS message_status;
+ALTER TABLE IF EXISTS conversations DROP CONSTRAINT IF EXISTS conversations_last_message_id_fkey;
+DROP TABLE IF EXISTS messages;
+DROP TABLE IF EXISTS conversation_participants;
+DROP TABLE IF EXISTS conversations;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,80 @@
+-- Initial schema, matching the one of SQLite databases at the time PostgreSQL support was added.
+
+CREATE TABLE users (
+	id BIGSERIAL PRIMARY KEY,
+	username TEXT UNIQUE NOT NULL CHECK (LENGTH(username) BETWEEN 3 AND 16),
+	photo_url TEXT DEFAULT ''
+);
+
+CREATE TABLE conversations (
+	id BIGSERIAL PRIMARY KEY,
+	name TEXT DEFAULT '',
+	conversation_type TEXT CHECK(conversation_type IN ('private', 'group')) NOT NULL,
+	photo_url TEXT DEFAULT '',
+	last_message_id BIGINT
+);
+
+CREATE TABLE conversation_participants (
+	conversation_id BIGINT NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+	user_id BIGINT NOT NULL REFERENCES users(id),
+	PRIMARY KEY (conversation_id, user_id)
+);
+
+-- original_message_id is 0 for messages which are neither replies nor forwards, so it can't be a foreign key
+CREATE TABLE messages (
+	id BIGSERIAL PRIMARY KEY,
+	conversation_id BIGINT NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+	sender_id BIGINT NOT NULL REFERENCES users(id),
+	content TEXT DEFAULT NULL,
+	photo_key TEXT DEFAULT NULL,
+	photo_mime_type TEXT DEFAULT NULL,
+	timestamp TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	status TEXT CHECK(status IN ('sent', 'read')) DEFAULT 'sent',
+	is_reply BOOLEAN DEFAULT FALSE,
+	original_message_id BIGINT NOT NULL DEFAULT 0,
+	is_forwarded BOOLEAN DEFAULT FALSE,
+	is_deleted BOOLEAN DEFAULT FALSE,
+	CHECK (
+		(content IS NOT NULL AND photo_key IS NULL) OR
+		(content IS NULL AND photo_key IS NOT NULL)
+	)
+);
+
+ALTER TABLE conversations
+	ADD CONSTRAINT conversations_last_message_id_fkey
+	FOREIGN KEY (last_message_id) REFERENCES messages(id) ON DELETE SET NULL;
+
+CREATE TABLE message_status (
+	message_id BIGINT NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+	user_id BIGINT NOT NULL REFERENCES users(id),
+	is_read BOOLEAN DEFAULT FALSE,
+	PRIMARY KEY (message_id, user_id)
+);
+
+CREATE TABLE reactions (
+	message_id BIGINT NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+	user_id BIGINT NOT NULL REFERENCES users(id),
+	emoticon TEXT NOT NULL,
+	PRIMARY KEY (message_id, user_id)
+);
+
+CREATE TABLE sessions (
+	id BIGSERIAL PRIMARY KEY,
+	user_id BIGINT NOT NULL REFERENCES users(id),
+	token_hash TEXT UNIQUE NOT NULL,
+	user_agent TEXT NOT NULL DEFAULT '',
+	created_at BIGINT NOT NULL,
+	last_seen_at BIGINT NOT NULL,
+	expires_at BIGINT NOT NULL
+);
+
+CREATE TABLE thumbnails (
+	blob_key TEXT NOT NULL,
+	size INTEGER NOT NULL,
+	thumbnail_key TEXT NOT NULL,
+	PRIMARY KEY (blob_key, size)
+);
+
+CREATE INDEX idx_messages_timestamp ON messages (conversation_id, timestamp DESC);
+
+CREATE INDEX idx_messages_conversation ON messages (conversation_id, id);
@@ -0,0 +1,7 @@
+ALTER TABLE messages DROP CONSTRAINT IF EXISTS messages_original_message_id_fkey;
+
+UPDATE messages SET original_message_id = 0 WHERE original_message_id IS NULL;
+
+ALTER TABLE messages
+	ALTER COLUMN original_message_id SET DEFAULT 0,
+	ALTER COLUMN original_message_id SET NOT NULL;
@@ -0,0 +1,12 @@
+-- Messages which are neither replies nor forwards get NULL as original_message_id instead of 0, so that it can be a
+-- foreign key like on SQLite.
+
+ALTER TABLE messages
+	ALTER COLUMN original_message_id DROP NOT NULL,
+	ALTER COLUMN original_message_id DROP DEFAULT;
+
+UPDATE messages SET original_message_id = NULL WHERE original_message_id = 0;
+
+ALTER TABLE messages
+	ADD CONSTRAINT messages_original_message_id_fkey
+	FOREIGN KEY (original_message_id) REFERENCES messages(id) ON DELETE SET NULL;
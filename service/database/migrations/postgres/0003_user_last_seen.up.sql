@@ -0,0 +1,4 @@
+-- When users were last active, as a Unix time, NULL if never
+ALTER TABLE users ADD COLUMN last_seen_at BIGINT DEFAULT NULL;
+
+UPDATE users SET last_seen_at = (SELECT MAX(last_seen_at) FROM sessions WHERE sessions.user_id = users.id);
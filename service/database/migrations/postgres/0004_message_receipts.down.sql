@@ -0,0 +1,2 @@
+ALTER TABLE message_status DROP COLUMN read_at;
+ALTER TABLE message_status DROP COLUMN delivered_at;
@@ -0,0 +1,7 @@
+-- Messages users deleted for themselves only, which the other participants still see
+CREATE TABLE hidden_messages (
+	user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	message_id BIGINT NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+	hidden_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (user_id, message_id)
+);
@@ -0,0 +1,3 @@
+DROP INDEX idx_messages_search;
+
+ALTER TABLE messages DROP COLUMN search_vector;
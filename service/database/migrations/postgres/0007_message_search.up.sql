@@ -0,0 +1,6 @@
+-- Full-text index of the text of the messages, kept in sync by PostgreSQL (generated columns need version 12 or
+-- later). Deleted messages are left out by the queries.
+ALTER TABLE messages ADD COLUMN search_vector TSVECTOR
+	GENERATED ALWAYS AS (to_tsvector('simple', COALESCE(content, ''))) STORED;
+
+CREATE INDEX idx_messages_search ON messages USING GIN (search_vector);
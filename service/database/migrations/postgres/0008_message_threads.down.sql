@@ -0,0 +1,3 @@
+DROP INDEX idx_messages_thread;
+
+ALTER TABLE messages DROP COLUMN thread_root_id;
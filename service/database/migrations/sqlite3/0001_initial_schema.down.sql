@@ -0,0 +1,10 @@
+DROP INDEX IF EXISTS idx_messages_conversation;
+DROP INDEX IF EXISTS idx_messages_timestamp;
+DROP TABLE IF EXISTS thumbnails;
+DROP TABLE IF EXISTS sessions;
+DROP TABLE IF EXISTS reactions;
+DROP TABLE IF EXISTS message_status;
+DROP TABLE IF EXISTS messages;
+DROP TABLE IF EXISTS conversation_participants;
+DROP TABLE IF EXISTS conversations;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,87 @@
+-- Schema of the database before versioned migrations were introduced. Statements use IF NOT EXISTS so that databases
+-- created by earlier versions are adopted as they are.
+
+CREATE TABLE IF NOT EXISTS users (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	username TEXT UNIQUE NOT NULL CHECK (LENGTH(username) BETWEEN 3 AND 16),
+	photo_url TEXT DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS conversations (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT DEFAULT '',
+	conversation_type TEXT CHECK(conversation_type IN ('private', 'group')) NOT NULL,
+	photo_url TEXT DEFAULT '',
+	last_message_id INTEGER,
+	FOREIGN KEY (last_message_id) REFERENCES messages(id)
+);
+
+CREATE TABLE IF NOT EXISTS conversation_participants (
+	conversation_id INTEGER NOT NULL,
+	user_id INTEGER NOT NULL,
+	PRIMARY KEY (conversation_id, user_id),
+	FOREIGN KEY (conversation_id) REFERENCES conversations(id),
+	FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS messages (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	conversation_id INTEGER NOT NULL,
+	sender_id INTEGER NOT NULL,
+	content TEXT DEFAULT NULL,
+	photo_key TEXT DEFAULT NULL,
+	photo_mime_type TEXT DEFAULT NULL,
+	timestamp DATETIME DEFAULT CURRENT_TIMESTAMP,
+	status TEXT CHECK(status IN ('sent', 'read')) DEFAULT 'sent',
+	is_reply BOOLEAN DEFAULT FALSE,
+	original_message_id INTEGER NOT NULL DEFAULT 0,
+	is_forwarded BOOLEAN DEFAULT FALSE,
+	is_deleted BOOLEAN DEFAULT FALSE,
+	CHECK (
+		(content IS NOT NULL AND photo_key IS NULL) OR
+		(content IS NULL AND photo_key IS NOT NULL)
+	),
+	FOREIGN KEY (conversation_id) REFERENCES conversations(id),
+	FOREIGN KEY (sender_id) REFERENCES users(id),
+	FOREIGN KEY (original_message_id) REFERENCES messages(id)
+);
+
+CREATE TABLE IF NOT EXISTS message_status (
+	message_id INTEGER NOT NULL,
+	user_id INTEGER NOT NULL,
+	is_read BOOLEAN DEFAULT FALSE,
+	FOREIGN KEY (message_id) REFERENCES messages(id),
+	FOREIGN KEY (user_id) REFERENCES users(id),
+	PRIMARY KEY (message_id, user_id)
+);
+
+CREATE TABLE IF NOT EXISTS reactions (
+	message_id INTEGER NOT NULL,
+	user_id INTEGER NOT NULL,
+	emoticon TEXT NOT NULL,
+	FOREIGN KEY (message_id) REFERENCES messages(id),
+	FOREIGN KEY (user_id) REFERENCES users(id),
+	PRIMARY KEY (message_id, user_id)
+);
+
+CREATE TABLE IF NOT EXISTS sessions (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL,
+	token_hash TEXT UNIQUE NOT NULL,
+	user_agent TEXT NOT NULL DEFAULT '',
+	created_at INTEGER NOT NULL,
+	last_seen_at INTEGER NOT NULL,
+	expires_at INTEGER NOT NULL,
+	FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS thumbnails (
+	blob_key TEXT NOT NULL,
+	size INTEGER NOT NULL,
+	thumbnail_key TEXT NOT NULL,
+	PRIMARY KEY (blob_key, size)
+);
+
+CREATE INDEX IF NOT EXISTS idx_messages_timestamp ON messages (conversation_id, timestamp DESC);
+
+CREATE INDEX IF NOT EXISTS idx_messages_conversation ON messages (conversation_id, id);
@@ -0,0 +1,38 @@
+-- Messages which are neither replies nor forwards had 0 as original_message_id, which breaks its foreign key once
+-- foreign keys are enforced: they get NULL instead. SQLite can't alter a column, so the table is rebuilt.
+
+CREATE TABLE messages_new (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	conversation_id INTEGER NOT NULL,
+	sender_id INTEGER NOT NULL,
+	content TEXT DEFAULT NULL,
+	photo_key TEXT DEFAULT NULL,
+	photo_mime_type TEXT DEFAULT NULL,
+	timestamp DATETIME DEFAULT CURRENT_TIMESTAMP,
+	status TEXT CHECK(status IN ('sent', 'read')) DEFAULT 'sent',
+	is_reply BOOLEAN DEFAULT FALSE,
+	original_message_id INTEGER DEFAULT NULL,
+	is_forwarded BOOLEAN DEFAULT FALSE,
+	is_deleted BOOLEAN DEFAULT FALSE,
+	CHECK (
+		(content IS NOT NULL AND photo_key IS NULL) OR
+		(content IS NULL AND photo_key IS NOT NULL)
+	),
+	FOREIGN KEY (conversation_id) REFERENCES conversations(id),
+	FOREIGN KEY (sender_id) REFERENCES users(id),
+	FOREIGN KEY (original_message_id) REFERENCES messages(id) ON DELETE SET NULL
+);
+
+INSERT INTO messages_new (id, conversation_id, sender_id, content, photo_key, photo_mime_type, timestamp, status,
+	is_reply, original_message_id, is_forwarded, is_deleted)
+SELECT id, conversation_id, sender_id, content, photo_key, photo_mime_type, timestamp, status,
+	is_reply, NULLIF(original_message_id, 0), is_forwarded, is_deleted
+FROM messages;
+
+DROP TABLE messages;
+
+ALTER TABLE messages_new RENAME TO messages;
+
+CREATE INDEX idx_messages_timestamp ON messages (conversation_id, timestamp DESC);
+
+CREATE INDEX idx_messages_conversation ON messages (conversation_id, id);
@@ -0,0 +1,4 @@
+-- When each recipient received and read a message, as Unix times. They are NULL when it didn't happen yet, and for the
+-- messages read before they were recorded.
+ALTER TABLE message_status ADD COLUMN delivered_at INTEGER DEFAULT NULL;
+ALTER TABLE message_status ADD COLUMN read_at INTEGER DEFAULT NULL;
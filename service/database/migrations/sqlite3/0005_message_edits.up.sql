@@ -0,0 +1,13 @@
+-- Messages keep when their text was last edited, and the versions it replaced
+ALTER TABLE messages ADD COLUMN edited_at DATETIME DEFAULT NULL;
+
+CREATE TABLE message_edits (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	message_id INTEGER NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+	content TEXT NOT NULL,
+
+	-- When this version was replaced by the next one
+	replaced_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_message_edits_message ON message_edits (message_id, id);
@@ -0,0 +1,34 @@
+-- Full-text index of the text of the messages. The text is read from messages, and the triggers keep the index in sync
+-- with it. Deleted messages are left out by the queries. Like the 'simple' configuration of PostgreSQL, the tokenizer
+-- folds the case but keeps the diacritics, so that both databases find the same messages.
+CREATE VIRTUAL TABLE messages_fts USING fts5(
+	content,
+	content = 'messages',
+	content_rowid = 'id',
+	tokenize = 'unicode61 remove_diacritics 0'
+);
+
+INSERT INTO messages_fts (rowid, content)
+SELECT id, content FROM messages WHERE content IS NOT NULL;
+
+CREATE TRIGGER messages_fts_insert AFTER INSERT ON messages
+WHEN new.content IS NOT NULL
+BEGIN
+	INSERT INTO messages_fts (rowid, content) VALUES (new.id, new.content);
+END;
+
+-- Entries are removed with the text they were indexed with
+CREATE TRIGGER messages_fts_delete AFTER DELETE ON messages
+WHEN old.content IS NOT NULL
+BEGIN
+	INSERT INTO messages_fts (messages_fts, rowid, content) VALUES ('delete', old.id, old.content);
+END;
+
+-- A single trigger, as the old text must be removed before the new one is added
+CREATE TRIGGER messages_fts_update AFTER UPDATE OF content ON messages
+BEGIN
+	INSERT INTO messages_fts (messages_fts, rowid, content)
+	SELECT 'delete', old.id, old.content WHERE old.content IS NOT NULL;
+	INSERT INTO messages_fts (rowid, content)
+	SELECT new.id, new.content WHERE new.content IS NOT NULL;
+END;
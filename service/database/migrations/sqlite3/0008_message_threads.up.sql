@@ -0,0 +1,12 @@
+-- Replies belong to the thread of the first message of their reply chain, its root
+ALTER TABLE messages ADD COLUMN thread_root_id INTEGER DEFAULT NULL REFERENCES messages(id) ON DELETE SET NULL;
+
+WITH RECURSIVE thread (id, root_id) AS (
+	SELECT id, id FROM messages WHERE NOT is_reply OR original_message_id IS NULL
+	UNION ALL
+	SELECT m.id, thread.root_id FROM messages m JOIN thread ON m.original_message_id = thread.id WHERE m.is_reply
+)
+UPDATE messages SET thread_root_id = (SELECT root_id FROM thread WHERE thread.id = messages.id)
+WHERE is_reply AND original_message_id IS NOT NULL;
+
+CREATE INDEX idx_messages_thread ON messages (thread_root_id, id);
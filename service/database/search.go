@@ -0,0 +1,146 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"strings"
+	"time"
+)
+
+// Markers around the words matching a search, in the snippets of SearchResult
+const (
+	highlightStart = "<mark>"
+	highlightEnd   = "</mark>"
+)
+
+// Markers the databases put around the words matching a search. They are control characters, which the text of a
+// message can't contain, so that they are told apart from the text when it is escaped, see highlight.
+const (
+	matchStart = "\x02"
+	matchEnd   = "\x03"
+)
+
+// SearchFilter restricts a message search. Zero values don't restrict it.
+type SearchFilter struct {
+	ConversationID int64
+	SenderID       int64
+
+	// Before restricts the search to the messages sent before this time
+	Before time.Time
+}
+
+// SearchResult is a message matching a search, with a snippet of its text where the matching words are highlighted. The
+// snippet is HTML, with the text escaped.
+type SearchResult struct {
+	MessageID      int64     `json:"message_id"`
+	ConversationID int64     `json:"conversation_id"`
+	SenderID       int64     `json:"sender_id"`
+	SenderUsername string    `json:"sender_username"`
+	Timestamp      time.Time `json:"timestamp"`
+	Snippet        string    `json:"snippet"`
+}
+
+type SearchPage struct {
+	Results    []SearchResult `json:"results"`
+	HasMore    bool           `json:"has_more"`
+	NextOffset int            `json:"next_offset,omitempty"`
+}
+
+//Search the messages of the conversations of a user containing every word of text, best matches first. Deleted
+//messages and the ones the user hid are left out. Pages of at most limit results are skipped with offset.
+func (db *appdbimpl) SearchMessages(ctx context.Context, userID int64, text string, filter SearchFilter, limit, offset int) (*SearchPage, error) {
+	ctx, cancel := db.timeout(ctx)
+	defer cancel()
+
+	page := SearchPage{Results: []SearchResult{}}
+	terms := strings.Fields(text)
+	if len(terms) == 0 {
+		return &page, nil
+	}
+
+	//The two databases have their own full-text search, see the message_search migration
+	var from, match, snippet, rank string
+	var args []interface{}
+	if db.c.driver == DriverPostgres {
+		from = "messages m CROSS JOIN plainto_tsquery('simple', ?) AS q(query)"
+		match = "m.search_vector @@ q.query"
+		snippet = `ts_headline('simple', m.content, q.query, 'StartSel="` + matchStart + `", StopSel="` + matchEnd + `", MinWords=5, MaxWords=20')`
+		rank = "ts_rank(m.search_vector, q.query) DESC"
+		args = append(args, text, userID, userID)
+	} else {
+		//Every term is quoted, so that the text is never read as FTS5 query syntax
+		quoted := make([]string, len(terms))
+		for i, term := range terms {
+			quoted[i] = `"` + strings.ReplaceAll(term, `"`, `""`) + `"`
+		}
+		from = "messages_fts JOIN messages m ON m.id = messages_fts.rowid"
+		match = "messages_fts MATCH ?"
+		snippet = "snippet(messages_fts, 0, '" + matchStart + "', '" + matchEnd + "', '...', 16)"
+		rank = "messages_fts.rank"
+		args = append(args, userID, strings.Join(quoted, " "), userID)
+	}
+
+	conditions := ""
+	if filter.ConversationID > 0 {
+		conditions += " AND m.conversation_id = ?"
+		args = append(args, filter.ConversationID)
+	}
+	if filter.SenderID > 0 {
+		conditions += " AND m.sender_id = ?"
+		args = append(args, filter.SenderID)
+	}
+	if !filter.Before.IsZero() {
+		//SQLite keeps the time as the text written by CURRENT_TIMESTAMP, and compares it as such
+		var before interface{} = filter.Before
+		if db.c.driver == DriverSQLite {
+			before = filter.Before.UTC().Format("2006-01-02 15:04:05")
+		}
+		conditions += " AND m.timestamp < ?"
+		args = append(args, before)
+	}
+
+	//Fetch one result more than requested, to know if there are more pages
+	rows, err := db.c.QueryContext(ctx, `
+		SELECT m.id, m.conversation_id, m.sender_id, u.username, m.timestamp, `+snippet+`
+		FROM `+from+`
+		JOIN users u ON u.id = m.sender_id
+		JOIN conversation_participants cp ON cp.conversation_id = m.conversation_id AND cp.user_id = ?
+		WHERE `+match+` AND NOT m.is_deleted
+			AND NOT EXISTS (
+				SELECT 1 FROM hidden_messages h WHERE h.message_id = m.id AND h.user_id = ?
+			)`+conditions+`
+		ORDER BY `+rank+`, m.id DESC
+		LIMIT ? OFFSET ?`, append(args, limit+1, offset)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search messages: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var result SearchResult
+		err := rows.Scan(&result.MessageID, &result.ConversationID, &result.SenderID, &result.SenderUsername,
+			&result.Timestamp, &result.Snippet)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan search result: %w", err)
+		}
+		result.Snippet = highlight(result.Snippet)
+		page.Results = append(page.Results, result)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error during row iteration: %w", err)
+	}
+
+	if len(page.Results) > limit {
+		page.Results = page.Results[:limit]
+		page.HasMore = true
+		page.NextOffset = offset + limit
+	}
+	return &page, nil
+}
+
+// highlight escapes the text of a snippet for HTML, and replaces the markers around the matching words with
+// highlightStart and highlightEnd
+func highlight(snippet string) string {
+	return strings.NewReplacer(matchStart, highlightStart, matchEnd, highlightEnd).Replace(html.EscapeString(snippet))
+}
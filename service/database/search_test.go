@@ -0,0 +1,107 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSearchMessages(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, driver string, sqldb *sql.DB) {
+		f := newFixture(t, driver, sqldb)
+		ctx := context.Background()
+
+		coffee := f.send(t, f.alice, "Shall we grab a coffee tomorrow?", 0)
+		f.send(t, f.bob, "Sure, coffee sounds good", coffee)
+		f.send(t, f.alice, "See you at the station", 0)
+		deleted := f.send(t, f.alice, "coffee is cancelled", 0)
+		if err := f.db.DeleteMessage(ctx, f.conversationID, deleted, f.alice, time.Time{}); err != nil {
+			t.Fatal(err)
+		}
+
+		page, err := f.db.SearchMessages(ctx, f.bob, "coffee", SearchFilter{}, 10, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page.Results) != 2 || page.HasMore {
+			t.Fatalf("search returned %+v, want the two messages not deleted", page)
+		}
+		for _, result := range page.Results {
+			if result.MessageID == deleted {
+				t.Errorf("deleted message %d was found", deleted)
+			}
+			if !strings.Contains(result.Snippet, highlightStart+"coffee"+highlightEnd) {
+				t.Errorf("snippet %q doesn't highlight the match", result.Snippet)
+			}
+		}
+
+		//The text around the matches is escaped
+		markup := f.send(t, f.alice, `<b>coffee</b> & "cake"`, 0)
+		page, err = f.db.SearchMessages(ctx, f.bob, "cake", SearchFilter{}, 10, 0)
+		if err != nil || len(page.Results) != 1 || page.Results[0].MessageID != markup {
+			t.Fatalf("search of a message with markup returned %+v (%v), want message %d", page, err, markup)
+		}
+		want := `&lt;b&gt;coffee&lt;/b&gt; &amp; &#34;` + highlightStart + `cake` + highlightEnd + `&#34;`
+		if page.Results[0].Snippet != want {
+			t.Errorf("snippet %q, want %q", page.Results[0].Snippet, want)
+		}
+		if err := f.db.DeleteMessage(ctx, f.conversationID, markup, f.alice, time.Time{}); err != nil {
+			t.Fatal(err)
+		}
+
+		//Every word must match, whatever its case, and operators of the search syntax are plain text
+		page, err = f.db.SearchMessages(ctx, f.bob, "COFFEE tomorrow", SearchFilter{}, 10, 0)
+		if err != nil || len(page.Results) != 1 || page.Results[0].MessageID != coffee {
+			t.Errorf("search of two words returned %+v (%v), want message %d", page, err, coffee)
+		}
+		if _, err := f.db.SearchMessages(ctx, f.bob, `coffee" OR "NEAR(`, SearchFilter{}, 10, 0); err != nil {
+			t.Errorf("search with query syntax failed: %v", err)
+		}
+
+		//Diacritics are significant on both databases
+		cafe := f.send(t, f.bob, "Meet me at the café", 0)
+		page, err = f.db.SearchMessages(ctx, f.alice, "Café", SearchFilter{}, 10, 0)
+		if err != nil || len(page.Results) != 1 || page.Results[0].MessageID != cafe {
+			t.Errorf("search of a word with diacritics returned %+v (%v), want message %d", page, err, cafe)
+		}
+		page, err = f.db.SearchMessages(ctx, f.alice, "cafe", SearchFilter{}, 10, 0)
+		if err != nil || len(page.Results) != 0 {
+			t.Errorf("search of a word without diacritics returned %+v (%v), want nothing", page, err)
+		}
+
+		//Filters and pages
+		page, err = f.db.SearchMessages(ctx, f.alice, "coffee", SearchFilter{SenderID: f.bob}, 10, 0)
+		if err != nil || len(page.Results) != 1 || page.Results[0].SenderUsername != "bob" {
+			t.Errorf("search by sender returned %+v (%v)", page, err)
+		}
+		page, err = f.db.SearchMessages(ctx, f.alice, "coffee", SearchFilter{}, 1, 0)
+		if err != nil || len(page.Results) != 1 || !page.HasMore || page.NextOffset != 1 {
+			t.Errorf("first page returned %+v (%v)", page, err)
+		}
+		page, err = f.db.SearchMessages(ctx, f.alice, "coffee", SearchFilter{Before: time.Now().Add(-time.Hour)}, 10, 0)
+		if err != nil || len(page.Results) != 0 {
+			t.Errorf("search of older messages returned %+v (%v)", page, err)
+		}
+
+		//Only the conversations of the user are searched
+		carol, err := f.db.CreateUser(ctx, "carol")
+		if err != nil {
+			t.Fatal(err)
+		}
+		page, err = f.db.SearchMessages(ctx, carol, "coffee", SearchFilter{}, 10, 0)
+		if err != nil || len(page.Results) != 0 {
+			t.Errorf("search of another user returned %+v (%v)", page, err)
+		}
+
+		//The index follows edits
+		if err := f.db.EditMessage(ctx, f.conversationID, coffee, f.alice, "Shall we grab a tea tomorrow?", time.Time{}); err != nil {
+			t.Fatal(err)
+		}
+		page, err = f.db.SearchMessages(ctx, f.bob, "tea", SearchFilter{}, 10, 0)
+		if err != nil || len(page.Results) != 1 || page.Results[0].MessageID != coffee {
+			t.Errorf("search after an edit returned %+v (%v)", page, err)
+		}
+	})
+}
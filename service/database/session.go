@@ -0,0 +1,146 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Nyheim99/WASAText/service/globaltime"
+)
+
+// ErrSessionNotFound is returned when a session does not exist or does not belong to the user
+var ErrSessionNotFound = errors.New("session not found")
+
+// sessionTouchInterval limits how often the last seen time of a session is written
+const sessionTouchInterval = 60
+
+//Stores a new session for the user, identified by the hash of its token
+func (db *appdbimpl) CreateSession(ctx context.Context, userID int64, tokenHash, userAgent string, expiresAt time.Time) error {
+	ctx, cancel := db.timeout(ctx)
+	defer cancel()
+
+	now := globaltime.Now().Unix()
+
+	return withTx(ctx, db.c, func(tx *txConn) error {
+
+		//Clean up the user's expired sessions while we are at it
+		_, err := tx.ExecContext(ctx, `DELETE FROM sessions WHERE user_id = ? AND expires_at <= ?`, userID, now)
+		if err != nil {
+			return fmt.Errorf("failed to remove expired sessions: %w", err)
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO sessions (user_id, token_hash, user_agent, created_at, last_seen_at, expires_at)
+			VALUES (?, ?, ?, ?, ?, ?)
+		`, userID, tokenHash, userAgent, now, now, expiresAt.Unix())
+		if err != nil {
+			return fmt.Errorf("failed to create session: %w", err)
+		}
+		return nil
+	})
+}
+
+//Get a session using the hash of its token, returns nil if the session does not exist or has expired
+func (db *appdbimpl) GetSession(ctx context.Context, tokenHash string) (*Session, error) {
+	ctx, cancel := db.timeout(ctx)
+	defer cancel()
+
+	row := db.c.QueryRowContext(ctx, `
+		SELECT id, user_id, user_agent, created_at, last_seen_at, expires_at
+		FROM sessions
+		WHERE token_hash = ? AND expires_at > ?
+	`, tokenHash, globaltime.Now().Unix())
+
+	session, err := scanSession(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error retrieving session: %w", err)
+	}
+	return session, nil
+}
+
+//Updates the last seen time of a session, at most once every sessionTouchInterval seconds
+func (db *appdbimpl) TouchSession(ctx context.Context, sessionID int64) error {
+	ctx, cancel := db.timeout(ctx)
+	defer cancel()
+
+	now := globaltime.Now().Unix()
+	_, err := db.c.ExecContext(ctx, `
+		UPDATE sessions SET last_seen_at = ? WHERE id = ? AND last_seen_at <= ?
+	`, now, sessionID, now-sessionTouchInterval)
+	if err != nil {
+		return fmt.Errorf("failed to update session: %w", err)
+	}
+	return nil
+}
+
+//Get all of a user's active sessions, most recently used first
+func (db *appdbimpl) GetSessions(ctx context.Context, userID int64) ([]Session, error) {
+	ctx, cancel := db.timeout(ctx)
+	defer cancel()
+
+	rows, err := db.c.QueryContext(ctx, `
+		SELECT id, user_id, user_agent, created_at, last_seen_at, expires_at
+		FROM sessions
+		WHERE user_id = ? AND expires_at > ?
+		ORDER BY last_seen_at DESC, id DESC
+	`, userID, globaltime.Now().Unix())
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sessions: %w", err)
+	}
+	defer rows.Close()
+
+	sessions := []Session{}
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan session: %w", err)
+		}
+		sessions = append(sessions, *session)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error during row iteration: %w", err)
+	}
+
+	return sessions, nil
+}
+
+//Deletes one of the user's sessions, logging out the device that owns it
+func (db *appdbimpl) DeleteSession(ctx context.Context, userID, sessionID int64) error {
+	ctx, cancel := db.timeout(ctx)
+	defer cancel()
+
+	result, err := db.c.ExecContext(ctx, `DELETE FROM sessions WHERE id = ? AND user_id = ?`, sessionID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+	if affected == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanSession(row rowScanner) (*Session, error) {
+	var session Session
+	var createdAt, lastSeenAt, expiresAt int64
+	err := row.Scan(&session.ID, &session.UserID, &session.UserAgent, &createdAt, &lastSeenAt, &expiresAt)
+	if err != nil {
+		return nil, err
+	}
+	session.CreatedAt = time.Unix(createdAt, 0).UTC()
+	session.LastSeenAt = time.Unix(lastSeenAt, 0).UTC()
+	session.ExpiresAt = time.Unix(expiresAt, 0).UTC()
+	return &session, nil
+}
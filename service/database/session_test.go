@@ -0,0 +1,93 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Nyheim99/WASAText/service/globaltime"
+)
+
+func TestSessions(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, driver string, sqldb *sql.DB) {
+		now := time.Date(2024, 2, 2, 15, 4, 5, 0, time.UTC)
+		globaltime.FixedTime = now
+		defer func() { globaltime.FixedTime = time.Time{} }()
+
+		f := newFixture(t, driver, sqldb)
+		ctx := context.Background()
+
+		if err := f.db.CreateSession(ctx, f.alice, "expired", "old phone", now.Add(time.Minute)); err != nil {
+			t.Fatal(err)
+		}
+		if err := f.db.CreateSession(ctx, f.alice, "laptop", "laptop", now.Add(time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+
+		session, err := f.db.GetSession(ctx, "laptop")
+		if err != nil || session == nil {
+			t.Fatalf("GetSession returned %v (%v)", session, err)
+		}
+		if session.UserID != f.alice || session.UserAgent != "laptop" || !session.CreatedAt.Equal(now) ||
+			!session.ExpiresAt.Equal(now.Add(time.Hour)) {
+			t.Errorf("unexpected session %+v", session)
+		}
+		if session, err := f.db.GetSession(ctx, "unknown"); session != nil || err != nil {
+			t.Errorf("unknown token returned %v (%v)", session, err)
+		}
+
+		//Expired sessions can't be used, and are removed when the user logs in again
+		globaltime.FixedTime = now.Add(2 * time.Minute)
+		if session, err := f.db.GetSession(ctx, "expired"); session != nil || err != nil {
+			t.Errorf("expired session returned %v (%v)", session, err)
+		}
+		if err := f.db.CreateSession(ctx, f.alice, "phone", "phone", now.Add(time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+		if n := count(t, driver, sqldb, `SELECT COUNT(*) FROM sessions WHERE token_hash = 'expired'`); n != 0 {
+			t.Error("expired session was kept")
+		}
+
+		//The last seen time is written at most once a minute
+		laptop := session.ID
+		globaltime.FixedTime = now.Add(2*time.Minute + 30*time.Second)
+		if err := f.db.TouchSession(ctx, laptop); err != nil {
+			t.Fatal(err)
+		}
+		sessions, err := f.db.GetSessions(ctx, f.alice)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(sessions) != 2 || sessions[0].UserAgent != "laptop" || !sessions[0].LastSeenAt.Equal(globaltime.Now()) {
+			t.Errorf("unexpected sessions after using the laptop %+v", sessions)
+		}
+
+		globaltime.FixedTime = now.Add(3 * time.Minute)
+		if err := f.db.TouchSession(ctx, laptop); err != nil {
+			t.Fatal(err)
+		}
+		sessions, err = f.db.GetSessions(ctx, f.alice)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(sessions) != 2 || !sessions[0].LastSeenAt.Equal(now.Add(2*time.Minute+30*time.Second)) {
+			t.Errorf("session touched again after 30 seconds %+v", sessions)
+		}
+
+		//Only the user can delete their sessions
+		if err := f.db.DeleteSession(ctx, f.bob, laptop); !errors.Is(err, ErrSessionNotFound) {
+			t.Errorf("bob deleting alice's session returned %v, want ErrSessionNotFound", err)
+		}
+		if err := f.db.DeleteSession(ctx, f.alice, laptop); err != nil {
+			t.Fatal(err)
+		}
+		if session, err := f.db.GetSession(ctx, "laptop"); session != nil || err != nil {
+			t.Errorf("deleted session returned %v (%v)", session, err)
+		}
+		if err := f.db.DeleteSession(ctx, f.alice, laptop); !errors.Is(err, ErrSessionNotFound) {
+			t.Errorf("deleting the session again returned %v, want ErrSessionNotFound", err)
+		}
+	})
+}
@@ -0,0 +1,129 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SQLiteOptions are the settings of the connections to a SQLite database
+type SQLiteOptions struct {
+	// ForeignKeys enables the enforcement of the FOREIGN KEY clauses of the schema
+	ForeignKeys bool
+
+	// JournalMode is one of DELETE, TRUNCATE, PERSIST, MEMORY, WAL or OFF; WAL lets readers and a writer work
+	// concurrently. Empty keeps the mode of the database.
+	JournalMode string
+
+	// BusyTimeout is how long a connection waits for a lock held by another one, before failing with "database is
+	// locked"
+	BusyTimeout time.Duration
+
+	// Synchronous is one of OFF, NORMAL, FULL or EXTRA. Empty keeps the default of SQLite.
+	Synchronous string
+}
+
+var (
+	sqliteJournalModes = []string{"DELETE", "TRUNCATE", "PERSIST", "MEMORY", "WAL", "OFF"}
+	sqliteSynchronous  = []string{"OFF", "NORMAL", "FULL", "EXTRA"}
+)
+
+// SQLiteDataSource returns the data source name to open the SQLite database in filename with the sqlite3 driver. The
+// options are applied to every connection of the pool as it is opened.
+func SQLiteDataSource(filename string, opts SQLiteOptions) (string, error) {
+	journalMode := strings.ToUpper(opts.JournalMode)
+	if journalMode != "" && !contains(sqliteJournalModes, journalMode) {
+		return "", fmt.Errorf("invalid SQLite journal mode %q", opts.JournalMode)
+	}
+	synchronous := strings.ToUpper(opts.Synchronous)
+	if synchronous != "" && !contains(sqliteSynchronous, synchronous) {
+		return "", fmt.Errorf("invalid SQLite synchronous setting %q", opts.Synchronous)
+	}
+	if opts.BusyTimeout < 0 {
+		return "", fmt.Errorf("invalid SQLite busy timeout %s", opts.BusyTimeout)
+	}
+
+	params := url.Values{}
+	params.Set("_foreign_keys", strconv.FormatBool(opts.ForeignKeys))
+	params.Set("_busy_timeout", strconv.FormatInt(opts.BusyTimeout.Milliseconds(), 10))
+	if journalMode != "" {
+		params.Set("_journal_mode", journalMode)
+	}
+	if synchronous != "" {
+		params.Set("_synchronous", synchronous)
+	}
+
+	// Transactions take the write lock when they begin: a transaction which starts reading and later writes can't
+	// wait for the lock, and fails immediately if another connection is writing
+	params.Set("_txlock", "immediate")
+
+	separator := "?"
+	if strings.Contains(filename, "?") {
+		separator = "&"
+	}
+	return filename + separator + params.Encode(), nil
+}
+
+// GetSQLiteSettings returns the settings in effect on a connection to a SQLite database, to check that the ones
+// requested with SQLiteDataSource were applied
+func GetSQLiteSettings(ctx context.Context, db *sql.DB) (SQLiteOptions, error) {
+	var opts SQLiteOptions
+	var busyTimeout int64
+	var synchronous int
+
+	// Settings are per connection: read them all from the same one
+	c, err := db.Conn(ctx)
+	if err != nil {
+		return opts, err
+	}
+	defer c.Close()
+
+	if err := c.QueryRowContext(ctx, `PRAGMA foreign_keys`).Scan(&opts.ForeignKeys); err != nil {
+		return opts, fmt.Errorf("reading foreign_keys: %w", err)
+	}
+	if err := c.QueryRowContext(ctx, `PRAGMA journal_mode`).Scan(&opts.JournalMode); err != nil {
+		return opts, fmt.Errorf("reading journal_mode: %w", err)
+	}
+	if err := c.QueryRowContext(ctx, `PRAGMA busy_timeout`).Scan(&busyTimeout); err != nil {
+		return opts, fmt.Errorf("reading busy_timeout: %w", err)
+	}
+	if err := c.QueryRowContext(ctx, `PRAGMA synchronous`).Scan(&synchronous); err != nil {
+		return opts, fmt.Errorf("reading synchronous: %w", err)
+	}
+
+	opts.JournalMode = strings.ToUpper(opts.JournalMode)
+	opts.BusyTimeout = time.Duration(busyTimeout) * time.Millisecond
+	if synchronous >= 0 && synchronous < len(sqliteSynchronous) {
+		opts.Synchronous = sqliteSynchronous[synchronous]
+	} else {
+		opts.Synchronous = strconv.Itoa(synchronous)
+	}
+	return opts, nil
+}
+
+// CheckSQLiteFTS5 returns an error if the SQLite library the sqlite3 driver was built with has no FTS5, which message
+// search needs. The driver includes it only when built with the sqlite_fts5 tag.
+func CheckSQLiteFTS5(ctx context.Context, db *sql.DB) error {
+	var enabled bool
+	if err := db.QueryRowContext(ctx, `SELECT sqlite_compileoption_used('ENABLE_FTS5')`).Scan(&enabled); err != nil {
+		return fmt.Errorf("checking for FTS5: %w", err)
+	}
+	if !enabled {
+		return errors.New("SQLite was built without FTS5: build with -tags sqlite_fts5")
+	}
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,86 @@
+-- Dump of a database written by the first version of WASAText, before versioned migrations: message photos are in
+-- messages.photo_data and profile and group photos are files under service/photos.
+PRAGMA foreign_keys=OFF;
+BEGIN TRANSACTION;
+CREATE TABLE users (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			username TEXT UNIQUE NOT NULL CHECK (LENGTH(username) BETWEEN 3 AND 16),
+			photo_url TEXT DEFAULT ''
+		);
+INSERT INTO users VALUES(1,'alice','/service/photos/users/user_1.png');
+INSERT INTO users VALUES(2,'bob','');
+CREATE TABLE conversations (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT DEFAULT '',
+			conversation_type TEXT CHECK(conversation_type IN ('private', 'group')) NOT NULL,
+			photo_url TEXT DEFAULT '',
+			last_message_id INTEGER,
+			FOREIGN KEY (last_message_id) REFERENCES messages(id)
+		);
+INSERT INTO conversations VALUES(1,'','private','',4);
+INSERT INTO conversations VALUES(2,'grp','group','/service/photos/groups/group_2.png',NULL);
+CREATE TABLE conversation_participants (
+			conversation_id INTEGER NOT NULL,
+			user_id INTEGER NOT NULL,
+			PRIMARY KEY (conversation_id, user_id),
+			FOREIGN KEY (conversation_id) REFERENCES conversations(id),
+			FOREIGN KEY (user_id) REFERENCES users(id)
+		);
+INSERT INTO conversation_participants VALUES(1,2);
+INSERT INTO conversation_participants VALUES(1,1);
+INSERT INTO conversation_participants VALUES(2,2);
+INSERT INTO conversation_participants VALUES(2,1);
+CREATE TABLE messages (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		conversation_id INTEGER NOT NULL,
+		sender_id INTEGER NOT NULL,
+		content TEXT DEFAULT NULL,
+		photo_data BLOB DEFAULT NULL,
+		photo_mime_type TEXT DEFAULT NULL,
+		timestamp DATETIME DEFAULT CURRENT_TIMESTAMP,
+		status TEXT CHECK(status IN ('sent', 'read')) DEFAULT 'sent',
+		is_reply BOOLEAN DEFAULT FALSE,
+		original_message_id INTEGER NOT NULL DEFAULT 0,
+		is_forwarded BOOLEAN DEFAULT FALSE,
+		is_deleted BOOLEAN DEFAULT FALSE,
+		CHECK (
+			(content IS NOT NULL AND photo_data IS NULL) OR
+			(content IS NULL AND photo_data IS NOT NULL)
+		),
+		FOREIGN KEY (conversation_id) REFERENCES conversations(id),
+		FOREIGN KEY (sender_id) REFERENCES users(id),
+		FOREIGN KEY (original_message_id) REFERENCES messages(id)
+		);
+INSERT INTO messages VALUES(1,1,1,'hello',NULL,NULL,'2026-10-18 02:19:40','sent',0,0,0,0);
+INSERT INTO messages VALUES(2,1,2,'hi',NULL,NULL,'2026-10-18 02:19:40','sent',0,0,0,0);
+INSERT INTO messages VALUES(3,1,1,NULL,X'89504e470d0a1a0a0000000d49484452000000040000000308020000003b9639910000001049444154789c63f8cfc000470c383900f5310bf5357bfb820000000049454e44ae426082','image/png','2026-10-18 02:19:40','sent',0,0,0,0);
+INSERT INTO messages VALUES(4,1,2,'reply',NULL,NULL,'2026-10-18 02:19:40','sent',1,1,0,0);
+CREATE TABLE message_status (
+			message_id INTEGER NOT NULL,
+			user_id INTEGER NOT NULL,
+			is_read BOOLEAN DEFAULT FALSE,
+			FOREIGN KEY (message_id) REFERENCES messages(id),
+			FOREIGN KEY (user_id) REFERENCES users(id),
+			PRIMARY KEY (message_id, user_id)
+		);
+INSERT INTO message_status VALUES(1,1,1);
+INSERT INTO message_status VALUES(1,2,0);
+INSERT INTO message_status VALUES(2,1,0);
+INSERT INTO message_status VALUES(2,2,1);
+INSERT INTO message_status VALUES(3,1,1);
+INSERT INTO message_status VALUES(3,2,0);
+INSERT INTO message_status VALUES(4,1,0);
+INSERT INTO message_status VALUES(4,2,1);
+CREATE TABLE reactions (
+			message_id INTEGER NOT NULL,
+			user_id INTEGER NOT NULL,
+			emoticon TEXT NOT NULL,
+			FOREIGN KEY (message_id) REFERENCES messages(id),
+			FOREIGN KEY (user_id) REFERENCES users(id),
+			PRIMARY KEY (message_id, user_id)
+		);
+INSERT INTO sqlite_sequence VALUES('users',2);
+INSERT INTO sqlite_sequence VALUES('conversations',2);
+INSERT INTO sqlite_sequence VALUES('messages',4);
+CREATE INDEX idx_messages_timestamp ON messages (conversation_id, timestamp DESC);
+COMMIT;
@@ -0,0 +1,53 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// Thread is a message and the replies of its reply chains, in chronological order
+type Thread struct {
+	Root    Message   `json:"root"`
+	Replies []Message `json:"replies"`
+}
+
+//Get the root of the thread a message belongs to, which is the message itself if it is not a reply
+func (db *appdbimpl) GetThreadRootID(ctx context.Context, messageID int64) (int64, error) {
+	ctx, cancel := db.timeout(ctx)
+	defer cancel()
+
+	var rootID int64
+	err := db.c.QueryRowContext(ctx, `
+		SELECT COALESCE(thread_root_id, id) FROM messages WHERE id = ?
+	`, messageID).Scan(&rootID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrMessageNotFound
+	} else if err != nil {
+		return 0, fmt.Errorf("failed to retrieve thread root: %w", err)
+	}
+	return rootID, nil
+}
+
+//Get the thread of a conversation started by rootID, leaving out the replies viewerID hid
+func (db *appdbimpl) GetThread(ctx context.Context, conversationID, viewerID, rootID int64) (*Thread, error) {
+	ctx, cancel := db.timeout(ctx)
+	defer cancel()
+
+	//The root is shown even if the user hid it, as the replies make no sense without it
+	messages, err := db.queryMessages(ctx, conversationID, viewerID, `
+		SELECT id FROM messages
+		WHERE conversation_id = ? AND (id = ? OR (thread_root_id = ? AND NOT EXISTS (
+			SELECT 1 FROM hidden_messages h WHERE h.message_id = messages.id AND h.user_id = ?
+		)))`, "ASC", conversationID, rootID, rootID, viewerID)
+	if err != nil {
+		return nil, err
+	}
+
+	//Replies are always newer than their root, which comes first
+	if len(messages) == 0 || messages[0].ID != rootID {
+		return nil, ErrMessageNotFound
+	}
+	return &Thread{Root: messages[0], Replies: messages[1:]}, nil
+}
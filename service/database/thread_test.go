@@ -0,0 +1,83 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+)
+
+func TestThreads(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, driver string, sqldb *sql.DB) {
+		f := newFixture(t, driver, sqldb)
+		ctx := context.Background()
+
+		root := f.send(t, f.alice, "root", 0)
+		reply := f.send(t, f.bob, "reply", root)
+		deep := f.send(t, f.alice, "reply to the reply", reply)
+		other := f.send(t, f.bob, "another message", 0)
+
+		rootID, err := f.db.GetThreadRootID(ctx, deep)
+		if err != nil || rootID != root {
+			t.Errorf("thread root of %d is %d (%v), want %d", deep, rootID, err, root)
+		}
+		thread, err := f.db.GetThread(ctx, f.conversationID, f.bob, root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if thread.Root.ID != root || thread.Root.ReplyCount != 2 || len(thread.Replies) != 2 ||
+			thread.Replies[0].ID != reply || thread.Replies[1].ID != deep {
+			t.Errorf("unexpected thread %+v", thread)
+		}
+
+		rootID, err = f.db.GetThreadRootID(ctx, other)
+		if err != nil || rootID != other {
+			t.Errorf("thread root of %d is %d (%v), want itself", other, rootID, err)
+		}
+	})
+}
+
+// The message_threads migration finds the thread of the replies sent before it
+func TestThreadBackfill(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, driver string, sqldb *sql.DB) {
+		f := newFixture(t, driver, sqldb)
+		ctx := context.Background()
+
+		root := f.send(t, f.alice, "root", 0)
+		reply := f.send(t, f.bob, "reply", root)
+		deep := f.send(t, f.alice, "reply to the reply", reply)
+		other := f.send(t, f.bob, "another message", 0)
+		forwarded, err := f.db.ForwardMessage(ctx, f.conversationID, f.alice, reply)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		reverted, err := Rollback(sqldb, driver, 1)
+		if err != nil || len(reverted) != 1 || reverted[0].Name != "message_threads" {
+			t.Fatalf("rollback reverted %v (%v), want message_threads", reverted, err)
+		}
+		if _, err := Migrate(sqldb, driver); err != nil {
+			t.Fatal(err)
+		}
+
+		c, err := newConn(sqldb, driver)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := map[int64]sql.NullInt64{
+			root:      {},
+			reply:     {Int64: root, Valid: true},
+			deep:      {Int64: root, Valid: true},
+			other:     {},
+			forwarded: {},
+		}
+		for id, wantRoot := range want {
+			var got sql.NullInt64
+			if err := c.QueryRowContext(ctx, `SELECT thread_root_id FROM messages WHERE id = ?`, id).Scan(&got); err != nil {
+				t.Fatal(err)
+			}
+			if got != wantRoot {
+				t.Errorf("message %d has thread root %v, want %v", id, got, wantRoot)
+			}
+		}
+	})
+}
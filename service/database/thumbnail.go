@@ -0,0 +1,47 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// ErrThumbnailNotFound is returned when no thumbnail of the requested size was generated for a blob
+var ErrThumbnailNotFound = errors.New("thumbnail not found")
+
+//Stores the keys of the thumbnails generated for a blob, by size
+func (db *appdbimpl) SaveThumbnails(ctx context.Context, blobKey string, thumbnails map[int]string) error {
+	ctx, cancel := db.timeout(ctx)
+	defer cancel()
+
+	return withTx(ctx, db.c, func(tx *txConn) error {
+		for size, thumbnailKey := range thumbnails {
+			_, err := tx.ExecContext(ctx, `
+				INSERT INTO thumbnails (blob_key, size, thumbnail_key) VALUES (?, ?, ?)
+				ON CONFLICT (blob_key, size) DO UPDATE SET thumbnail_key = excluded.thumbnail_key
+			`, blobKey, size, thumbnailKey)
+			if err != nil {
+				return fmt.Errorf("failed to save thumbnail: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+//Get the key of the thumbnail of a blob with the given size
+func (db *appdbimpl) GetThumbnail(ctx context.Context, blobKey string, size int) (string, error) {
+	ctx, cancel := db.timeout(ctx)
+	defer cancel()
+
+	var thumbnailKey string
+	err := db.c.QueryRowContext(ctx, `
+		SELECT thumbnail_key FROM thumbnails WHERE blob_key = ? AND size = ?
+	`, blobKey, size).Scan(&thumbnailKey)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrThumbnailNotFound
+	} else if err != nil {
+		return "", fmt.Errorf("error retrieving thumbnail: %w", err)
+	}
+	return thumbnailKey, nil
+}
@@ -0,0 +1,30 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// withTx runs fn in a transaction, which is committed if fn succeeds and rolled back if it fails or panics. Every
+// operation made of more than one statement must use it, so that a failure halfway never leaves partial writes behind.
+func withTx(ctx context.Context, c *conn, fn func(tx *txConn) error) (err error) {
+	tx, err := c.BeginTx(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			_ = tx.tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	if err = fn(tx); err != nil {
+		_ = tx.tx.Rollback()
+		return err
+	}
+	if err = tx.tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,234 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// failOn makes every following `event` (INSERT, UPDATE or DELETE) on table fail, to check that the operation it is a
+// step of leaves nothing behind
+func failOn(t *testing.T, driver string, db *sql.DB, event, table string) {
+	t.Helper()
+
+	script := `CREATE TRIGGER inject_failure BEFORE ` + event + ` ON ` + table + `
+		BEGIN SELECT RAISE(ABORT, 'injected failure'); END`
+	if driver == DriverPostgres {
+		script = `
+			CREATE FUNCTION inject_failure() RETURNS trigger AS $$
+			BEGIN RAISE EXCEPTION 'injected failure'; END
+			$$ LANGUAGE plpgsql;
+			CREATE TRIGGER inject_failure BEFORE ` + event + ` ON ` + table + `
+				FOR EACH ROW EXECUTE FUNCTION inject_failure();`
+	}
+	if _, err := db.Exec(script); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// count returns the result of a SELECT COUNT(*) query
+func count(t *testing.T, driver string, db *sql.DB, query string, args ...interface{}) int {
+	t.Helper()
+	c, err := newConn(db, driver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	if err := c.QueryRowContext(context.Background(), query, args...).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func checkInjectedFailure(t *testing.T, err error) {
+	t.Helper()
+	if err == nil || !strings.Contains(err.Error(), "injected failure") {
+		t.Fatalf("got error %v, want the injected failure", err)
+	}
+}
+
+func TestSendMessageAtomic(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, driver string, sqldb *sql.DB) {
+		f := newFixture(t, driver, sqldb)
+		first := f.send(t, f.alice, "hello", 0)
+
+		//Making the message the last of the conversation is the last step
+		failOn(t, driver, sqldb, "UPDATE", "conversations")
+		content := "lost"
+		_, err := f.db.SendMessage(context.Background(), f.conversationID, f.bob, &content, nil, nil, first)
+		checkInjectedFailure(t, err)
+
+		if n := count(t, driver, sqldb, `SELECT COUNT(*) FROM messages`); n != 1 {
+			t.Errorf("%d messages left, want 1", n)
+		}
+		if n := count(t, driver, sqldb, `SELECT COUNT(*) FROM message_status WHERE message_id <> ?`, first); n != 0 {
+			t.Errorf("%d statuses of the failed message left", n)
+		}
+	})
+}
+
+func TestCreateGroupConversationAtomic(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, driver string, sqldb *sql.DB) {
+		f := newFixture(t, driver, sqldb)
+
+		failOn(t, driver, sqldb, "INSERT", "conversation_participants")
+		_, err := f.db.CreateGroupConversation(context.Background(), f.alice, "friends", "", []int64{f.bob})
+		checkInjectedFailure(t, err)
+
+		if n := count(t, driver, sqldb, `SELECT COUNT(*) FROM conversations WHERE conversation_type = 'group'`); n != 0 {
+			t.Errorf("%d groups left, want 0", n)
+		}
+	})
+}
+
+func TestCreatePrivateConversationAtomic(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, driver string, sqldb *sql.DB) {
+		f := newFixture(t, driver, sqldb)
+		ctx := context.Background()
+
+		carol, err := f.db.CreateUser(ctx, "carol")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		failOn(t, driver, sqldb, "INSERT", "conversation_participants")
+		_, err = f.db.CreatePrivateConversation(ctx, f.alice, carol)
+		checkInjectedFailure(t, err)
+
+		if n := count(t, driver, sqldb, `SELECT COUNT(*) FROM conversations`); n != 1 {
+			t.Errorf("%d conversations left, want 1", n)
+		}
+	})
+}
+
+func TestForwardMessageAtomic(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, driver string, sqldb *sql.DB) {
+		f := newFixture(t, driver, sqldb)
+		ctx := context.Background()
+		first := f.send(t, f.alice, "hello", 0)
+
+		groupID, err := f.db.CreateGroupConversation(ctx, f.bob, "friends", "", []int64{f.alice})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		//Making the message the last of the conversation is the last step
+		failOn(t, driver, sqldb, "UPDATE", "conversations")
+		_, err = f.db.ForwardMessage(ctx, groupID, f.bob, first)
+		checkInjectedFailure(t, err)
+
+		if n := count(t, driver, sqldb, `SELECT COUNT(*) FROM messages`); n != 1 {
+			t.Errorf("%d messages left, want 1", n)
+		}
+		if n := count(t, driver, sqldb, `SELECT COUNT(*) FROM message_status WHERE message_id <> ?`, first); n != 0 {
+			t.Errorf("%d statuses of the failed message left", n)
+		}
+	})
+}
+
+func TestLeaveGroupAtomic(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, driver string, sqldb *sql.DB) {
+		f := newFixture(t, driver, sqldb)
+		ctx := context.Background()
+
+		groupID, err := f.db.CreateGroupConversation(ctx, f.alice, "friends", "", []int64{f.bob})
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.conversationID = groupID
+		f.send(t, f.alice, "hello", 0)
+
+		//The group is deleted when bob leaves alice alone in it, deleting the conversation itself is the last step
+		failOn(t, driver, sqldb, "DELETE", "conversations")
+		checkInjectedFailure(t, f.db.LeaveGroup(ctx, groupID, f.bob))
+
+		if n := count(t, driver, sqldb, `SELECT COUNT(*) FROM conversation_participants WHERE conversation_id = ?`, groupID); n != 2 {
+			t.Errorf("%d participants left, want 2", n)
+		}
+		if n := count(t, driver, sqldb, `SELECT COUNT(*) FROM messages WHERE conversation_id = ?`, groupID); n != 1 {
+			t.Errorf("%d messages left, want 1", n)
+		}
+		if n := count(t, driver, sqldb, `SELECT COUNT(*) FROM conversations WHERE id = ? AND last_message_id IS NOT NULL`, groupID); n != 1 {
+			t.Errorf("the group lost its last message")
+		}
+	})
+}
+
+func TestDeleteMessageAtomic(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, driver string, sqldb *sql.DB) {
+		f := newFixture(t, driver, sqldb)
+		id := f.send(t, f.alice, "hello", 0)
+
+		failOn(t, driver, sqldb, "DELETE", "message_status")
+		checkInjectedFailure(t, f.db.DeleteMessage(context.Background(), f.conversationID, id, f.alice, time.Time{}))
+
+		if n := count(t, driver, sqldb, `SELECT COUNT(*) FROM messages WHERE id = ? AND NOT is_deleted`, id); n != 1 {
+			t.Errorf("the message was deleted")
+		}
+	})
+}
+
+func TestEditMessageAtomic(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, driver string, sqldb *sql.DB) {
+		f := newFixture(t, driver, sqldb)
+		id := f.send(t, f.alice, "hello", 0)
+
+		//The previous version is saved before the message is updated
+		failOn(t, driver, sqldb, "UPDATE", "messages")
+		checkInjectedFailure(t, f.db.EditMessage(context.Background(), f.conversationID, id, f.alice, "hi", time.Time{}))
+
+		if n := count(t, driver, sqldb, `SELECT COUNT(*) FROM message_edits`); n != 0 {
+			t.Errorf("%d edits left, want 0", n)
+		}
+	})
+}
+
+func TestWithTxRollback(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, driver string, sqldb *sql.DB) {
+		newTestDatabase(t, driver, sqldb)
+		c, err := newConn(sqldb, driver)
+		if err != nil {
+			t.Fatal(err)
+		}
+		insert := func(ctx context.Context, tx *txConn) error {
+			_, err := tx.ExecContext(ctx, `INSERT INTO users (username) VALUES ('alice')`)
+			return err
+		}
+
+		//The context is cancelled after the first step
+		ctx, cancel := context.WithCancel(context.Background())
+		err = withTx(ctx, c, func(tx *txConn) error {
+			if err := insert(ctx, tx); err != nil {
+				return err
+			}
+			cancel()
+			_, err := tx.ExecContext(ctx, `INSERT INTO users (username) VALUES ('bob')`)
+			return err
+		})
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("got error %v, want context.Canceled", err)
+		}
+
+		//The function panics after the first step
+		func() {
+			defer func() {
+				if p := recover(); p != "injected panic" {
+					t.Errorf("recovered %v, want the injected panic", p)
+				}
+			}()
+			_ = withTx(context.Background(), c, func(tx *txConn) error {
+				if err := insert(context.Background(), tx); err != nil {
+					return err
+				}
+				panic("injected panic")
+			})
+		}()
+
+		if n := count(t, driver, sqldb, `SELECT COUNT(*) FROM users`); n != 0 {
+			t.Errorf("%d users left, want 0", n)
+		}
+	})
+}
@@ -5,9 +5,15 @@ import (
 )
 
 type User struct {
-	ID       int64  `json:"id"`
-	Username string `json:"username"`
-	PhotoURL string `json:"photo_url"`
+	ID              int64             `json:"id"`
+	Username        string            `json:"username"`
+	PhotoURL        string            `json:"photo_url"`
+	PhotoThumbnails map[string]string `json:"photo_thumbnails,omitempty"`
+
+	// LastSeen is when the user was last active, as saved. Presence is filled in by the API, which also knows about
+	// the activity not saved yet.
+	LastSeen *time.Time `json:"last_seen,omitempty"`
+	Presence string     `json:"presence,omitempty"`
 }
 
 type Conversation struct {
@@ -29,9 +35,11 @@ type Message struct {
 	SenderID          int64            `json:"sender_id"`
 	SenderUsername    string           `json:"sender_username"`
 	Content           *string          `json:"content,omitempty"`
-	PhotoData         *[]byte          `json:"photo_data,omitempty"`
+	HasPhoto          bool             `json:"has_photo"`
+	PhotoURL          string           `json:"photo_url,omitempty"`
 	PhotoMimeType     *string          `json:"photo_mime_type,omitempty"`
 	Timestamp         time.Time        `json:"timestamp"`
+	EditedAt          *time.Time       `json:"edited_at,omitempty"`
 	Status            string           `json:"status"`
 	IsReply           bool             `json:"is_reply"`
 	OriginalMessageID int64            `json:"original_message_id"`
@@ -39,12 +47,26 @@ type Message struct {
 	IsDeleted         bool             `json:"is_deleted"`
 	Reactions         []Reaction       `json:"reactions"`
 	OriginalMessage   *OriginalMessage `json:"original_message,omitempty"`
+
+	// ThreadRootID is the first message of the reply chain of a reply, zero for messages which are not replies
+	ThreadRootID int64 `json:"thread_root_id,omitempty"`
+
+	// ReplyCount and LastReplyAt tell about the replies in the thread of a message, if it is the root of one
+	ReplyCount  int        `json:"reply_count"`
+	LastReplyAt *time.Time `json:"last_reply_at,omitempty"`
+}
+
+type MessagePhoto struct {
+	Key       string
+	MimeType  string
+	Timestamp time.Time
 }
 
 type OriginalMessage struct {
-	ID      int64  `json:"id"`
-	Content string `json:"content"`
-	Sender  string `json:"sender"`
+	ID       int64      `json:"id"`
+	Content  string     `json:"content"`
+	Sender   string     `json:"sender"`
+	EditedAt *time.Time `json:"edited_at,omitempty"`
 }
 
 type MessageStatus struct {
@@ -53,8 +75,28 @@ type MessageStatus struct {
 	IsRead    bool  `json:"is_read"`
 }
 
+// Receipt tells whether a recipient received and read a message. The times are missing for the messages read before
+// they were recorded.
+type Receipt struct {
+	UserID      int64      `json:"user_id"`
+	Username    string     `json:"username"`
+	Status      string     `json:"status"`
+	DeliveredAt *time.Time `json:"delivered_at,omitempty"`
+	ReadAt      *time.Time `json:"read_at,omitempty"`
+}
+
 type Reaction struct {
 	MessageID int64  `json:"message_id"`
 	UserID    int64  `json:"user_id"`
 	Emoticon  string `json:"emoticon"`
 }
+
+type Session struct {
+	ID         int64     `json:"id"`
+	UserID     int64     `json:"-"`
+	UserAgent  string    `json:"user_agent"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"`
+}
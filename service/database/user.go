@@ -1,15 +1,20 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
+	"time"
 )
 
 //Get a user's identifer with their username
-func (db *appdbimpl) GetUserByUsername(username string) (int64, error) {
+func (db *appdbimpl) GetUserByUsername(ctx context.Context, username string) (int64, error) {
+	ctx, cancel := db.timeout(ctx)
+	defer cancel()
+
 	var identifier int64
-	err := db.c.QueryRow("SELECT id FROM users WHERE username = ?", username).Scan(&identifier)
+	err := db.c.QueryRowContext(ctx, "SELECT id FROM users WHERE username = ?", username).Scan(&identifier)
 	if errors.Is(err, sql.ErrNoRows) {
 		return 0, nil
 	}
@@ -17,12 +22,12 @@ func (db *appdbimpl) GetUserByUsername(username string) (int64, error) {
 }
 
 //Create a user with their username and return the identifier
-func (db *appdbimpl) CreateUser(username string) (int64, error) {
-	result, err := db.c.Exec("INSERT INTO users (username) VALUES (?)", username)
-	if err != nil {
-		return 0, err
-	}
-	identifier, err := result.LastInsertId()
+func (db *appdbimpl) CreateUser(ctx context.Context, username string) (int64, error) {
+	ctx, cancel := db.timeout(ctx)
+	defer cancel()
+
+	var identifier int64
+	err := db.c.QueryRowContext(ctx, "INSERT INTO users (username) VALUES (?) RETURNING id", username).Scan(&identifier)
 	if err != nil {
 		return 0, err
 	}
@@ -30,28 +35,39 @@ func (db *appdbimpl) CreateUser(username string) (int64, error) {
 }
 
 //Check if the username is already taken
-func (db *appdbimpl) DoesUsernameExist(username string) (bool, error) {
+func (db *appdbimpl) DoesUsernameExist(ctx context.Context, username string) (bool, error) {
+	ctx, cancel := db.timeout(ctx)
+	defer cancel()
+
 	var exists bool
-	err := db.c.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE username = ?)", username).Scan(&exists)
+	err := db.c.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM users WHERE username = ?)", username).Scan(&exists)
 	return exists, err
 }
 
 //Get a full user object using their id
-func (db *appdbimpl) GetUser(userId int64) (*User, error) {
+func (db *appdbimpl) GetUser(ctx context.Context, userId int64) (*User, error) {
+	ctx, cancel := db.timeout(ctx)
+	defer cancel()
+
 	var user User
-	query := `SELECT id, username, photo_url FROM users WHERE id = ?`
-	err := db.c.QueryRow(query, userId).Scan(&user.ID, &user.Username, &user.PhotoURL)
+	var lastSeen sql.NullInt64
+	query := `SELECT id, username, photo_url, last_seen_at FROM users WHERE id = ?`
+	err := db.c.QueryRowContext(ctx, query, userId).Scan(&user.ID, &user.Username, &user.PhotoURL, &lastSeen)
 	if errors.Is(err, sql.ErrNoRows) {
 		return nil, nil
 	} else if err != nil {
 		return nil, fmt.Errorf("error retrieving user: %w", err)
 	}
+	user.LastSeen = unixTime(lastSeen)
 	return &user, nil
 }
 
 //Updates a user's username
-func (db *appdbimpl) SetMyUserName(userID int64, username string) error {
-	_, err := db.c.Exec(`UPDATE users SET username = ? WHERE id = ?`, username, userID)
+func (db *appdbimpl) SetMyUserName(ctx context.Context, userID int64, username string) error {
+	ctx, cancel := db.timeout(ctx)
+	defer cancel()
+
+	_, err := db.c.ExecContext(ctx, `UPDATE users SET username = ? WHERE id = ?`, username, userID)
 	if err != nil {
 		return fmt.Errorf("error updating username: %w", err)
 	}
@@ -59,10 +75,56 @@ func (db *appdbimpl) SetMyUserName(userID int64, username string) error {
 }
 
 //Updates a user's profile picture
-func (db *appdbimpl) SetMyPhoto(userID int64, photoURL string) error {
-	_, err := db.c.Exec(`UPDATE users SET photo_url = ? WHERE id = ?`, photoURL, userID)
+func (db *appdbimpl) SetMyPhoto(ctx context.Context, userID int64, photoURL string) error {
+	ctx, cancel := db.timeout(ctx)
+	defer cancel()
+
+	_, err := db.c.ExecContext(ctx, `UPDATE users SET photo_url = ? WHERE id = ?`, photoURL, userID)
 	if err != nil {
 		return fmt.Errorf("error updating profile photo: %w", err)
 	}
 	return nil
 }
+
+//Checks if a photo URL is the profile picture of a user or the photo of a group, which anyone may see
+func (db *appdbimpl) IsPublicPhoto(ctx context.Context, photoURL string) (bool, error) {
+	ctx, cancel := db.timeout(ctx)
+	defer cancel()
+
+	var public bool
+	err := db.c.QueryRowContext(ctx, `
+		SELECT EXISTS (SELECT 1 FROM users WHERE photo_url = ?)
+			OR EXISTS (SELECT 1 FROM conversations WHERE conversation_type = 'group' AND photo_url = ?)
+	`, photoURL, photoURL).Scan(&public)
+	if err != nil {
+		return false, fmt.Errorf("error checking photo: %w", err)
+	}
+	return public, nil
+}
+
+//Save when users were last active, keeping later times already saved
+func (db *appdbimpl) SetLastSeen(ctx context.Context, lastSeen map[int64]time.Time) error {
+	ctx, cancel := db.timeout(ctx)
+	defer cancel()
+
+	return withTx(ctx, db.c, func(tx *txConn) error {
+		for userID, seen := range lastSeen {
+			_, err := tx.ExecContext(ctx, `
+				UPDATE users SET last_seen_at = ? WHERE id = ? AND (last_seen_at IS NULL OR last_seen_at < ?)
+			`, seen.Unix(), userID, seen.Unix())
+			if err != nil {
+				return fmt.Errorf("failed to save last seen time: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// unixTime converts a nullable Unix time, as saved in the database, to a time
+func unixTime(v sql.NullInt64) *time.Time {
+	if !v.Valid {
+		return nil
+	}
+	t := time.Unix(v.Int64, 0).UTC()
+	return &t
+}
@@ -1,14 +1,19 @@
 package database
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
 )
 
 //Get a list of all users
-func (db *appdbimpl) GetUsers() ([]User, error) {
-	query := "SELECT id, username, photo_url FROM users ORDER BY username ASC"
+func (db *appdbimpl) GetUsers(ctx context.Context) ([]User, error) {
+	ctx, cancel := db.timeout(ctx)
+	defer cancel()
 
-	rows, err := db.c.Query(query)
+	query := "SELECT id, username, photo_url, last_seen_at FROM users ORDER BY username ASC"
+
+	rows, err := db.c.QueryContext(ctx, query)
 	if err != nil {
 		return nil, fmt.Errorf("error retrieving users: %w", err)
 	}
@@ -18,9 +23,11 @@ func (db *appdbimpl) GetUsers() ([]User, error) {
 
 	for rows.Next() {
 		var user User
-		if err := rows.Scan(&user.ID, &user.Username, &user.PhotoURL); err != nil {
+		var lastSeen sql.NullInt64
+		if err := rows.Scan(&user.ID, &user.Username, &user.PhotoURL, &lastSeen); err != nil {
 			return nil, fmt.Errorf("error scanning user: %w", err)
 		}
+		user.LastSeen = unixTime(lastSeen)
 		users = append(users, user)
 
 		if err := rows.Err(); err != nil {
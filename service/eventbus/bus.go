@@ -0,0 +1,131 @@
+/*
+Package eventbus passes the domain events of the application, such as a message being sent, from the code which causes
+them to the parts which react to them, e.g. real-time delivery, notifications or search indexing, without either
+knowing about the other.
+
+Events are delivered asynchronously, after Publish returns. Each subscriber receives the events in the order they were
+published, one at a time, from its own goroutine: a slow subscriber delays only itself, until its queue is full, when
+Publish waits for it. Subscribers which may take long (e.g. calling a webhook) should hand the work off.
+
+Example:
+
+	bus := eventbus.New(logger)
+	defer bus.Close()
+
+	bus.Subscribe("search", func(ctx context.Context, event eventbus.Event) {
+		if sent, ok := event.(eventbus.MessageSent); ok {
+			...
+		}
+	})
+
+	// Somewhere else
+	bus.Publish(eventbus.MessageSent{ConversationID: 1, MessageID: 7, SenderID: 2})
+*/
+package eventbus
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// subscriberQueue is how many events a subscriber can be behind before Publish waits for it
+const subscriberQueue = 256
+
+// Handler reacts to an event. It is called with a context which is not tied to the request which caused the event. It
+// must not publish events itself, as the bus could be waiting for it to make room for them.
+type Handler func(ctx context.Context, event Event)
+
+// Bus delivers published events to its subscribers. It is safe for concurrent use.
+type Bus struct {
+	logger logrus.FieldLogger
+
+	// mu protects subscribers and closed, and is held for reading while publishing, so that Close waits for the
+	// events being queued
+	mu          sync.RWMutex
+	subscribers []*subscriber
+	closed      bool
+
+	wg sync.WaitGroup
+}
+
+type subscriber struct {
+	name    string
+	handler Handler
+	queue   chan Event
+}
+
+// New returns a Bus without subscribers. Panics of the subscribers are logged to logger.
+func New(logger logrus.FieldLogger) *Bus {
+	return &Bus{logger: logger}
+}
+
+// Subscribe makes handler receive the events published from now on. The name identifies the subscriber in the logs.
+// Subscribing to a closed Bus does nothing.
+func (b *Bus) Subscribe(name string, handler Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+
+	sub := &subscriber{
+		name:    name,
+		handler: handler,
+		queue:   make(chan Event, subscriberQueue),
+	}
+	b.subscribers = append(b.subscribers, sub)
+
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		for event := range sub.queue {
+			b.deliver(sub, event)
+		}
+	}()
+}
+
+// Publish queues an event for every subscriber. Events published after Close are dropped.
+func (b *Bus) Publish(event Event) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.closed {
+		b.logger.WithField("event", fmt.Sprintf("%T", event)).Warn("event published after the bus was closed")
+		return
+	}
+
+	for _, sub := range b.subscribers {
+		sub.queue <- event
+	}
+}
+
+// Close stops accepting events, and waits for the subscribers to handle the ones already published
+func (b *Bus) Close() {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return
+	}
+	b.closed = true
+	for _, sub := range b.subscribers {
+		close(sub.queue)
+	}
+	b.mu.Unlock()
+
+	b.wg.Wait()
+}
+
+// deliver passes an event to a subscriber, which must not bring the others down if it panics
+func (b *Bus) deliver(sub *subscriber, event Event) {
+	defer func() {
+		if r := recover(); r != nil {
+			b.logger.WithFields(logrus.Fields{
+				"subscriber": sub.name,
+				"event":      fmt.Sprintf("%T", event),
+			}).Errorf("subscriber panicked: %v", r)
+		}
+	}()
+	sub.handler(context.Background(), event)
+}
@@ -0,0 +1,139 @@
+package eventbus
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// newLogger returns a logger writing to a buffer, which can be read once the bus is closed
+func newLogger() (*logrus.Logger, *bytes.Buffer) {
+	var buf bytes.Buffer
+	logger := logrus.New()
+	logger.SetOutput(&buf)
+	return logger, &buf
+}
+
+// recorder is a subscriber which keeps the IDs of the messages sent it received
+type recorder struct {
+	ids []int64
+}
+
+func (r *recorder) handle(ctx context.Context, event Event) {
+	r.ids = append(r.ids, event.(MessageSent).MessageID)
+}
+
+func TestOrder(t *testing.T) {
+	logger, _ := newLogger()
+	bus := New(logger)
+
+	//More events than fit in a queue, so that Publish waits for the slow subscriber
+	var fast, slow recorder
+	bus.Subscribe("fast", fast.handle)
+	bus.Subscribe("slow", func(ctx context.Context, event Event) {
+		if event.(MessageSent).MessageID%100 == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		slow.handle(ctx, event)
+	})
+
+	const n = 3 * subscriberQueue
+	for i := int64(0); i < n; i++ {
+		bus.Publish(MessageSent{ConversationID: 1, MessageID: i})
+	}
+	bus.Close()
+
+	for name, r := range map[string]*recorder{"fast": &fast, "slow": &slow} {
+		if len(r.ids) != n {
+			t.Errorf("%s subscriber received %d events, want %d", name, len(r.ids), n)
+			continue
+		}
+		for i, id := range r.ids {
+			if id != int64(i) {
+				t.Errorf("%s subscriber received message %d as event %d", name, id, i)
+				break
+			}
+		}
+	}
+}
+
+func TestClose(t *testing.T) {
+	logger, logs := newLogger()
+	bus := New(logger)
+
+	release := make(chan struct{})
+	var r recorder
+	bus.Subscribe("blocked", func(ctx context.Context, event Event) {
+		<-release
+		r.handle(ctx, event)
+	})
+	for i := int64(1); i <= 3; i++ {
+		bus.Publish(MessageSent{ConversationID: 1, MessageID: i})
+	}
+
+	//Close waits for the events already published
+	closed := make(chan struct{})
+	go func() {
+		bus.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+		t.Fatal("Close returned before the events were handled")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	<-closed
+	if len(r.ids) != 3 {
+		t.Errorf("%d events handled before Close returned, want 3", len(r.ids))
+	}
+
+	//Later events are dropped, and later subscribers never run
+	bus.Publish(MessageSent{ConversationID: 1, MessageID: 4})
+	bus.Subscribe("late", func(ctx context.Context, event Event) {
+		t.Error("subscriber of a closed bus received an event")
+	})
+	bus.Publish(MessageSent{ConversationID: 1, MessageID: 5})
+	bus.Close()
+
+	if len(r.ids) != 3 {
+		t.Errorf("%d events handled after Close, want 3", len(r.ids))
+	}
+	if !strings.Contains(logs.String(), "event published after the bus was closed") {
+		t.Errorf("dropped events were not logged: %s", logs)
+	}
+}
+
+func TestPanickingSubscriber(t *testing.T) {
+	logger, logs := newLogger()
+	bus := New(logger)
+
+	var panicking, other recorder
+	bus.Subscribe("panicking", func(ctx context.Context, event Event) {
+		if event.(MessageSent).MessageID == 1 {
+			panic("injected panic")
+		}
+		panicking.handle(ctx, event)
+	})
+	bus.Subscribe("other", other.handle)
+
+	bus.Publish(MessageSent{ConversationID: 1, MessageID: 1})
+	bus.Publish(MessageSent{ConversationID: 1, MessageID: 2})
+	bus.Close()
+
+	//The subscriber which panicked keeps receiving events, and the others are not affected
+	if len(panicking.ids) != 1 || panicking.ids[0] != 2 {
+		t.Errorf("panicking subscriber received %v after the panic, want [2]", panicking.ids)
+	}
+	if len(other.ids) != 2 {
+		t.Errorf("other subscriber received %v, want [1 2]", other.ids)
+	}
+	log := logs.String()
+	if !strings.Contains(log, "subscriber panicked: injected panic") || !strings.Contains(log, "subscriber=panicking") {
+		t.Errorf("panic was not logged: %s", log)
+	}
+}
@@ -0,0 +1,106 @@
+package eventbus
+
+// Event is a change which was saved, and which other parts of the application may react to. Every event happens in a
+// conversation.
+type Event interface {
+	Conversation() int64
+}
+
+// MessageSent is published when a message is sent, or forwarded, to a conversation
+type MessageSent struct {
+	ConversationID int64
+	MessageID      int64
+	SenderID       int64
+
+	// OriginalMessageID is the message replied to or forwarded, zero when there is none
+	OriginalMessageID int64
+	Forwarded         bool
+
+	// ThreadRootID is the thread a reply joined, zero when the message is not a reply
+	ThreadRootID int64
+}
+
+// MessageDeleted is published when a message is deleted by its sender
+type MessageDeleted struct {
+	ConversationID int64
+	MessageID      int64
+	UserID         int64
+
+	// ThreadRootID is the thread of the message, zero when it is not a reply
+	ThreadRootID int64
+}
+
+// MessageHidden is published when a user deletes a message for themselves only
+type MessageHidden struct {
+	ConversationID int64
+	MessageID      int64
+	UserID         int64
+}
+
+// MessageEdited is published when the sender of a message changes its text
+type MessageEdited struct {
+	ConversationID int64
+	MessageID      int64
+	UserID         int64
+}
+
+// ReactionSet is published when a user reacts to a message, or changes their reaction
+type ReactionSet struct {
+	ConversationID int64
+	MessageID      int64
+	UserID         int64
+	Emoticon       string
+}
+
+// ReactionRemoved is published when a user removes their reaction to a message
+type ReactionRemoved struct {
+	ConversationID int64
+	MessageID      int64
+	UserID         int64
+}
+
+// MessagesRead is published when a user reads the messages of a conversation
+type MessagesRead struct {
+	ConversationID int64
+	UserID         int64
+
+	// UpTo is the last message read, zero when the user read all of them
+	UpTo int64
+}
+
+// MessagesDelivered is published when a user receives messages of a conversation
+type MessagesDelivered struct {
+	ConversationID int64
+	UserID         int64
+	MessageIDs     []int64
+}
+
+// MembersAdded is published when users are added to a group
+type MembersAdded struct {
+	ConversationID int64
+	UserIDs        []int64
+}
+
+// MemberLeft is published when a user leaves a group. The group no longer exists if they were its last member.
+type MemberLeft struct {
+	ConversationID int64
+	UserID         int64
+}
+
+// GroupRenamed is published when the name of a group changes
+type GroupRenamed struct {
+	ConversationID int64
+	Name           string
+}
+
+func (e MessageSent) Conversation() int64       { return e.ConversationID }
+func (e MessageDeleted) Conversation() int64    { return e.ConversationID }
+func (e MessageHidden) Conversation() int64     { return e.ConversationID }
+func (e MessageEdited) Conversation() int64     { return e.ConversationID }
+func (e ReactionSet) Conversation() int64       { return e.ConversationID }
+func (e ReactionRemoved) Conversation() int64   { return e.ConversationID }
+func (e MessagesRead) Conversation() int64      { return e.ConversationID }
+func (e MessagesDelivered) Conversation() int64 { return e.ConversationID }
+func (e MembersAdded) Conversation() int64      { return e.ConversationID }
+func (e MemberLeft) Conversation() int64        { return e.ConversationID }
+func (e GroupRenamed) Conversation() int64      { return e.ConversationID }
@@ -0,0 +1,138 @@
+/*
+Package imaging validates and normalizes the images uploaded by users. Uploads are never trusted: the format is detected
+from the content (not from the file name), the image is fully decoded with the standard library decoders and then
+re-encoded, so that anything but the pixels (EXIF data, GPS coordinates, comments, trailing garbage) is dropped.
+
+Only JPEG and PNG images are supported.
+*/
+package imaging
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+)
+
+var (
+	// ErrUnsupportedFormat is returned when the content is not a JPEG or PNG image
+	ErrUnsupportedFormat = errors.New("unsupported image format")
+
+	// ErrTooLarge is returned when the image dimensions exceed MaxDimension or MaxPixels
+	ErrTooLarge = errors.New("image dimensions too large")
+
+	// ErrFileTooLarge is returned when the image file is larger than MaxFileSize
+	ErrFileTooLarge = errors.New("image file too large")
+)
+
+const (
+	// MaxDimension is the largest accepted width or height, in pixels
+	MaxDimension = 8192
+
+	// MaxPixels is the largest accepted amount of pixels, which bounds the memory needed to decode an image
+	MaxPixels = 40_000_000
+
+	// MaxFileSize is the largest accepted image file, in bytes, which bounds the memory needed to read it
+	MaxFileSize = 20 << 20
+
+	// jpegQuality is the quality used when re-encoding JPEG images
+	jpegQuality = 90
+)
+
+// Image is a sanitized image, ready to be stored
+type Image struct {
+	// Data is the re-encoded image
+	Data []byte
+
+	// MimeType is either image/jpeg or image/png
+	MimeType string
+
+	// Width and Height are the image dimensions, after applying the EXIF orientation
+	Width  int
+	Height int
+
+	// Decoded is the decoded image
+	Decoded image.Image
+}
+
+// Sanitize reads an uploaded image and returns it re-encoded in its original format, without any metadata. JPEG images
+// are rotated according to their EXIF orientation first, since that information is lost when re-encoding.
+func Sanitize(r io.Reader) (*Image, error) {
+	br := bufio.NewReader(r)
+
+	// Detect the format from the magic bytes
+	head, err := br.Peek(512)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("reading image: %w", err)
+	}
+	mimeType := http.DetectContentType(head)
+	if mimeType != "image/jpeg" && mimeType != "image/png" {
+		return nil, ErrUnsupportedFormat
+	}
+
+	// Read one byte more than allowed, to tell a file of exactly MaxFileSize bytes from a larger one
+	raw, err := io.ReadAll(io.LimitReader(br, MaxFileSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("reading image: %w", err)
+	}
+	if len(raw) > MaxFileSize {
+		return nil, ErrFileTooLarge
+	}
+
+	// Check the dimensions before decoding, so that a tiny file can't make us allocate gigabytes
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(raw))
+	if err != nil || "image/"+format != mimeType {
+		return nil, ErrUnsupportedFormat
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 {
+		return nil, ErrUnsupportedFormat
+	}
+	if cfg.Width > MaxDimension || cfg.Height > MaxDimension || cfg.Width*cfg.Height > MaxPixels {
+		return nil, ErrTooLarge
+	}
+
+	decoded, _, err := image.Decode(bytes.NewReader(raw))
+	if err != nil {
+		return nil, ErrUnsupportedFormat
+	}
+	if mimeType == "image/jpeg" {
+		decoded = applyOrientation(decoded, jpegOrientation(raw))
+	}
+
+	data, err := Encode(decoded, mimeType)
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := decoded.Bounds()
+	return &Image{
+		Data:     data,
+		MimeType: mimeType,
+		Width:    bounds.Dx(),
+		Height:   bounds.Dy(),
+		Decoded:  decoded,
+	}, nil
+}
+
+// Encode encodes img as image/jpeg or image/png
+func Encode(img image.Image, mimeType string) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+	switch mimeType {
+	case "image/jpeg":
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality})
+	case "image/png":
+		err = png.Encode(&buf, img)
+	default:
+		return nil, ErrUnsupportedFormat
+	}
+	if err != nil {
+		return nil, fmt.Errorf("encoding image: %w", err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,41 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/png"
+	"io"
+	"testing"
+)
+
+func TestSanitizeFileSize(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 4, 4))); err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := Sanitize(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("sanitizing a small image: %v", err)
+	}
+	if img.MimeType != "image/png" || img.Width != 4 || img.Height != 4 {
+		t.Errorf("got a %dx%d %s image", img.Width, img.Height, img.MimeType)
+	}
+
+	//A valid image followed by endless garbage is rejected once MaxFileSize bytes were read
+	r := io.MultiReader(bytes.NewReader(buf.Bytes()), zeros{})
+	if _, err := Sanitize(r); !errors.Is(err, ErrFileTooLarge) {
+		t.Errorf("sanitizing an endless file: got %v, want ErrFileTooLarge", err)
+	}
+}
+
+// zeros is an endless reader of zero bytes
+type zeros struct{}
+
+func (zeros) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
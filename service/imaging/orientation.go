@@ -0,0 +1,135 @@
+package imaging
+
+import (
+	"encoding/binary"
+	"image"
+	"image/draw"
+)
+
+// jpegOrientation returns the EXIF orientation (1 to 8) of a JPEG image, or 1 if it has none
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+
+	// Walk the markers until the APP1 segment carrying the EXIF data
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return 1
+		}
+		marker := data[i+1]
+		if marker == 0xD8 || (marker >= 0xD0 && marker <= 0xD7) || marker == 0x01 || marker == 0xFF {
+			i++
+			continue
+		}
+		if marker == 0xDA || marker == 0xD9 {
+			// Start of scan or end of image: there are no more metadata
+			return 1
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if length < 2 || i+2+length > len(data) {
+			return 1
+		}
+		segment := data[i+4 : i+2+length]
+		if marker == 0xE1 && len(segment) > 6 && string(segment[:6]) == "Exif\x00\x00" {
+			return exifOrientation(segment[6:])
+		}
+		i += 2 + length
+	}
+	return 1
+}
+
+// exifOrientation reads the orientation tag from the first IFD of a TIFF structure
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	offset := int(order.Uint32(tiff[4:]))
+	if offset < 8 || offset+2 > len(tiff) {
+		return 1
+	}
+	entries := int(order.Uint16(tiff[offset:]))
+	for n := 0; n < entries; n++ {
+		entry := offset + 2 + n*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			orientation := int(order.Uint16(tiff[entry+8:]))
+			if orientation < 1 || orientation > 8 {
+				return 1
+			}
+			return orientation
+		}
+	}
+	return 1
+}
+
+// applyOrientation returns img transformed so that it is displayed upright, given its EXIF orientation. The image is
+// converted to RGBA once, and its pixels are then moved as 4-byte groups of the Pix slice: going through the At and Set
+// methods for each of up to MaxPixels pixels would take seconds of CPU for a single upload.
+func applyOrientation(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	src, ok := img.(*image.RGBA)
+	if !ok || b.Min != (image.Point{}) {
+		src = image.NewRGBA(image.Rect(0, 0, w, h))
+		draw.Draw(src, src.Bounds(), img, b.Min, draw.Src)
+	}
+
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+
+	// The source pixel (x, y) goes to the destination pixel (dx, dy), with
+	//   dx = ax*x + bx*y + cx
+	//   dy = ay*x + by*y + cy
+	var ax, bx, cx, ay, by, cy int
+	switch orientation {
+	case 2: // mirrored horizontally: (w-1-x, y)
+		ax, cx, by = -1, w-1, 1
+	case 3: // rotated 180°: (w-1-x, h-1-y)
+		ax, cx, by, cy = -1, w-1, -1, h-1
+	case 4: // mirrored vertically: (x, h-1-y)
+		ax, by, cy = 1, -1, h-1
+	case 5: // mirrored along the top-left diagonal: (y, x)
+		bx, ay = 1, 1
+	case 6: // rotated 90° clockwise: (h-1-y, x)
+		bx, cx, ay = -1, h-1, 1
+	case 7: // mirrored along the top-right diagonal: (h-1-y, w-1-x)
+		bx, cx, ay, cy = -1, h-1, -1, w-1
+	case 8: // rotated 90° counter-clockwise: (y, w-1-x)
+		bx, ay, cy = 1, -1, w-1
+	}
+
+	// Hence the offset in dst.Pix moves by a fixed step for each pixel of a source row, and for each source row
+	xStep := ay*dst.Stride + ax*4
+	yStep := by*dst.Stride + bx*4
+	rowStart := cy*dst.Stride + cx*4
+	for y := 0; y < h; y++ {
+		row := src.Pix[y*src.Stride : y*src.Stride+w*4]
+		d := rowStart
+		for x := 0; x < len(row); x += 4 {
+			copy(dst.Pix[d:d+4], row[x:x+4])
+			d += xStep
+		}
+		rowStart += yStep
+	}
+	return dst
+}
@@ -0,0 +1,79 @@
+package imaging
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// orientedAt returns the pixel of src displayed at (x, y) once the EXIF orientation is applied, as defined by the
+// EXIF specification
+func orientedAt(src image.Image, orientation, x, y int) color.Color {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	var sx, sy int
+	switch orientation {
+	case 1:
+		sx, sy = x, y
+	case 2:
+		sx, sy = w-1-x, y
+	case 3:
+		sx, sy = w-1-x, h-1-y
+	case 4:
+		sx, sy = x, h-1-y
+	case 5:
+		sx, sy = y, x
+	case 6:
+		sx, sy = y, h-1-x
+	case 7:
+		sx, sy = w-1-y, h-1-x
+	case 8:
+		sx, sy = w-1-y, x
+	}
+	return src.At(b.Min.X+sx, b.Min.Y+sy)
+}
+
+// testImage returns a w×h image whose pixels all have a different color, with bounds not starting at the origin
+func testImage(w, h int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(5, 7, 5+w, 7+h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.SetNRGBA(5+x, 7+y, color.NRGBA{R: uint8(x), G: uint8(y), B: uint8(x * y), A: 255})
+		}
+	}
+	return img
+}
+
+func TestApplyOrientation(t *testing.T) {
+	src := testImage(5, 3)
+	for orientation := 1; orientation <= 8; orientation++ {
+		got := applyOrientation(src, orientation)
+
+		w, h := 5, 3
+		if orientation >= 5 {
+			w, h = 3, 5
+		}
+		if got.Bounds().Dx() != w || got.Bounds().Dy() != h {
+			t.Errorf("orientation %d: got %v, want %dx%d", orientation, got.Bounds(), w, h)
+			continue
+		}
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				gr, gg, gb, ga := got.At(got.Bounds().Min.X+x, got.Bounds().Min.Y+y).RGBA()
+				wr, wg, wb, wa := orientedAt(src, orientation, x, y).RGBA()
+				if gr != wr || gg != wg || gb != wb || ga != wa {
+					t.Errorf("orientation %d: pixel (%d, %d) is %v, want %v", orientation, x, y,
+						[]uint32{gr, gg, gb, ga}, []uint32{wr, wg, wb, wa})
+				}
+			}
+		}
+	}
+}
+
+func BenchmarkApplyOrientation(b *testing.B) {
+	src := image.NewYCbCr(image.Rect(0, 0, 6000, 4000), image.YCbCrSubsampleRatio420)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		applyOrientation(src, 6)
+	}
+}
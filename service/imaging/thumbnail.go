@@ -0,0 +1,80 @@
+package imaging
+
+import (
+	"image"
+	"image/draw"
+)
+
+// ThumbnailSizes are the sizes, in pixels, of the longest side of the thumbnails generated for every image, from the
+// largest to the smallest
+var ThumbnailSizes = []int{1024, 256, 64}
+
+// IsThumbnailSize reports whether size is one of ThumbnailSizes
+func IsThumbnailSize(size int) bool {
+	for _, s := range ThumbnailSizes {
+		if s == size {
+			return true
+		}
+	}
+	return false
+}
+
+// Thumbnail scales img down so that it fits in a size x size square, keeping its aspect ratio. Images that already fit
+// are returned as they are, they are never scaled up.
+func Thumbnail(img image.Image, size int) image.Image {
+	b := img.Bounds()
+	sw, sh := b.Dx(), b.Dy()
+	if sw <= size && sh <= size {
+		return img
+	}
+
+	dw, dh := size, size
+	if sw > sh {
+		dh = sh * size / sw
+	} else {
+		dw = sw * size / sh
+	}
+	if dw < 1 {
+		dw = 1
+	}
+	if dh < 1 {
+		dh = 1
+	}
+
+	// Work on RGBA pixels, draw has fast paths for the decoder outputs
+	src, ok := img.(*image.RGBA)
+	if !ok {
+		src = image.NewRGBA(image.Rect(0, 0, sw, sh))
+		draw.Draw(src, src.Bounds(), img, b.Min, draw.Src)
+	}
+	sb := src.Bounds()
+
+	// Every destination pixel is the average of the source pixels it covers
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for dy := 0; dy < dh; dy++ {
+		y0, y1 := dy*sh/dh, (dy+1)*sh/dh
+		for dx := 0; dx < dw; dx++ {
+			x0, x1 := dx*sw/dw, (dx+1)*sw/dw
+
+			var r, g, bl, a, n uint32
+			for y := y0; y < y1; y++ {
+				row := src.PixOffset(sb.Min.X+x0, sb.Min.Y+y)
+				for x := x0; x < x1; x++ {
+					r += uint32(src.Pix[row])
+					g += uint32(src.Pix[row+1])
+					bl += uint32(src.Pix[row+2])
+					a += uint32(src.Pix[row+3])
+					row += 4
+					n++
+				}
+			}
+
+			i := dst.PixOffset(dx, dy)
+			dst.Pix[i] = uint8(r / n)
+			dst.Pix[i+1] = uint8(g / n)
+			dst.Pix[i+2] = uint8(bl / n)
+			dst.Pix[i+3] = uint8(a / n)
+		}
+	}
+	return dst
+}
@@ -0,0 +1,331 @@
+/*
+Package presence tells whether users are online, away or offline from their activity, and remembers when they were
+last seen.
+
+A user is online while they make authenticated requests, away once they stop for a while but still have a real-time
+connection open (or stopped only recently), and offline otherwise. Only the last seen time is saved, in batches, to a
+Store: everything else lives in memory, and a restarted server sees every user offline until they are active again.
+
+Example:
+
+	tracker := presence.NewTracker(presence.Config{Store: appdb, Logger: logger, OnChange: notify})
+	defer tracker.Close()
+
+	// For every authenticated request
+	tracker.Touch(userID)
+
+	// While a real-time connection is open
+	disconnect := tracker.Connect(userID)
+	defer disconnect()
+*/
+package presence
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/Nyheim99/WASAText/service/globaltime"
+	"github.com/sirupsen/logrus"
+)
+
+// Statuses of a user
+const (
+	Online  = "online"
+	Away    = "away"
+	Offline = "offline"
+)
+
+const (
+	// defaultAwayAfter is used when Config.AwayAfter is not set
+	defaultAwayAfter = 2 * time.Minute
+
+	// defaultOfflineAfter is used when Config.OfflineAfter is not set
+	defaultOfflineAfter = 10 * time.Minute
+
+	// defaultFlushInterval is used when Config.FlushInterval is not set
+	defaultFlushInterval = time.Minute
+
+	// checkInterval is how often users are checked for becoming away or offline
+	checkInterval = 15 * time.Second
+)
+
+// Presence is the status of a user, and when they were last active
+type Presence struct {
+	Status   string     `json:"status"`
+	LastSeen *time.Time `json:"last_seen,omitempty"`
+}
+
+// Store saves when users were last active
+type Store interface {
+	SetLastSeen(ctx context.Context, lastSeen map[int64]time.Time) error
+}
+
+// Config is used to provide dependencies and configuration to NewTracker
+type Config struct {
+	// Store where the last seen times are saved
+	Store Store
+
+	// Logger where failures to save are logged
+	Logger logrus.FieldLogger
+
+	// OnChange is called when the status of a user changes, one call at a time, from a goroutine of the tracker
+	OnChange func(userID int64, p Presence)
+
+	// AwayAfter is how long after their last activity an online user becomes away
+	AwayAfter time.Duration
+
+	// OfflineAfter is how long after their last activity a user without real-time connections becomes offline
+	OfflineAfter time.Duration
+
+	// FlushInterval is how often the last seen times are saved
+	FlushInterval time.Duration
+}
+
+// Tracker follows the activity of users. It is safe for concurrent use.
+type Tracker struct {
+	cfg Config
+
+	mu    sync.Mutex
+	users map[int64]*user
+
+	// changed holds the users whose status may have changed since the last check
+	changed map[int64]struct{}
+
+	wake chan struct{}
+	stop chan struct{}
+	done chan struct{}
+}
+
+type user struct {
+	lastSeen    time.Time
+	connections int
+
+	// status is the last one reported to OnChange, and dirty tells that lastSeen wasn't saved yet
+	status string
+	dirty  bool
+}
+
+// NewTracker returns a Tracker without activity, and starts its goroutine. Close must be called to stop it.
+func NewTracker(cfg Config) (*Tracker, error) {
+	if cfg.Store == nil {
+		return nil, errors.New("store is required")
+	}
+	if cfg.Logger == nil {
+		return nil, errors.New("logger is required")
+	}
+	if cfg.AwayAfter <= 0 {
+		cfg.AwayAfter = defaultAwayAfter
+	}
+	if cfg.OfflineAfter <= 0 {
+		cfg.OfflineAfter = defaultOfflineAfter
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = defaultFlushInterval
+	}
+
+	t := &Tracker{
+		cfg:     cfg,
+		users:   make(map[int64]*user),
+		changed: make(map[int64]struct{}),
+		wake:    make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go t.run()
+	return t, nil
+}
+
+// Touch records an activity of the user
+func (t *Tracker) Touch(userID int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	u := t.get(userID)
+	u.lastSeen = globaltime.Now().Truncate(time.Second)
+	u.dirty = true
+	if u.status != Online {
+		t.notify(userID)
+	}
+}
+
+// Connect records a real-time connection of the user, and returns the function to call when it ends
+func (t *Tracker) Connect(userID int64) (disconnect func()) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.get(userID).connections++
+	t.notify(userID)
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.users[userID].connections--
+			t.notify(userID)
+		})
+	}
+}
+
+// Get returns the presence of a user. saved is the last seen time from the Store, used when the tracker knows of no
+// later activity.
+func (t *Tracker) Get(userID int64, saved *time.Time) Presence {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	u, ok := t.users[userID]
+	if !ok {
+		return Presence{Status: Offline, LastSeen: saved}
+	}
+	p := Presence{Status: t.status(u, globaltime.Now()), LastSeen: saved}
+	if !u.lastSeen.IsZero() && (saved == nil || u.lastSeen.After(*saved)) {
+		lastSeen := u.lastSeen.UTC()
+		p.LastSeen = &lastSeen
+	}
+	return p
+}
+
+// Close stops the tracker, and saves the last seen times not saved yet
+func (t *Tracker) Close() error {
+	select {
+	case <-t.stop:
+	default:
+		close(t.stop)
+	}
+	<-t.done
+	return nil
+}
+
+// get returns the state of a user, creating it if needed. It must be called with the lock held.
+func (t *Tracker) get(userID int64) *user {
+	u, ok := t.users[userID]
+	if !ok {
+		u = &user{status: Offline}
+		t.users[userID] = u
+	}
+	return u
+}
+
+// notify makes the goroutine check the status of a user. It must be called with the lock held.
+func (t *Tracker) notify(userID int64) {
+	t.changed[userID] = struct{}{}
+	select {
+	case t.wake <- struct{}{}:
+	default:
+	}
+}
+
+// status tells the status of a user at now. It must be called with the lock held.
+func (t *Tracker) status(u *user, now time.Time) string {
+	idle := now.Sub(u.lastSeen)
+	switch {
+	case !u.lastSeen.IsZero() && idle < t.cfg.AwayAfter:
+		return Online
+	case u.connections > 0 || (!u.lastSeen.IsZero() && idle < t.cfg.OfflineAfter):
+		return Away
+	default:
+		return Offline
+	}
+}
+
+func (t *Tracker) run() {
+	defer close(t.done)
+
+	check := time.NewTicker(checkInterval)
+	defer check.Stop()
+	flush := time.NewTicker(t.cfg.FlushInterval)
+	defer flush.Stop()
+
+	for {
+		select {
+		case <-t.wake:
+			t.report(false)
+		case <-check.C:
+			t.report(true)
+		case <-flush.C:
+			t.flush()
+		case <-t.stop:
+			t.flush()
+			return
+		}
+	}
+}
+
+// report calls OnChange for the users whose status changed: the ones notified, or every one if all is set. Users
+// which are offline, and have been saved, are forgotten.
+func (t *Tracker) report(all bool) {
+	type change struct {
+		userID int64
+		p      Presence
+	}
+	var changes []change
+
+	t.mu.Lock()
+	now := globaltime.Now()
+	check := func(userID int64, u *user) {
+		status := t.status(u, now)
+		if status != u.status {
+			u.status = status
+			p := Presence{Status: status}
+			if !u.lastSeen.IsZero() {
+				lastSeen := u.lastSeen.UTC()
+				p.LastSeen = &lastSeen
+			}
+			changes = append(changes, change{userID, p})
+		}
+		if status == Offline && u.connections == 0 && !u.dirty {
+			delete(t.users, userID)
+		}
+	}
+	if all {
+		for userID, u := range t.users {
+			check(userID, u)
+		}
+	} else {
+		for userID := range t.changed {
+			if u, ok := t.users[userID]; ok {
+				check(userID, u)
+			}
+		}
+	}
+	t.changed = make(map[int64]struct{})
+	t.mu.Unlock()
+
+	if t.cfg.OnChange == nil {
+		return
+	}
+	for _, c := range changes {
+		t.cfg.OnChange(c.userID, c.p)
+	}
+}
+
+// flush saves the last seen times which changed since the last flush
+func (t *Tracker) flush() {
+	t.mu.Lock()
+	lastSeen := make(map[int64]time.Time)
+	for userID, u := range t.users {
+		if u.dirty {
+			lastSeen[userID] = u.lastSeen
+			u.dirty = false
+		}
+	}
+	t.mu.Unlock()
+
+	if len(lastSeen) == 0 {
+		return
+	}
+	if err := t.cfg.Store.SetLastSeen(context.Background(), lastSeen); err != nil {
+		t.cfg.Logger.WithError(err).Warn("can't save the last seen times")
+
+		// Try again at the next flush, unless there is newer activity to save by then
+		t.mu.Lock()
+		for userID := range lastSeen {
+			if u, ok := t.users[userID]; ok {
+				u.dirty = true
+			}
+		}
+		t.mu.Unlock()
+	}
+}
@@ -0,0 +1,223 @@
+package presence
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Nyheim99/WASAText/service/globaltime"
+	"github.com/sirupsen/logrus"
+)
+
+// store is a Store which keeps the last seen times in memory, and fails while err is set
+type store struct {
+	saved []map[int64]time.Time
+	err   error
+}
+
+func (s *store) SetLastSeen(ctx context.Context, lastSeen map[int64]time.Time) error {
+	s.saved = append(s.saved, lastSeen)
+	return s.err
+}
+
+type change struct {
+	userID int64
+	p      Presence
+}
+
+// testTracker is a Tracker whose goroutine is stopped, so that the test calls report and flush itself, with the
+// changes it reported
+type testTracker struct {
+	*Tracker
+	store   *store
+	logs    *bytes.Buffer
+	changes []change
+}
+
+func newTracker(t *testing.T) *testTracker {
+	t.Helper()
+	tt := &testTracker{store: &store{}, logs: &bytes.Buffer{}}
+	logger := logrus.New()
+	logger.SetOutput(tt.logs)
+
+	tracker, err := NewTracker(Config{
+		Store:    tt.store,
+		Logger:   logger,
+		OnChange: func(userID int64, p Presence) { tt.changes = append(tt.changes, change{userID, p}) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tracker.Close(); err != nil {
+		t.Fatal(err)
+	}
+	tt.Tracker = tracker
+	return tt
+}
+
+// at sets the current time for the rest of the test
+func at(t *testing.T, now time.Time) {
+	globaltime.FixedTime = now
+	t.Cleanup(func() { globaltime.FixedTime = time.Time{} })
+}
+
+// checkChanges fails the test if the changes reported since the last call aren't the statuses in want, all for userID
+// and with lastSeen
+func (tt *testTracker) checkChanges(t *testing.T, userID int64, lastSeen *time.Time, want ...string) {
+	t.Helper()
+	var got []string
+	for _, c := range tt.changes {
+		got = append(got, c.p.Status)
+		if c.userID != userID {
+			t.Errorf("change reported for user %d, want %d", c.userID, userID)
+		}
+		if (c.p.LastSeen == nil) != (lastSeen == nil) || (lastSeen != nil && !c.p.LastSeen.Equal(*lastSeen)) {
+			t.Errorf("%s reported with last seen %v, want %v", c.p.Status, c.p.LastSeen, lastSeen)
+		}
+	}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("reported %v, want %v", got, want)
+	}
+	tt.changes = nil
+}
+
+func TestStatus(t *testing.T) {
+	start := time.Date(2024, 2, 2, 15, 4, 5, 0, time.UTC)
+
+	t.Run("requests only", func(t *testing.T) {
+		at(t, start)
+		tracker := newTracker(t)
+
+		tracker.Touch(1)
+		tracker.report(false)
+		tracker.checkChanges(t, 1, &start, Online)
+		if p := tracker.Get(1, nil); p.Status != Online || !p.LastSeen.Equal(start) {
+			t.Errorf("active user is %+v", p)
+		}
+
+		//Nothing changes until the user is idle for long enough
+		at(t, start.Add(time.Minute))
+		tracker.report(true)
+		tracker.checkChanges(t, 1, &start)
+
+		at(t, start.Add(defaultAwayAfter))
+		tracker.report(true)
+		tracker.checkChanges(t, 1, &start, Away)
+
+		at(t, start.Add(defaultOfflineAfter))
+		tracker.report(true)
+		tracker.checkChanges(t, 1, &start, Offline)
+
+		//A request brings the user back online
+		now := start.Add(defaultOfflineAfter + time.Second)
+		at(t, now)
+		tracker.Touch(1)
+		tracker.report(false)
+		tracker.checkChanges(t, 1, &now, Online)
+	})
+
+	t.Run("real-time connection", func(t *testing.T) {
+		at(t, start)
+		tracker := newTracker(t)
+
+		tracker.Touch(1)
+		disconnect := tracker.Connect(1)
+		tracker.report(false)
+		tracker.checkChanges(t, 1, &start, Online)
+
+		//A user with a connection open stays away instead of going offline
+		at(t, start.Add(time.Hour))
+		tracker.report(true)
+		tracker.checkChanges(t, 1, &start, Away)
+
+		disconnect()
+		disconnect()
+		tracker.report(false)
+		tracker.checkChanges(t, 1, &start, Offline)
+	})
+
+	t.Run("connection without requests", func(t *testing.T) {
+		at(t, start)
+		tracker := newTracker(t)
+
+		disconnect := tracker.Connect(1)
+		tracker.report(false)
+		tracker.checkChanges(t, 1, nil, Away)
+		if p := tracker.Get(1, nil); p.Status != Away || p.LastSeen != nil {
+			t.Errorf("connected user is %+v", p)
+		}
+
+		//Without activity to save the user is forgotten as soon as they are offline
+		disconnect()
+		tracker.report(false)
+		tracker.checkChanges(t, 1, nil, Offline)
+		if len(tracker.users) != 0 {
+			t.Errorf("offline user without activity is remembered")
+		}
+	})
+}
+
+func TestGetSavedLastSeen(t *testing.T) {
+	start := time.Date(2024, 2, 2, 15, 4, 5, 0, time.UTC)
+	at(t, start)
+	tracker := newTracker(t)
+
+	saved := start.Add(-time.Hour)
+	if p := tracker.Get(1, &saved); p.Status != Offline || p.LastSeen != &saved {
+		t.Errorf("unknown user is %+v", p)
+	}
+
+	//The activity seen by the tracker is newer than the saved one
+	tracker.Touch(1)
+	if p := tracker.Get(1, &saved); p.Status != Online || !p.LastSeen.Equal(start) {
+		t.Errorf("active user is %+v", p)
+	}
+}
+
+func TestFlush(t *testing.T) {
+	start := time.Date(2024, 2, 2, 15, 4, 5, 0, time.UTC)
+	at(t, start)
+	tracker := newTracker(t)
+
+	tracker.Touch(1)
+	tracker.Touch(2)
+	tracker.report(false)
+	tracker.flush()
+	if len(tracker.store.saved) != 1 || len(tracker.store.saved[0]) != 2 || !tracker.store.saved[0][1].Equal(start) {
+		t.Fatalf("saved %v", tracker.store.saved)
+	}
+
+	//Only the times which changed are saved again
+	tracker.flush()
+	later := start.Add(time.Minute)
+	at(t, later)
+	tracker.Touch(2)
+	tracker.store.err = errors.New("injected failure")
+	tracker.flush()
+	if len(tracker.store.saved) != 2 || len(tracker.store.saved[1]) != 1 || !tracker.store.saved[1][2].Equal(later) {
+		t.Fatalf("saved %v", tracker.store.saved)
+	}
+	if !strings.Contains(tracker.logs.String(), "injected failure") {
+		t.Errorf("failure to save was not logged: %s", tracker.logs)
+	}
+
+	//The failed save is tried again at the next flush
+	tracker.store.err = nil
+	tracker.flush()
+	if len(tracker.store.saved) != 3 || len(tracker.store.saved[2]) != 1 || !tracker.store.saved[2][2].Equal(later) {
+		t.Fatalf("saved %v", tracker.store.saved)
+	}
+
+	//Users are forgotten once they are offline and their last activity is saved
+	at(t, start.Add(time.Hour))
+	tracker.report(true)
+	if len(tracker.users) != 0 {
+		t.Errorf("%d offline users are remembered, want none", len(tracker.users))
+	}
+	if p := tracker.Get(2, nil); p.Status != Offline {
+		t.Errorf("forgotten user is %+v", p)
+	}
+}
@@ -0,0 +1,181 @@
+/*
+Package realtime delivers events to the clients of users as they happen, e.g. through Server-Sent Events. Events are
+published to a Hub for a set of users, and the Hub passes them to every Subscription of those users.
+
+Delivery never blocks the publisher: a subscriber which doesn't keep up with its events is dropped, and its
+subscription closed. The client is expected to connect again and reload what it shows, as it would after a network
+failure.
+
+Example:
+
+	hub := realtime.NewHub()
+	defer hub.Close()
+
+	sub := hub.Subscribe(userID)
+	defer sub.Close()
+	for event := range sub.Events() {
+		...
+	}
+
+	// Somewhere else
+	hub.Publish(participantIDs, realtime.Event{Type: realtime.EventMessageCreated, ...})
+*/
+package realtime
+
+import (
+	"sync"
+)
+
+// Types of events
+const (
+	EventMessageCreated    = "message_created"
+	EventMessageDeleted    = "message_deleted"
+	EventMessageEdited     = "message_edited"
+	EventMessageHidden     = "message_hidden"
+	EventThreadUpdated     = "thread_updated"
+	EventReactionChanged   = "reaction_changed"
+	EventMessagesRead      = "messages_read"
+	EventMessagesDelivered = "messages_delivered"
+	EventMemberAdded       = "member_added"
+	EventMemberLeft        = "member_left"
+	EventGroupRenamed      = "group_renamed"
+	EventTyping            = "typing"
+	EventPresence          = "presence_changed"
+)
+
+// subscriptionBuffer is how many events a subscription holds before its subscriber is considered too slow
+const subscriptionBuffer = 64
+
+// Event is a change in a conversation, pushed to its participants
+type Event struct {
+	// ID increases with every event published by a Hub
+	ID uint64 `json:"id"`
+
+	// Type is one of the Event* constants
+	Type string `json:"type"`
+
+	// ConversationID is zero for events which are not about a conversation, like a change of presence
+	ConversationID int64 `json:"conversation_id,omitempty"`
+
+	// Data describes the change, depending on Type. It must be serializable as JSON.
+	Data interface{} `json:"data,omitempty"`
+}
+
+// Hub dispatches the events published for users to their subscriptions. It is safe for concurrent use.
+type Hub struct {
+	mu            sync.Mutex
+	lastID        uint64
+	subscriptions map[int64]map[*Subscription]struct{}
+	closed        bool
+}
+
+// NewHub returns a Hub without subscriptions
+func NewHub() *Hub {
+	return &Hub{subscriptions: make(map[int64]map[*Subscription]struct{})}
+}
+
+// Subscribe returns a subscription to the events of a user. The caller must close it when done. Subscribing to a
+// closed Hub returns a closed subscription.
+func (h *Hub) Subscribe(userID int64) *Subscription {
+	sub := &Subscription{
+		hub:    h,
+		userID: userID,
+		events: make(chan Event, subscriptionBuffer),
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		close(sub.events)
+		sub.closed = true
+		return sub
+	}
+	if h.subscriptions[userID] == nil {
+		h.subscriptions[userID] = make(map[*Subscription]struct{})
+	}
+	h.subscriptions[userID][sub] = struct{}{}
+	return sub
+}
+
+// Publish sends an event to every subscription of the users, and returns it with its ID. Subscriptions which have no
+// room left for the event are closed.
+func (h *Hub) Publish(userIDs []int64, event Event) Event {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.lastID++
+	event.ID = h.lastID
+	if h.closed {
+		return event
+	}
+
+	for _, userID := range userIDs {
+		for sub := range h.subscriptions[userID] {
+			select {
+			case sub.events <- event:
+			default:
+				sub.lagged = true
+				h.remove(sub)
+			}
+		}
+	}
+	return event
+}
+
+// Close closes every subscription, and makes the Hub drop the events published afterwards
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closed = true
+	for _, subs := range h.subscriptions {
+		for sub := range subs {
+			h.remove(sub)
+		}
+	}
+}
+
+// remove closes a subscription and forgets it. It must be called with the lock held.
+func (h *Hub) remove(sub *Subscription) {
+	if sub.closed {
+		return
+	}
+	sub.closed = true
+	close(sub.events)
+
+	delete(h.subscriptions[sub.userID], sub)
+	if len(h.subscriptions[sub.userID]) == 0 {
+		delete(h.subscriptions, sub.userID)
+	}
+}
+
+// Subscription receives the events of a user
+type Subscription struct {
+	hub    *Hub
+	userID int64
+	events chan Event
+
+	// closed and lagged are protected by the lock of the hub
+	closed bool
+	lagged bool
+}
+
+// Events returns the channel of the events, which is closed when the subscription is closed, by Close, by the Hub
+// closing, or because the subscriber was too slow
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Lagged reports whether the subscription was closed because the subscriber didn't keep up with its events
+func (s *Subscription) Lagged() bool {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	return s.lagged
+}
+
+// Close ends the subscription. It can be called more than once.
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	s.hub.remove(s)
+}
@@ -0,0 +1,114 @@
+package realtime
+
+import (
+	"testing"
+)
+
+// drain returns the events left in a subscription, and whether it is closed
+func drain(sub *Subscription) ([]Event, bool) {
+	var events []Event
+	for {
+		select {
+		case event, ok := <-sub.Events():
+			if !ok {
+				return events, true
+			}
+			events = append(events, event)
+		default:
+			return events, false
+		}
+	}
+}
+
+func TestPublish(t *testing.T) {
+	hub := NewHub()
+	defer hub.Close()
+
+	alice, bob, carol := hub.Subscribe(1), hub.Subscribe(2), hub.Subscribe(3)
+	first := hub.Publish([]int64{1, 2}, Event{Type: EventMessageCreated, ConversationID: 7})
+	second := hub.Publish([]int64{2}, Event{Type: EventTyping, ConversationID: 7})
+	if first.ID == 0 || second.ID <= first.ID {
+		t.Errorf("events got IDs %d and %d", first.ID, second.ID)
+	}
+
+	for name, tt := range map[string]struct {
+		sub  *Subscription
+		want []Event
+	}{
+		"alice": {alice, []Event{first}},
+		"bob":   {bob, []Event{first, second}},
+		"carol": {carol, nil},
+	} {
+		events, closed := drain(tt.sub)
+		if closed || len(events) != len(tt.want) {
+			t.Errorf("%s received %v (closed: %t), want %v", name, events, closed, tt.want)
+			continue
+		}
+		for i := range events {
+			if events[i].ID != tt.want[i].ID || events[i].Type != tt.want[i].Type {
+				t.Errorf("%s received %v, want %v", name, events, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestLaggingSubscription(t *testing.T) {
+	hub := NewHub()
+	defer hub.Close()
+
+	//Two clients of the same user, only one of them keeps up
+	slow, fast := hub.Subscribe(1), hub.Subscribe(1)
+	for i := 0; i <= subscriptionBuffer; i++ {
+		hub.Publish([]int64{1}, Event{Type: EventTyping})
+		if _, closed := drain(fast); closed {
+			t.Fatalf("subscription which keeps up was closed after %d events", i+1)
+		}
+	}
+
+	//The events which fit are still delivered before the channel is closed
+	events, closed := drain(slow)
+	if !closed || len(events) != subscriptionBuffer {
+		t.Errorf("lagging subscription received %d events (closed: %t), want %d and closed", len(events), closed, subscriptionBuffer)
+	}
+	if !slow.Lagged() {
+		t.Error("lagging subscription is not reported as lagged")
+	}
+	if fast.Lagged() {
+		t.Error("subscription which keeps up is reported as lagged")
+	}
+
+	//Publishing again reaches only the subscription left, and closing the lagging one again does nothing
+	hub.Publish([]int64{1}, Event{Type: EventTyping})
+	slow.Close()
+	if events, closed := drain(fast); closed || len(events) != 1 {
+		t.Errorf("subscription which keeps up received %d events (closed: %t), want 1", len(events), closed)
+	}
+}
+
+func TestClose(t *testing.T) {
+	hub := NewHub()
+	subs := []*Subscription{hub.Subscribe(1), hub.Subscribe(1), hub.Subscribe(2)}
+	hub.Publish([]int64{1, 2}, Event{Type: EventTyping})
+
+	hub.Close()
+	for i, sub := range subs {
+		events, closed := drain(sub)
+		if !closed || len(events) != 1 {
+			t.Errorf("subscription %d received %d events (closed: %t), want 1 and closed", i, len(events), closed)
+		}
+		if sub.Lagged() {
+			t.Errorf("subscription %d is reported as lagged", i)
+		}
+		sub.Close()
+	}
+
+	//Subscribing afterwards returns a closed subscription, and events are dropped
+	late := hub.Subscribe(1)
+	hub.Publish([]int64{1}, Event{Type: EventTyping})
+	if events, closed := drain(late); !closed || len(events) != 0 {
+		t.Errorf("subscription to a closed hub received %d events (closed: %t)", len(events), closed)
+	}
+	late.Close()
+	hub.Close()
+}
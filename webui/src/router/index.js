@@ -12,7 +12,7 @@ const router = createRouter({
 
 //Redirect user to login if not logged in
 router.beforeEach((to, from, next) => {
-	const isLoggedIn = !!localStorage.getItem("userId");
+	const isLoggedIn = !!localStorage.getItem("token");
 
 	//If user tries to acces /login while being logged in
 	//redirect to homepage
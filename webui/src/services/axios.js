@@ -8,11 +8,11 @@ const instance = axios.create({
 	},
 });
 
-//Set Auth header if userId exists
+//Set Auth header if a session token exists
 instance.interceptors.request.use((config) => {
-	const userId = localStorage.getItem("userId");
-	if (userId) {
-		config.headers.Authorization = `Bearer ${userId}`;
+	const token = localStorage.getItem("token");
+	if (token) {
+		config.headers.Authorization = `Bearer ${token}`;
 	}
 	return config;
 });